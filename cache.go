@@ -0,0 +1,368 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the session monitor's in-memory cache of
+ * sessions.
+ *
+ * The cache is an LRU list which can be limited by the number of
+ * sessions and by their (estimated) memory usage.
+ * If a limit is exceeded the least recently used sessions are
+ * evicted from the cache; modified sessions are written to the store
+ * before they're dropped.
+ * Each access of a cached session extends its lifetime; expired
+ * sessions are dropped when accessed and by regular sweeps.
+ * The cache is used by the session monitor goroutine only, so it
+ * doesn't need any locking itself.
+ */
+
+import (
+	"container/list"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// TCacheStats are the statistics of the in-memory cache of
+	// sessions.
+	TCacheStats struct {
+		Entries   int    // number of cached sessions
+		Bytes     int64  // estimated memory used by the cached sessions
+		Hits      uint64 // lookups answered from the cache
+		Misses    uint64 // lookups which had to read the store
+		Evictions uint64 // sessions dropped to stay within the limits
+		Expired   uint64 // expired sessions dropped
+		Rejected  uint64 // writes rejected by the session limits
+	}
+
+	// `tCacheEntry` is a single session in the cache.
+	tCacheEntry struct {
+		record *tSessionRecord
+		size   int64 // estimated memory usage
+		dirty  bool  // whether the session was changed since storing it
+	}
+
+	// `tShCache` is the session monitor's LRU list of sessions.
+	tShCache struct {
+		entries map[string]*list.Element
+		lru     *list.List // front: most recently used
+		pending tShList    // evicted sessions being written
+		shares  int        // number of caches sharing the limits
+		stats   TCacheStats
+
+		// `onExpire` is called for each expired session dropped
+		onExpire func(aRecord *tSessionRecord)
+	}
+)
+
+var (
+	// `soCacheMaxEntries` is the max. number of cached sessions
+	// (zero: unlimited).
+	soCacheMaxEntries int64
+
+	// `soCacheMaxBytes` is the max. estimated memory usage of the
+	// cached sessions (zero: unlimited).
+	soCacheMaxBytes int64
+)
+
+// CacheLimits returns the limits of the in-memory cache of sessions;
+// zero means unlimited.
+func CacheLimits() (rMaxEntries int, rMaxBytes int64) {
+	return int(atomic.LoadInt64(&soCacheMaxEntries)),
+		atomic.LoadInt64(&soCacheMaxBytes)
+} // CacheLimits()
+
+// CacheStats returns the current statistics of the in-memory cache
+// of sessions.
+func CacheStats() (rStats TCacheStats) {
+	engine := soEngine
+	for idx := 0; idx < engine.shards(); idx++ {
+		stats, _ := engine.requestShard(idx, tShRequest{
+			rType: smCacheStats,
+		}).sValue.(TCacheStats)
+
+		rStats.Entries += stats.Entries
+		rStats.Bytes += stats.Bytes
+		rStats.Hits += stats.Hits
+		rStats.Misses += stats.Misses
+		rStats.Evictions += stats.Evictions
+		rStats.Expired += stats.Expired
+		rStats.Rejected += stats.Rejected
+	}
+
+	return
+} // CacheStats()
+
+// SetCacheLimits limits the in-memory cache of sessions.
+//
+// If a limit is exceeded the least recently used sessions are
+// dropped from the cache; changed sessions are written to the store
+// before.
+// The memory usage of a session is estimated from the size of its
+// keys and values.
+// With `TMemoryStore` there's no store to write the sessions to, so
+// evicted sessions are lost.
+// With several session monitors (see `SetMonitorShards()`) each of
+// them gets an equal share of the limits.
+// The new limits take effect with the next change of the cache.
+//
+//	`aMaxEntries` The max. number of sessions to keep in memory (zero: unlimited).
+//	`aMaxBytes` The max. estimated memory used by the sessions (zero: unlimited).
+func SetCacheLimits(aMaxEntries int, aMaxBytes int64) {
+	if 0 > aMaxEntries {
+		aMaxEntries = 0
+	}
+	if 0 > aMaxBytes {
+		aMaxBytes = 0
+	}
+	atomic.StoreInt64(&soCacheMaxEntries, int64(aMaxEntries))
+	atomic.StoreInt64(&soCacheMaxBytes, aMaxBytes)
+} // SetCacheLimits()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `newCache()` returns a new, empty cache.
+//
+//	`aShares` The number of caches sharing the limits.
+func newCache(aShares int) *tShCache {
+	if 0 >= aShares {
+		aShares = 1
+	}
+
+	return &tShCache{
+		entries: make(map[string]*list.Element, 32),
+		lru:     list.New(),
+		pending: make(tShList),
+		shares:  aShares,
+	}
+} // newCache()
+
+// `add()` inserts `aRecord` as the most recently used session,
+// replacing a cached session with the same ID.
+//
+//	`aRecord` The session to cache.
+func (c *tShCache) add(aRecord *tSessionRecord) {
+	c.remove(aRecord.sID)
+	entry := &tCacheEntry{
+		record: aRecord,
+		size:   recordSize(aRecord),
+	}
+	c.entries[aRecord.sID] = c.lru.PushFront(entry)
+	c.stats.Bytes += entry.size
+} // add()
+
+// `changed()` marks the session of `aSID` as modified and updates
+// its estimated size.
+//
+//	`aSID` The ID of the changed session.
+func (c *tShCache) changed(aSID string) {
+	if elem, ok := c.entries[aSID]; ok {
+		entry := elem.Value.(*tCacheEntry)
+		size := recordSize(entry.record)
+		c.stats.Bytes += size - entry.size
+		entry.size, entry.dirty = size, true
+	}
+} // changed()
+
+// `dirty()` returns whether the cached session of `aSID` was changed
+// since it was written to the store.
+//
+//	`aSID` The ID of the session to check.
+func (c *tShCache) dirty(aSID string) bool {
+	if elem, ok := c.entries[aSID]; ok {
+		return elem.Value.(*tCacheEntry).dirty
+	}
+
+	return false
+} // dirty()
+
+// `evict()` drops the least recently used sessions until the cache
+// is within its limits again.
+//
+// The most recently used session is never evicted.
+// Changed sessions are returned to be written to the store (or to be
+// removed from it if they became empty).
+func (c *tShCache) evict() (rDirty []*tSessionRecord) {
+	maxEntries, maxBytes := CacheLimits()
+	if 1 < c.shares { // each cache gets its share of the limits
+		maxEntries = (maxEntries + c.shares - 1) / c.shares
+		maxBytes = (maxBytes + int64(c.shares) - 1) / int64(c.shares)
+	}
+	for 1 < c.lru.Len() {
+		if ((0 == maxEntries) || (maxEntries >= c.lru.Len())) &&
+			((0 == maxBytes) || (maxBytes >= c.stats.Bytes)) {
+			break
+		}
+		entry := c.lru.Back().Value.(*tCacheEntry)
+		c.remove(entry.record.sID)
+		c.stats.Evictions++
+		if entry.dirty {
+			rDirty = append(rDirty, entry.record)
+		}
+	}
+
+	return
+} // evict()
+
+// `expire()` drops the expired `aRecord` from the cache.
+//
+//	`aRecord` The expired session record.
+func (c *tShCache) expire(aRecord *tSessionRecord) {
+	c.remove(aRecord.sID)
+	c.stats.Expired++
+	if nil != c.onExpire {
+		c.onExpire(aRecord)
+	}
+} // expire()
+
+// `flushed()` signals that the evicted `aRecord` was written.
+//
+//	`aSID` The ID the session was written with.
+//	`aRecord` The evicted session record.
+func (c *tShCache) flushed(aSID string, aRecord *tSessionRecord) {
+	if record, ok := c.pending[aSID]; ok && (record == aRecord) {
+		delete(c.pending, aSID)
+	}
+} // flushed()
+
+// `get()` returns the cached session of `aSID` (or `nil`) and marks
+// it as the most recently used one.
+//
+// The session's last access and expiry times are updated.
+// An expired session is removed from the cache and `nil` is returned.
+// A session evicted but not yet written is put back into the cache.
+//
+//	`aSID` The ID of the requested session.
+func (c *tShCache) get(aSID string) *tSessionRecord {
+	var record *tSessionRecord
+	if elem, ok := c.entries[aSID]; ok {
+		c.lru.MoveToFront(elem)
+		record = elem.Value.(*tCacheEntry).record
+	} else if record, ok = c.pending[aSID]; ok {
+		delete(c.pending, aSID)
+		c.add(record)
+		c.entries[aSID].Value.(*tCacheEntry).dirty = true
+	} else {
+		return nil
+	}
+
+	if !record.expires.After(time.Now()) {
+		c.expire(record)
+		return nil
+	}
+	record.touch()
+
+	return record
+} // get()
+
+// `peek()` returns the cached session of `aSID` (or `nil`) without
+// marking it as used.
+//
+//	`aSID` The ID of the requested session.
+func (c *tShCache) peek(aSID string) *tSessionRecord {
+	if elem, ok := c.entries[aSID]; ok {
+		return elem.Value.(*tCacheEntry).record
+	}
+
+	return c.pending[aSID]
+} // peek()
+
+// `records()` returns copies of all non-empty sessions in the cache.
+func (c *tShCache) records() []*tSessionRecord {
+	result := make([]*tSessionRecord, 0, c.lru.Len())
+	for elem := c.lru.Front(); nil != elem; elem = elem.Next() {
+		if record := elem.Value.(*tCacheEntry).record; 0 < len(record.data) {
+			result = append(result, record.clone())
+		}
+	}
+
+	return result
+} // records()
+
+// `remove()` drops the session of `aSID` from the cache.
+//
+//	`aSID` The ID of the session to remove.
+func (c *tShCache) remove(aSID string) {
+	if elem, ok := c.entries[aSID]; ok {
+		c.stats.Bytes -= elem.Value.(*tCacheEntry).size
+		c.lru.Remove(elem)
+		delete(c.entries, aSID)
+	}
+	delete(c.pending, aSID)
+} // remove()
+
+// `stored()` marks the session of `aSID` as written to the store.
+//
+//	`aSID` The ID of the stored session.
+func (c *tShCache) stored(aSID string) {
+	if elem, ok := c.entries[aSID]; ok {
+		elem.Value.(*tCacheEntry).dirty = false
+	}
+} // stored()
+
+// `sweep()` removes all sessions expired at `aTime` from the cache.
+//
+//	`aTime` The time to compare the expiry times with.
+func (c *tShCache) sweep(aTime time.Time) {
+	for _, elem := range c.entries {
+		if record := elem.Value.(*tCacheEntry).record; !record.expires.After(aTime) {
+			c.expire(record)
+		}
+	}
+} // sweep()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `recordSize()` returns the estimated memory usage of `aRecord`.
+//
+//	`aRecord` The session record to inspect.
+func recordSize(aRecord *tSessionRecord) int64 {
+	result := int64(128 + len(aRecord.sID)) // record and map overhead
+	for key, value := range aRecord.data {
+		result += int64(16+len(key)) + valueSize(value)
+	}
+
+	return result
+} // recordSize()
+
+// `valueSize()` returns the estimated memory usage of `aValue`.
+//
+//	`aValue` The session value to inspect.
+func valueSize(aValue interface{}) int64 {
+	switch v := aValue.(type) {
+	case string:
+		return int64(16 + len(v))
+	case []byte:
+		return int64(24 + len(v))
+	case []string:
+		result := int64(24)
+		for _, s := range v {
+			result += int64(16 + len(s))
+		}
+		return result
+	case []interface{}:
+		result := int64(24)
+		for _, item := range v {
+			result += valueSize(item)
+		}
+		return result
+	case map[string]interface{}:
+		result := int64(48)
+		for key, item := range v {
+			result += int64(16+len(key)) + valueSize(item)
+		}
+		return result
+	case tSessionData:
+		return valueSize(map[string]interface{}(v))
+	}
+
+	return 16
+} // valueSize()
+
+/* _EoF_ */
@@ -0,0 +1,157 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_tShCache_evict(t *testing.T) {
+	defer SetCacheLimits(CacheLimits())
+	SetCacheLimits(2, 0)
+
+	c := newCache(1)
+	for _, sid := range []string{"sid1", "sid2", "sid3"} {
+		c.add(newRecord(sid))
+	}
+	c.get("sid1") // sid2 is the least recently used one now
+	c.get("sid3").data["Zahl"] = 3
+	c.changed("sid3")
+	c.get("sid2").data["Zahl"] = 2
+	c.changed("sid2")
+	c.get("sid1")
+
+	dirty := c.evict()
+	if 2 != c.lru.Len() {
+		t.Errorf("evict() kept %d entries, want %d", c.lru.Len(), 2)
+	}
+	if nil != c.get("sid3") {
+		t.Error("evict() kept least recently used session")
+	}
+	if (1 != len(dirty)) || ("sid3" != dirty[0].sID) {
+		t.Errorf("evict() = %v, want changed session %q", dirty, "sid3")
+	}
+	if 1 != c.stats.Evictions {
+		t.Errorf("Evictions = %d, want %d", c.stats.Evictions, 1)
+	}
+
+	// byte budget
+	SetCacheLimits(0, 1000)
+	c.get("sid1").data["Text"] = strings.Repeat("x", 2000)
+	c.changed("sid1")
+	c.evict()
+	if (1 != c.lru.Len()) || (nil == c.get("sid1")) {
+		t.Error("evict() didn't keep the most recently used session only")
+	}
+	c.remove("sid1")
+	if 0 != c.stats.Bytes {
+		t.Errorf("Bytes = %d, want %d", c.stats.Bytes, 0)
+	}
+} // Test_tShCache_evict()
+
+func Test_tShCache_pending(t *testing.T) {
+	c := newCache(1)
+	record := newRecord("sid1")
+	c.pending[record.sID] = record
+
+	if got := c.get("sid1"); record != got {
+		t.Fatalf("get() = %v, want pending record", got)
+	}
+	if 0 != len(c.pending) {
+		t.Error("get() didn't remove record from pending list")
+	}
+	if !c.entries["sid1"].Value.(*tCacheEntry).dirty {
+		t.Error("get() restored pending record as unchanged")
+	}
+	c.remove("sid1")
+	c.pending[record.sID] = record
+	c.flushed("sid1", newRecord("sid1"))
+	if 1 != len(c.pending) {
+		t.Error("flushed() removed a different record")
+	}
+	c.flushed("sid1", record)
+	if 0 != len(c.pending) {
+		t.Error("flushed() didn't remove the record")
+	}
+} // Test_tShCache_pending()
+
+func Test_tShCache_sweep(t *testing.T) {
+	now := time.Now()
+	c := newCache(1)
+	c.add(newRecord("sid1"))
+	r2 := newRecord("sid2")
+	r2.expires = now.Add(-time.Second)
+	c.add(r2)
+	c.sweep(now)
+	if nil != c.get("sid2") {
+		t.Errorf("sweep() kept expired session")
+	}
+	if nil == c.get("sid1") {
+		t.Errorf("sweep() removed active session")
+	}
+} // Test_tShCache_sweep()
+
+func TestCacheStats(t *testing.T) {
+	defer SetCacheLimits(CacheLimits())
+	SetCacheLimits(1, 0)
+	store := &TFileStore{dir: t.TempDir()}
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+
+	s1 := &TSession{sID: newSID()}
+	s1.Set("Zahl", 1) // miss
+	s2 := &TSession{sID: newSID()}
+	s2.Set("Zahl", 2)                          // miss, evicts s1
+	if got, _ := s2.GetInt("Zahl"); 2 != got { // hit
+		t.Errorf("GetInt() = %v, want %v", got, 2)
+	}
+	// either read from disk or taken from the pending writes
+	if got, _ := s1.GetInt("Zahl"); 1 != got {
+		t.Errorf("GetInt() of evicted session = %v, want %v", got, 1)
+	}
+
+	stats := CacheStats()
+	if (1 != stats.Entries) || (2 != stats.Evictions) ||
+		(4 != stats.Hits+stats.Misses) || (2 > stats.Misses) {
+		t.Errorf("CacheStats() = %+v", stats)
+	}
+	// wait for both evicted sessions to be written
+	for _, sid := range []string{s1.sID, s2.sID} {
+		for i := 0; 1000 > i; i++ {
+			if _, err := os.Stat(store.fileName(sid)); nil == err {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+} // TestCacheStats()
+
+func Test_tShCache_get(t *testing.T) {
+	c := newCache(1)
+	r1 := newRecord("sid1")
+	r1.accessed = r1.accessed.Add(-time.Minute)
+	before := r1.expires
+	c.add(r1)
+	r2 := newRecord("sid2")
+	r2.expires = time.Now().Add(-time.Second)
+	c.add(r2)
+
+	if got := c.get("sid1"); (r1 != got) || !r1.expires.After(before) {
+		t.Error("get() didn't extend the session's lifetime")
+	}
+	if nil != c.get("sid2") {
+		t.Error("get() returned expired session")
+	}
+	if _, ok := c.entries["sid2"]; ok {
+		t.Error("get() kept expired session")
+	}
+	if 1 != c.stats.Expired {
+		t.Errorf("Expired = %d, want %d", c.stats.Expired, 1)
+	}
+} // Test_tShCache_get()
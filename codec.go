@@ -0,0 +1,320 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the codecs used to encode/decode the session
+ * data when storing/loading session records.
+ */
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// TCodec selects the encoding of stored session data.
+	TCodec uint8
+)
+
+const (
+	// CodecGob encodes the session data using `encoding/gob`.
+	//
+	// It supports arbitrary types but requires each concrete type
+	// stored in a session to be registered by `gob.Register()`.
+	// This is the default.
+	CodecGob = TCodec(iota)
+
+	// CodecJSON encodes the session data as human-readable JSON.
+	//
+	// Each value is stored together with a type hint so that e.g.
+	// `time.Time`, `int32` and `float64` values come back with their
+	// original types. Only the types listed with `CodecBinary`
+	// are supported.
+	CodecJSON
+
+	// CodecBinary encodes the session data in a compact binary format.
+	//
+	// The supported types are `nil`, `bool`, `string`, `[]byte`,
+	// all integer and float types, `time.Time`, `time.Duration`,
+	// `[]string`, and `[]interface{}` and `map[string]interface{}`
+	// consisting of supported types.
+	CodecBinary
+)
+
+var (
+	// ErrUnsupportedValue is returned when a session value can't be
+	// encoded by the configured codec.
+	ErrUnsupportedValue = errors.New("sessions: unsupported session value")
+
+	// `soCodec` is the codec used to store session data
+	// (accessed atomically).
+	soCodec = int32(CodecGob)
+)
+
+// Codec returns the codec used to encode the stored session data.
+func Codec() TCodec {
+	return TCodec(atomic.LoadInt32(&soCodec))
+} // Codec()
+
+// SetCodec selects the codec used to encode the stored session data.
+//
+// Session files written with a different codec remain readable since
+// each file records the codec it was written with.
+//
+//	`aCodec` The codec to use for storing session data.
+func SetCodec(aCodec TCodec) error {
+	if CodecBinary < aCodec {
+		return fmt.Errorf("sessions: unknown codec %d", aCodec)
+	}
+	atomic.StoreInt32(&soCodec, int32(aCodec))
+
+	return nil
+} // SetCodec()
+
+// String returns the codec's name.
+//
+// Part of the `fmt.Stringer` interface.
+func (c TCodec) String() string {
+	switch c {
+	case CodecGob:
+		return "gob"
+	case CodecJSON:
+		return "json"
+	case CodecBinary:
+		return "binary"
+	}
+
+	return fmt.Sprintf("codec(%d)", uint8(c))
+} // String()
+
+// `copy()` returns a deep copy of `aData` by encoding and decoding it.
+//
+//	`aData` The session data to copy.
+func (c TCodec) copy(aData tSessionData) (tSessionData, error) {
+	buf, err := c.encode(aData)
+	if nil != err {
+		return nil, err
+	}
+
+	return c.decode(buf)
+} // copy()
+
+// `decode()` parses the encoded session data `aBuf`.
+//
+//	`aBuf` The encoded session data.
+func (c TCodec) decode(aBuf []byte) (tSessionData, error) {
+	switch c {
+	case CodecGob:
+		result := make(tSessionData)
+		err := gob.NewDecoder(bytes.NewReader(aBuf)).Decode(&result)
+
+		return result, err
+
+	case CodecJSON:
+		return jsonDecode(aBuf)
+
+	case CodecBinary:
+		return binDecode(aBuf)
+	}
+
+	return nil, fmt.Errorf("%w: unknown payload encoding %d", ErrBadRecord, c)
+} // decode()
+
+// `encode()` returns the encoded form of `aData`.
+//
+// If a value can't be encoded the returned error wraps
+// `ErrUnsupportedValue` and names the offending key and type.
+//
+//	`aData` The session data to encode.
+func (c TCodec) encode(aData tSessionData) (rBuf []byte, rErr error) {
+	switch c {
+	case CodecGob:
+		var buf bytes.Buffer
+		if rErr = gob.NewEncoder(&buf).Encode(aData); nil == rErr {
+			return buf.Bytes(), nil
+		}
+		// Find the culprit to produce a meaningful error message:
+		for _, key := range sortedKeys(aData) {
+			buf.Reset()
+			val := aData[key]
+			if err := gob.NewEncoder(&buf).Encode(tSessionData{key: val}); nil != err {
+				return nil, unsupportedValue(c, key, val, err)
+			}
+		}
+		return nil, rErr
+
+	case CodecJSON:
+		return jsonEncode(aData)
+
+	case CodecBinary:
+		return binEncode(aData)
+	}
+
+	return nil, fmt.Errorf("sessions: unknown codec %d", c)
+} // encode()
+
+// `sortedKeys()` returns the keys of `aData` in ascending order.
+//
+//	`aData` The session data whose keys to return.
+func sortedKeys(aData map[string]interface{}) []string {
+	result := make([]string, 0, len(aData))
+	for key := range aData {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+
+	return result
+} // sortedKeys()
+
+// `unsupportedValue()` returns an error describing a session value
+// that can't be encoded.
+//
+//	`aCodec` The codec that failed.
+//	`aKey` The session key of the offending value.
+//	`aValue` The offending value.
+//	`aErr` An optional error with details.
+func unsupportedValue(aCodec TCodec, aKey string, aValue interface{}, aErr error) error {
+	if nil == aErr {
+		return fmt.Errorf("%w: %q (%T) with codec %s",
+			ErrUnsupportedValue, aKey, aValue, aCodec)
+	}
+
+	return fmt.Errorf("%w: %q (%T) with codec %s: %v",
+		ErrUnsupportedValue, aKey, aValue, aCodec, aErr)
+} // unsupportedValue()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+const (
+	// Value types supported by `CodecJSON` and `CodecBinary`:
+	vtUnsupported = byte(iota)
+	vtNil
+	vtBool
+	vtString
+	vtBytes
+	vtInt
+	vtInt8
+	vtInt16
+	vtInt32
+	vtInt64
+	vtUint
+	vtUint8
+	vtUint16
+	vtUint32
+	vtUint64
+	vtFloat32
+	vtFloat64
+	vtTime
+	vtDuration
+	vtStrings
+	vtList
+	vtMap
+)
+
+var (
+	// `soValueTypeNames` are the type hints used by `CodecJSON`.
+	soValueTypeNames = [...]string{
+		vtUnsupported: "",
+		vtNil:         "nil",
+		vtBool:        "bool",
+		vtString:      "string",
+		vtBytes:       "bytes",
+		vtInt:         "int",
+		vtInt8:        "int8",
+		vtInt16:       "int16",
+		vtInt32:       "int32",
+		vtInt64:       "int64",
+		vtUint:        "uint",
+		vtUint8:       "uint8",
+		vtUint16:      "uint16",
+		vtUint32:      "uint32",
+		vtUint64:      "uint64",
+		vtFloat32:     "float32",
+		vtFloat64:     "float64",
+		vtTime:        "time",
+		vtDuration:    "duration",
+		vtStrings:     "strings",
+		vtList:        "list",
+		vtMap:         "map",
+	}
+)
+
+// `valueType()` returns the type tag of `aValue`.
+//
+// Container values (lists and maps) are not checked recursively.
+//
+//	`aValue` The value to examine.
+func valueType(aValue interface{}) byte {
+	switch aValue.(type) {
+	case nil:
+		return vtNil
+	case bool:
+		return vtBool
+	case string:
+		return vtString
+	case []byte:
+		return vtBytes
+	case int:
+		return vtInt
+	case int8:
+		return vtInt8
+	case int16:
+		return vtInt16
+	case int32:
+		return vtInt32
+	case int64:
+		return vtInt64
+	case uint:
+		return vtUint
+	case uint8:
+		return vtUint8
+	case uint16:
+		return vtUint16
+	case uint32:
+		return vtUint32
+	case uint64:
+		return vtUint64
+	case float32:
+		return vtFloat32
+	case float64:
+		return vtFloat64
+	case time.Time:
+		return vtTime
+	case time.Duration:
+		return vtDuration
+	case []string:
+		return vtStrings
+	case []interface{}:
+		return vtList
+	case map[string]interface{}, tSessionData:
+		return vtMap
+	}
+
+	return vtUnsupported
+} // valueType()
+
+// `valueTypeByName()` returns the type tag of the type hint `aName`.
+//
+//	`aName` The type hint to look up.
+func valueTypeByName(aName string) byte {
+	for vt, name := range soValueTypeNames {
+		if (0 < vt) && (name == aName) {
+			return byte(vt)
+		}
+	}
+
+	return vtUnsupported
+} // valueTypeByName()
+
+/* _EoF_ */
@@ -0,0 +1,337 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the compact binary codec for session data.
+ *
+ * The encoded data is a (uvarint) count of entries followed by the
+ * entries themselves, each consisting of the (uvarint) length of the
+ * key, the key, and the value.
+ * A value is a type tag byte followed by the type specific data:
+ * signed integers and durations as varint, unsigned integers as
+ * uvarint, floats as their IEEE 754 bits, strings and byte slices
+ * with a (uvarint) length prefix, and times in the format produced
+ * by `time.Time.MarshalBinary()` (again length prefixed).
+ * Lists and maps are encoded recursively.
+ */
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+type (
+	// `tBinReader` is a simple cursor reading the binary encoding.
+	tBinReader struct {
+		buf []byte
+		err error
+	}
+)
+
+// `binDecode()` parses the binary encoded session data `aBuf`.
+//
+//	`aBuf` The encoded session data.
+func binDecode(aBuf []byte) (tSessionData, error) {
+	br := &tBinReader{buf: aBuf}
+	result := br.readMap()
+	if nil != br.err {
+		return nil, br.err
+	}
+	if 0 < len(br.buf) {
+		return nil, fmt.Errorf("%w: trailing data", ErrBadRecord)
+	}
+
+	return result, nil
+} // binDecode()
+
+// `binEncode()` returns the binary encoded form of `aData`.
+//
+//	`aData` The session data to encode.
+func binEncode(aData map[string]interface{}) ([]byte, error) {
+	return binAppendMap(make([]byte, 0, 64*len(aData)+8), aData)
+} // binEncode()
+
+// `binAppendMap()` appends the binary encoded `aData` to `aBuf`.
+//
+// The map entries are written in sorted order to produce a stable
+// encoding.
+//
+//	`aBuf` The buffer to append to.
+//	`aData` The map to encode.
+func binAppendMap(aBuf []byte, aData map[string]interface{}) ([]byte, error) {
+	var err error
+	aBuf = appendUvarint(aBuf, uint64(len(aData)))
+	for _, key := range sortedKeys(aData) {
+		val := aData[key]
+		aBuf = appendUvarint(aBuf, uint64(len(key)))
+		aBuf = append(aBuf, key...)
+		if aBuf, err = binAppendValue(aBuf, val); nil != err {
+			return nil, unsupportedValue(CodecBinary, key, val, err)
+		}
+	}
+
+	return aBuf, nil
+} // binAppendMap()
+
+// `binAppendValue()` appends the binary encoded `aValue` to `aBuf`.
+//
+//	`aBuf` The buffer to append to.
+//	`aValue` The value to encode.
+func binAppendValue(aBuf []byte, aValue interface{}) ([]byte, error) {
+	vt := valueType(aValue)
+	if vtUnsupported == vt {
+		return nil, fmt.Errorf("type %T", aValue)
+	}
+	aBuf = append(aBuf, vt)
+
+	switch v := aValue.(type) {
+	case nil:
+		// the tag says it all
+	case bool:
+		if v {
+			aBuf = append(aBuf, 1)
+		} else {
+			aBuf = append(aBuf, 0)
+		}
+	case string:
+		aBuf = appendUvarint(aBuf, uint64(len(v)))
+		aBuf = append(aBuf, v...)
+	case []byte:
+		aBuf = appendUvarint(aBuf, uint64(len(v)))
+		aBuf = append(aBuf, v...)
+	case int:
+		aBuf = appendVarint(aBuf, int64(v))
+	case int8:
+		aBuf = appendVarint(aBuf, int64(v))
+	case int16:
+		aBuf = appendVarint(aBuf, int64(v))
+	case int32:
+		aBuf = appendVarint(aBuf, int64(v))
+	case int64:
+		aBuf = appendVarint(aBuf, v)
+	case uint:
+		aBuf = appendUvarint(aBuf, uint64(v))
+	case uint8:
+		aBuf = appendUvarint(aBuf, uint64(v))
+	case uint16:
+		aBuf = appendUvarint(aBuf, uint64(v))
+	case uint32:
+		aBuf = appendUvarint(aBuf, uint64(v))
+	case uint64:
+		aBuf = appendUvarint(aBuf, v)
+	case float32:
+		aBuf = appendUint32(aBuf, math.Float32bits(v))
+	case float64:
+		aBuf = appendUint64(aBuf, math.Float64bits(v))
+	case time.Time:
+		tb, err := v.MarshalBinary()
+		if nil != err {
+			return nil, err
+		}
+		aBuf = appendUvarint(aBuf, uint64(len(tb)))
+		aBuf = append(aBuf, tb...)
+	case time.Duration:
+		aBuf = appendVarint(aBuf, int64(v))
+	case []string:
+		aBuf = appendUvarint(aBuf, uint64(len(v)))
+		for _, s := range v {
+			aBuf = appendUvarint(aBuf, uint64(len(s)))
+			aBuf = append(aBuf, s...)
+		}
+	case []interface{}:
+		var err error
+		aBuf = appendUvarint(aBuf, uint64(len(v)))
+		for _, val := range v {
+			if aBuf, err = binAppendValue(aBuf, val); nil != err {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		return binAppendMap(aBuf, v)
+	case tSessionData:
+		return binAppendMap(aBuf, v)
+	}
+
+	return aBuf, nil
+} // binAppendValue()
+
+// `appendUvarint()` appends `aVal` as unsigned varint to `aBuf`.
+//
+//	`aBuf` The buffer to append to.
+//	`aVal` The value to encode.
+func appendUvarint(aBuf []byte, aVal uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+
+	return append(aBuf, b[:binary.PutUvarint(b[:], aVal)]...)
+} // appendUvarint()
+
+// `appendVarint()` appends `aVal` as signed varint to `aBuf`.
+//
+//	`aBuf` The buffer to append to.
+//	`aVal` The value to encode.
+func appendVarint(aBuf []byte, aVal int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+
+	return append(aBuf, b[:binary.PutVarint(b[:], aVal)]...)
+} // appendVarint()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `fail()` records `aErr` as the first error encountered.
+//
+//	`aErr` The error to record.
+func (br *tBinReader) fail(aErr error) {
+	if nil == br.err {
+		br.err = aErr
+	}
+	br.buf = nil
+} // fail()
+
+// `readBytes()` returns the next `aLen` bytes.
+//
+//	`aLen` The number of bytes to read.
+func (br *tBinReader) readBytes(aLen uint64) []byte {
+	if uint64(len(br.buf)) < aLen {
+		br.fail(fmt.Errorf("%w: unexpected end of data", ErrBadRecord))
+		return nil
+	}
+	result := br.buf[:aLen]
+	br.buf = br.buf[aLen:]
+
+	return result
+} // readBytes()
+
+// `readMap()` reads a map of session values.
+func (br *tBinReader) readMap() tSessionData {
+	count := br.readUvarint()
+	if uint64(len(br.buf)) < count { // each entry needs at least 2 bytes
+		br.fail(fmt.Errorf("%w: bad map size", ErrBadRecord))
+		return nil
+	}
+	result := make(tSessionData, count)
+	for ; (0 < count) && (nil == br.err); count-- {
+		key := string(br.readBytes(br.readUvarint()))
+		result[key] = br.readValue()
+	}
+
+	return result
+} // readMap()
+
+// `readUvarint()` reads an unsigned varint.
+func (br *tBinReader) readUvarint() uint64 {
+	result, n := binary.Uvarint(br.buf)
+	if 0 >= n {
+		br.fail(fmt.Errorf("%w: bad uvarint", ErrBadRecord))
+		return 0
+	}
+	br.buf = br.buf[n:]
+
+	return result
+} // readUvarint()
+
+// `readValue()` reads a single tagged value.
+func (br *tBinReader) readValue() interface{} {
+	tag := br.readBytes(1)
+	if nil == tag {
+		return nil
+	}
+
+	switch vt := tag[0]; vt {
+	case vtNil:
+		return nil
+
+	case vtBool:
+		if b := br.readBytes(1); nil != b {
+			return 0 != b[0]
+		}
+
+	case vtString:
+		return string(br.readBytes(br.readUvarint()))
+
+	case vtBytes:
+		b := br.readBytes(br.readUvarint())
+		return append([]byte{}, b...)
+
+	case vtInt, vtInt8, vtInt16, vtInt32, vtInt64:
+		return narrowInt(vt, br.readVarint())
+
+	case vtUint, vtUint8, vtUint16, vtUint32, vtUint64:
+		return narrowUint(vt, br.readUvarint())
+
+	case vtFloat32:
+		if b := br.readBytes(4); nil != b {
+			return math.Float32frombits(binary.BigEndian.Uint32(b))
+		}
+
+	case vtFloat64:
+		if b := br.readBytes(8); nil != b {
+			return math.Float64frombits(binary.BigEndian.Uint64(b))
+		}
+
+	case vtTime:
+		var t time.Time
+		if b := br.readBytes(br.readUvarint()); nil != b {
+			if err := t.UnmarshalBinary(b); nil != err {
+				br.fail(fmt.Errorf("%w: %v", ErrBadRecord, err))
+			}
+		}
+		return t
+
+	case vtDuration:
+		return time.Duration(br.readVarint())
+
+	case vtStrings:
+		count := br.readUvarint()
+		if uint64(len(br.buf)) < count {
+			br.fail(fmt.Errorf("%w: bad list size", ErrBadRecord))
+			return nil
+		}
+		result := make([]string, 0, count)
+		for ; (0 < count) && (nil == br.err); count-- {
+			result = append(result, string(br.readBytes(br.readUvarint())))
+		}
+		return result
+
+	case vtList:
+		count := br.readUvarint()
+		if uint64(len(br.buf)) < count {
+			br.fail(fmt.Errorf("%w: bad list size", ErrBadRecord))
+			return nil
+		}
+		result := make([]interface{}, 0, count)
+		for ; (0 < count) && (nil == br.err); count-- {
+			result = append(result, br.readValue())
+		}
+		return result
+
+	case vtMap:
+		return map[string]interface{}(br.readMap())
+
+	default:
+		br.fail(fmt.Errorf("%w: unknown value type %d", ErrBadRecord, vt))
+	}
+
+	return nil
+} // readValue()
+
+// `readVarint()` reads a signed varint.
+func (br *tBinReader) readVarint() int64 {
+	result, n := binary.Varint(br.buf)
+	if 0 >= n {
+		br.fail(fmt.Errorf("%w: bad varint", ErrBadRecord))
+		return 0
+	}
+	br.buf = br.buf[n:]
+
+	return result
+} // readVarint()
+
+/* _EoF_ */
@@ -0,0 +1,298 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the JSON codec for session data.
+ *
+ * Each session value is stored as an object holding a type hint
+ * and the actual value, e.g.
+ *
+ *	{"Zahl":{"t":"int","v":123456789},"Datum":{"t":"time","v":"2025-…"}}
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+type (
+	// `tJSONValue` is a session value with its type hint.
+	tJSONValue struct {
+		T string          `json:"t"`
+		V json.RawMessage `json:"v,omitempty"`
+	}
+)
+
+// `jsonDecode()` parses the JSON encoded session data `aBuf`.
+//
+//	`aBuf` The encoded session data.
+func jsonDecode(aBuf []byte) (tSessionData, error) {
+	var list map[string]tJSONValue
+	if err := json.Unmarshal(aBuf, &list); nil != err {
+		return nil, err
+	}
+	result := make(tSessionData, len(list))
+	for key, jv := range list {
+		val, err := jsonDecodeValue(jv)
+		if nil != err {
+			return nil, fmt.Errorf("%q: %w", key, err)
+		}
+		result[key] = val
+	}
+
+	return result, nil
+} // jsonDecode()
+
+// `jsonDecodeValue()` returns the Go value of `aValue`.
+//
+//	`aValue` The type-hinted JSON value.
+func jsonDecodeValue(aValue tJSONValue) (interface{}, error) {
+	var err error
+	switch valueTypeByName(aValue.T) {
+	case vtNil:
+		return nil, nil
+
+	case vtBool:
+		var b bool
+		err = json.Unmarshal(aValue.V, &b)
+		return b, err
+
+	case vtString:
+		var s string
+		err = json.Unmarshal(aValue.V, &s)
+		return s, err
+
+	case vtBytes:
+		var b []byte
+		err = json.Unmarshal(aValue.V, &b)
+		return b, err
+
+	case vtInt, vtInt8, vtInt16, vtInt32, vtInt64:
+		var i int64
+		if err = json.Unmarshal(aValue.V, &i); nil != err {
+			return nil, err
+		}
+		return narrowInt(valueTypeByName(aValue.T), i), nil
+
+	case vtUint, vtUint8, vtUint16, vtUint32, vtUint64:
+		var u uint64
+		if err = json.Unmarshal(aValue.V, &u); nil != err {
+			return nil, err
+		}
+		return narrowUint(valueTypeByName(aValue.T), u), nil
+
+	case vtFloat32, vtFloat64:
+		f, err := jsonDecodeFloat(aValue.V)
+		if nil != err {
+			return nil, err
+		}
+		if vtFloat32 == valueTypeByName(aValue.T) {
+			return float32(f), nil
+		}
+		return f, nil
+
+	case vtTime:
+		var t time.Time
+		err = json.Unmarshal(aValue.V, &t)
+		return t, err
+
+	case vtDuration:
+		var d int64
+		err = json.Unmarshal(aValue.V, &d)
+		return time.Duration(d), err
+
+	case vtStrings:
+		var list []string
+		err = json.Unmarshal(aValue.V, &list)
+		return list, err
+
+	case vtList:
+		var list []tJSONValue
+		if err = json.Unmarshal(aValue.V, &list); nil != err {
+			return nil, err
+		}
+		result := make([]interface{}, len(list))
+		for idx, jv := range list {
+			if result[idx], err = jsonDecodeValue(jv); nil != err {
+				return nil, err
+			}
+		}
+		return result, nil
+
+	case vtMap:
+		m, err := jsonDecode(aValue.V)
+		if nil != err {
+			return nil, err
+		}
+		return map[string]interface{}(m), nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown type hint %q", ErrBadRecord, aValue.T)
+} // jsonDecodeValue()
+
+// `jsonDecodeFloat()` parses a float value which is either a JSON
+// number or – for values not representable as such – a string.
+//
+//	`aRaw` The raw JSON value.
+func jsonDecodeFloat(aRaw json.RawMessage) (float64, error) {
+	if (0 < len(aRaw)) && ('"' == aRaw[0]) {
+		var s string
+		if err := json.Unmarshal(aRaw, &s); nil != err {
+			return 0, err
+		}
+		return strconv.ParseFloat(s, 64)
+	}
+	var f float64
+	err := json.Unmarshal(aRaw, &f)
+
+	return f, err
+} // jsonDecodeFloat()
+
+// `jsonEncode()` returns the JSON encoded form of `aData`.
+//
+//	`aData` The session data to encode.
+func jsonEncode(aData map[string]interface{}) ([]byte, error) {
+	list, err := jsonEncodeMap(aData)
+	if nil != err {
+		return nil, err
+	}
+
+	return json.Marshal(list)
+} // jsonEncode()
+
+// `jsonEncodeMap()` returns the type-hinted values of `aData`.
+//
+//	`aData` The session data to encode.
+func jsonEncodeMap(aData map[string]interface{}) (map[string]tJSONValue, error) {
+	result := make(map[string]tJSONValue, len(aData))
+	for key, val := range aData {
+		jv, err := jsonEncodeValue(val)
+		if nil != err {
+			return nil, unsupportedValue(CodecJSON, key, val, err)
+		}
+		result[key] = jv
+	}
+
+	return result, nil
+} // jsonEncodeMap()
+
+// `jsonEncodeValue()` returns `aValue` along with its type hint.
+//
+//	`aValue` The session value to encode.
+func jsonEncodeValue(aValue interface{}) (rValue tJSONValue, rErr error) {
+	vt := valueType(aValue)
+	rValue.T = soValueTypeNames[vt]
+
+	var v interface{}
+	switch vt {
+	case vtUnsupported:
+		return rValue, fmt.Errorf("type %T", aValue)
+
+	case vtNil:
+		return
+
+	case vtFloat32, vtFloat64:
+		f, _ := toFloat64(aValue)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			v = strconv.FormatFloat(f, 'g', -1, 64)
+		} else {
+			v = f
+		}
+
+	case vtDuration:
+		v = int64(aValue.(time.Duration))
+
+	case vtList:
+		list := aValue.([]interface{})
+		jl := make([]tJSONValue, len(list))
+		for idx, val := range list {
+			if jl[idx], rErr = jsonEncodeValue(val); nil != rErr {
+				return
+			}
+		}
+		v = jl
+
+	case vtMap:
+		var m map[string]tJSONValue
+		if sd, ok := aValue.(tSessionData); ok {
+			m, rErr = jsonEncodeMap(sd)
+		} else {
+			m, rErr = jsonEncodeMap(aValue.(map[string]interface{}))
+		}
+		if nil != rErr {
+			return
+		}
+		v = m
+
+	default:
+		v = aValue
+	}
+	rValue.V, rErr = json.Marshal(v)
+
+	return
+} // jsonEncodeValue()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `narrowInt()` converts `aInt` to the signed integer type `aType`.
+//
+//	`aType` The type tag of the wanted type.
+//	`aInt` The value to convert.
+func narrowInt(aType byte, aInt int64) interface{} {
+	switch aType {
+	case vtInt:
+		return int(aInt)
+	case vtInt8:
+		return int8(aInt)
+	case vtInt16:
+		return int16(aInt)
+	case vtInt32:
+		return int32(aInt)
+	}
+
+	return aInt
+} // narrowInt()
+
+// `narrowUint()` converts `aUint` to the unsigned integer type `aType`.
+//
+//	`aType` The type tag of the wanted type.
+//	`aUint` The value to convert.
+func narrowUint(aType byte, aUint uint64) interface{} {
+	switch aType {
+	case vtUint:
+		return uint(aUint)
+	case vtUint8:
+		return uint8(aUint)
+	case vtUint16:
+		return uint16(aUint)
+	case vtUint32:
+		return uint32(aUint)
+	}
+
+	return aUint
+} // narrowUint()
+
+// `toFloat64()` returns the float value `aValue` as `float64`.
+//
+//	`aValue` The value to convert.
+func toFloat64(aValue interface{}) (float64, bool) {
+	switch f := aValue.(type) {
+	case float64:
+		return f, true
+	case float32:
+		return float64(f), true
+	}
+
+	return 0, false
+} // toFloat64()
+
+/* _EoF_ */
@@ -0,0 +1,129 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type tCodecTestStruct struct {
+	Name string
+}
+
+func codecTestData() tSessionData {
+	return tSessionData{
+		"Bytes":        []byte("some bytes"),
+		"Datum":        time.Date(2025, 3, 24, 12, 34, 56, 789, time.UTC),
+		"Dauer":        90 * time.Second,
+		"Int8":         int8(-8),
+		"Int32":        int32(-32),
+		"Int64":        int64(math.MinInt64),
+		"Nichts":       nil,
+		"Real":         12345.6789,
+		"Real32":       float32(1.5),
+		"Uint":         uint(7),
+		"Uint64":       uint64(math.MaxUint64),
+		"Wahr":         true,
+		"Zahl":         123456789,
+		"Zeichenkette": "eine Zeichenkette",
+		"Zeichen":      []string{"a", "b"},
+		"Liste":        []interface{}{1, "zwei", 3.0},
+		"Karte":        map[string]interface{}{"a": int16(1), "b": []interface{}{false}},
+	}
+} // codecTestData()
+
+func TestTCodec_roundtrip(t *testing.T) {
+	data := codecTestData()
+	tests := []struct {
+		name  string
+		codec TCodec
+		data  tSessionData
+	}{
+		{" 1", CodecGob, tSessionData{"Zahl": 123456789, "Datum": time.Now().Round(0)}},
+		{" 2", CodecJSON, data},
+		{" 3", CodecBinary, data},
+		{" 4", CodecJSON, tSessionData{"NaN": math.Inf(-1)}},
+		{" 5", CodecBinary, tSessionData{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := tt.codec.encode(tt.data)
+			if nil != err {
+				t.Fatalf("%s.encode() error = %v", tt.codec, err)
+			}
+			got, err := tt.codec.decode(buf)
+			if nil != err {
+				t.Fatalf("%s.decode() error = %v", tt.codec, err)
+			}
+			for key, want := range tt.data {
+				val := got[key]
+				if wt, ok := want.(time.Time); ok {
+					if gt, ok := val.(time.Time); !ok || !gt.Equal(wt) {
+						t.Errorf("%s: %q = %v, want %v", tt.codec, key, val, want)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(val, want) {
+					t.Errorf("%s: %q = %#v, want %#v", tt.codec, key, val, want)
+				}
+			}
+			if len(got) != len(tt.data) {
+				t.Errorf("%s: len = %d, want %d", tt.codec, len(got), len(tt.data))
+			}
+		})
+	}
+} // TestTCodec_roundtrip()
+
+func TestTCodec_encodeError(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec TCodec
+		data  tSessionData
+	}{
+		{" 1", CodecGob, tSessionData{"ok": 1, "bad": tCodecTestStruct{"x"}}},
+		{" 2", CodecJSON, tSessionData{"ok": 1, "bad": tCodecTestStruct{"x"}}},
+		{" 3", CodecBinary, tSessionData{"ok": 1, "bad": tCodecTestStruct{"x"}}},
+		{" 4", CodecBinary, tSessionData{"bad": []interface{}{func() {}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.codec.encode(tt.data)
+			if !errors.Is(err, ErrUnsupportedValue) {
+				t.Fatalf("%s.encode() error = %v, want %v", tt.codec, err, ErrUnsupportedValue)
+			}
+		})
+	}
+} // TestTCodec_encodeError()
+
+func TestSetCodec(t *testing.T) {
+	defer SetCodec(CodecGob)
+	sdir := t.TempDir()
+	store := &TFileStore{dir: sdir}
+	rec := newRecord("aTestSID")
+	rec.data["Zahl"] = 123456789
+
+	for _, codec := range []TCodec{CodecJSON, CodecBinary, CodecGob} {
+		if err := SetCodec(codec); nil != err {
+			t.Fatalf("SetCodec(%s) error = %v", codec, err)
+		}
+		goStore(store, rec.clone())
+		if got := Codec(); got != codec {
+			t.Errorf("Codec() = %v, want %v", got, codec)
+		}
+		// files are readable with whatever codec is configured
+		SetCodec(CodecGob)
+		if got := loadSession(store, rec.sID); !reflect.DeepEqual(got.data, rec.data) {
+			t.Errorf("%s: loadSession() = %v, want %v", codec, got.data, rec.data)
+		}
+	}
+	if err := SetCodec(CodecBinary + 1); nil == err {
+		t.Errorf("SetCodec() expected error")
+	}
+} // TestSetCodec()
@@ -0,0 +1,128 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the optional compression of stored session data.
+ */
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+)
+
+type (
+	// `tCompression` holds the compression settings (which are
+	// replaced as a whole).
+	tCompression struct {
+		level     int // the `flate` level; `flate.NoCompression`: off
+		threshold int // the size below which compression is skipped
+	}
+)
+
+var (
+	// `soCompression` holds the current `tCompression` settings.
+	soCompression atomic.Value
+
+	// `soDecompressMax` is the max. size of decompressed session data;
+	// larger data are rejected as malformed.
+	soDecompressMax = int64(64 << 20)
+)
+
+// Compression returns the current compression level and threshold.
+func Compression() (rLevel, rThreshold int) {
+	settings, ok := soCompression.Load().(tCompression)
+	if !ok { // not set yet
+		return flate.NoCompression, 512
+	}
+
+	return settings.level, settings.threshold
+} // Compression()
+
+// SetCompression enables the compression of stored session data.
+//
+// Compression is applied only to session data whose encoded size is
+// at least `aThreshold` bytes and only if it actually saves space.
+// Since each session file records whether its data is compressed
+// files stored with and without compression can be mixed freely.
+// Passing `flate.NoCompression` as `aLevel` disables compression.
+//
+//	`aLevel` The `compress/flate` level to use.
+//	`aThreshold` The minimum size (in bytes) of data to compress.
+func SetCompression(aLevel, aThreshold int) error {
+	if (flate.HuffmanOnly > aLevel) || (flate.BestCompression < aLevel) {
+		return fmt.Errorf("sessions: invalid compression level %d", aLevel)
+	}
+	if 0 > aThreshold {
+		aThreshold = 0
+	} else if math.MaxInt32 < aThreshold {
+		aThreshold = math.MaxInt32
+	}
+	soCompression.Store(tCompression{
+		level:     aLevel,
+		threshold: aThreshold,
+	})
+
+	return nil
+} // SetCompression()
+
+// `compress()` returns the compressed `aData`.
+//
+// The second return value signals whether compression was applied;
+// if it's `false` the data is returned unchanged.
+//
+//	`aData` The data to compress.
+func compress(aData []byte) ([]byte, bool) {
+	level, threshold := Compression()
+	if (flate.NoCompression == level) || (threshold > len(aData)) {
+		return aData, false
+	}
+
+	var buf bytes.Buffer
+	zw, err := flate.NewWriter(&buf, level)
+	if nil != err {
+		return aData, false
+	}
+	if _, err = zw.Write(aData); nil == err {
+		err = zw.Close()
+	}
+	if (nil != err) || (buf.Len() >= len(aData)) {
+		return aData, false // not worth it
+	}
+
+	return buf.Bytes(), true
+} // compress()
+
+// `decompress()` returns the uncompressed `aData`.
+//
+// Data which would decompress to more than `soDecompressMax` bytes
+// are rejected (to not be exhausted by a manipulated record).
+//
+//	`aData` The compressed data.
+func decompress(aData []byte) ([]byte, error) {
+	zr := flate.NewReader(bytes.NewReader(aData))
+	defer zr.Close()
+
+	limit := soDecompressMax
+	result, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if nil != err {
+		return nil, fmt.Errorf("%w: %v", ErrBadRecord, err)
+	}
+	if limit < int64(len(result)) {
+		return nil, fmt.Errorf("%w: decompressed data exceed %d bytes",
+			ErrBadRecord, limit)
+	}
+
+	return result, nil
+} // decompress()
+
+/* _EoF_ */
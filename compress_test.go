@@ -0,0 +1,146 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSetCompression(t *testing.T) {
+	defer SetCompression(flate.NoCompression, 512)
+	tests := []struct {
+		name    string
+		level   int
+		wantErr bool
+	}{
+		{" 1", flate.NoCompression, false},
+		{" 2", flate.BestSpeed, false},
+		{" 3", flate.DefaultCompression, false},
+		{" 4", flate.HuffmanOnly, false},
+		{" 5", flate.BestCompression + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SetCompression(tt.level, 100)
+			if (nil != err) != tt.wantErr {
+				t.Errorf("SetCompression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+} // TestSetCompression()
+
+func TestCompression_consistent(t *testing.T) {
+	defer SetCompression(flate.NoCompression, 512)
+	var wg sync.WaitGroup
+	for w := 0; 4 > w; w++ {
+		wg.Add(1)
+		go func(aLevel int) {
+			defer wg.Done()
+			for i := 0; 200 > i; i++ {
+				_ = SetCompression(aLevel, aLevel*100)
+				if level, threshold := Compression(); level*100 != threshold {
+					t.Errorf("Compression() = %d, %d: mixed settings", level, threshold)
+					return
+				}
+			}
+		}(w + 1)
+	}
+	wg.Wait()
+} // TestCompression_consistent()
+
+func Test_compress(t *testing.T) {
+	defer SetCompression(flate.NoCompression, 512)
+	SetCompression(flate.DefaultCompression, 64)
+	long := bytes.Repeat([]byte("eine Zeichenkette "), 32)
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{" 1", long, true},
+		{" 2", long[:32], false}, // below threshold
+		{" 3", []byte("\x00\x8f\x13\xa7\x42\x99\x01\xfe\x3c\x77\x10\x21\xee\x5d\x6b\x80" +
+			"\x91\x04\xc3\x5a\x2e\xd8\x7f\x0b\x66\xb1\x18\x4d\xf2\x39\xa4\x57" +
+			"\x0e\x83\xcd\x62\x1f\xba\x95\x48\x2c\xe7\x73\x06\xd1\x3a\x8c\x5f" +
+			"\x14\x69\xab\x22\xfc\x40\x97\x0d\xb6\x7a\x31\xc8\x55\x1e\xe3\x8a"), false}, // incompressible
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := compress(tt.data)
+			if ok != tt.want {
+				t.Fatalf("compress() = %v, want %v", ok, tt.want)
+			}
+			if !ok {
+				return
+			}
+			plain, err := decompress(got)
+			if nil != err {
+				t.Fatalf("decompress() error = %v", err)
+			}
+			if !bytes.Equal(plain, tt.data) {
+				t.Errorf("decompress() = %q, want %q", plain, tt.data)
+			}
+		})
+	}
+} // Test_compress()
+
+func Test_decompress_limit(t *testing.T) {
+	defer SetCompression(flate.NoCompression, 512)
+	defer func(aMax int64) { soDecompressMax = aMax }(soDecompressMax)
+	SetCompression(flate.DefaultCompression, 0)
+	soDecompressMax = 1024
+
+	fits, _ := compress(make([]byte, 1024))
+	if plain, err := decompress(fits); (nil != err) || (1024 != len(plain)) {
+		t.Errorf("decompress() = %d bytes, %v, want %d bytes", len(plain), err, 1024)
+	}
+	bomb, _ := compress(make([]byte, 1025))
+	if _, err := decompress(bomb); !errors.Is(err, ErrBadRecord) {
+		t.Errorf("decompress() error = %v, want %v", err, ErrBadRecord)
+	}
+} // Test_decompress_limit()
+
+func TestCompression_mixed(t *testing.T) {
+	defer SetCompression(flate.NoCompression, 512)
+	defer SetKeyRing(nil, false)
+	sdir := t.TempDir()
+	store := &TFileStore{dir: sdir}
+	big := newRecord("aBigSID")
+	big.data["Zeichenkette"] = strings.Repeat("eine Zeichenkette ", 100)
+	small := newRecord("aSmallSID")
+	small.data["Zahl"] = 123456789
+	plain := newRecord("aPlainSID")
+	plain.data["Zeichenkette"] = strings.Repeat("eine Zeichenkette ", 100)
+
+	goStore(store, plain.clone()) // stored before compression is enabled
+	SetCompression(flate.BestCompression, 256)
+	kr, _ := NewKeyRing(1, make([]byte, 16))
+	SetKeyRing(kr, true) // the plain session is read as well
+	goStore(store, big.clone())
+	goStore(store, small.clone())
+
+	buf, _ := os.ReadFile(filepath.Join(sdir, "aBigSID.sid"))
+	if 0 == buf[5]&sfFlagCompressed {
+		t.Errorf("big session not compressed")
+	}
+	buf, _ = os.ReadFile(filepath.Join(sdir, "aSmallSID.sid"))
+	if 0 != buf[5]&sfFlagCompressed {
+		t.Errorf("small session compressed")
+	}
+	for _, rec := range []*tSessionRecord{big, small, plain} {
+		if got := loadSession(store, rec.sID); !reflect.DeepEqual(got.data, rec.data) {
+			t.Errorf("loadSession(%q) = %v, want %v", rec.sID, got.data, rec.data)
+		}
+	}
+} // TestCompression_mixed()
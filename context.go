@@ -0,0 +1,190 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the context-aware session operations.
+ *
+ * The `XxxCtx()` methods give up waiting for the session engine when
+ * their context is cancelled (or its deadline passes) and return the
+ * context's error; hence a stuck engine (e.g. a slow disk) can't hang
+ * the HTTP handlers.
+ *
+ * Note that a request already handed to the engine may still be
+ * carried out after the caller gave up waiting for it.
+ */
+
+import (
+	"context"
+	"time"
+)
+
+// DeleteCtx removes the session data identified by `aKey`.
+//
+// If `aCtx` is done before the engine answers, the context's error is
+// returned (the value may get deleted nevertheless).
+//
+//	`aCtx` The context bounding the operation.
+//	`aKey` The identifier to lookup.
+func (so *TSession) DeleteCtx(aCtx context.Context, aKey string) error {
+	_, err := so.requestCtx(aCtx, smDeleteKey, aKey, nil)
+
+	return err
+} // DeleteCtx()
+
+// DestroyCtx destroys the session.
+//
+// If `aCtx` is done before the engine answers, the context's error is
+// returned (the session may get destroyed nevertheless).
+//
+//	`aCtx` The context bounding the operation.
+func (so *TSession) DestroyCtx(aCtx context.Context) error {
+	if _, err := so.requestCtx(aCtx, smDestroySession, "", nil); nil != err {
+		return err
+	}
+	so.sID = ""
+
+	return nil
+} // DestroyCtx()
+
+// ExpiresCtx returns the time when the session expires (unless it's
+// accessed again before).
+//
+// If `aCtx` is done before the engine answers, a zero time and the
+// context's error are returned.
+//
+//	`aCtx` The context bounding the operation.
+func (so *TSession) ExpiresCtx(aCtx context.Context) (rTime time.Time, rErr error) {
+	result, err := so.requestCtx(aCtx, smExpires, "", nil)
+	if nil != err {
+		return rTime, err
+	}
+	rTime, _ = result.sValue.(time.Time)
+
+	return
+} // ExpiresCtx()
+
+// GetCtx returns the session data identified by `aKey`.
+//
+// If `aKey` doesn't exist the method returns `nil`.
+// If `aCtx` is done before the engine answers, `nil` and the context's
+// error are returned.
+// With the `CopyDeep` policy (see `SetCopyPolicy()`) a copy of the
+// stored value is returned.
+//
+//	`aCtx` The context bounding the operation.
+//	`aKey` The identifier to lookup.
+func (so *TSession) GetCtx(aCtx context.Context, aKey string) (interface{}, error) {
+	result, err := so.requestCtx(aCtx, smGetKey, aKey, nil)
+	if nil != err {
+		return nil, err
+	}
+
+	return copyOut(aKey, result.sValue), nil
+} // GetCtx()
+
+// LenCtx returns the current length of the list of session variables.
+//
+// If `aCtx` is done before the engine answers, zero and the context's
+// error are returned.
+//
+//	`aCtx` The context bounding the operation.
+func (so *TSession) LenCtx(aCtx context.Context) (int, error) {
+	result, err := so.requestCtx(aCtx, smSessionLen, "", nil)
+	if nil != err {
+		return 0, err
+	}
+	rLen, _ := result.sValue.(int)
+
+	return rLen, nil
+} // LenCtx()
+
+// `requestCtx()` queries the session engine for certain data giving
+// up when `aCtx` is done.
+//
+//	`aCtx` The context bounding the request.
+//	`aType` The lookup type.
+//	`aKey` Optional session variable name/key.
+//	`aValue` Optional session variable value.
+func (so *TSession) requestCtx(aCtx context.Context, aType tShLookupType, aKey string, aValue interface{}) (*TSession, error) {
+	if err := aCtx.Err(); nil != err {
+		return nil, err
+	}
+
+	return soEngine.requestCtx(aCtx, tShRequest{
+		rKey:   aKey,
+		rSID:   so.sID,
+		rType:  aType,
+		rValue: aValue,
+	})
+} // requestCtx()
+
+// `runCtx()` runs `aFunc` in the background waiting for it to finish
+// until `aCtx` is done.
+//
+// Unlike with `requestCtx()` the work is always done completely: if
+// the caller gave up waiting, `aAbandoned` (if not `nil`) is called
+// once `aFunc` returned, hence the session handled there can be
+// finished properly.
+//
+//	`aCtx` The context bounding the wait.
+//	`aFunc` The work to do.
+//	`aAbandoned` Optional function to call after an abandoned `aFunc`.
+func runCtx(aCtx context.Context, aFunc, aAbandoned func()) error {
+	if err := aCtx.Err(); nil != err {
+		return err
+	}
+	done := make(chan struct{})      // unbuffered: the hand-over
+	abandoned := make(chan struct{}) // closed when giving up
+
+	go func() {
+		aFunc()
+		select {
+		case done <- struct{}{}:
+		case <-abandoned:
+			if nil != aAbandoned {
+				aAbandoned()
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-aCtx.Done():
+		close(abandoned)
+		return aCtx.Err()
+	}
+} // runCtx()
+
+// SetCtx adds/updates the session data of `aKey` with `aValue`.
+//
+// If `aCtx` is done before the engine answers, the context's error is
+// returned (the value may get stored nevertheless).  Otherwise the
+// errors are those of `TrySet()`.
+//
+//	`aCtx` The context bounding the operation.
+//	`aKey` The identifier to lookup.
+//	`aValue` The value to assign.
+func (so *TSession) SetCtx(aCtx context.Context, aKey string, aValue interface{}) error {
+	value, err := copyIn(aKey, aValue)
+	if nil != err {
+		return err
+	}
+	result, err := so.requestCtx(aCtx, smSetKey, aKey, value)
+	if nil != err {
+		return err
+	}
+	if err, ok := result.sValue.(error); ok {
+		return err
+	}
+
+	return nil
+} // SetCtx()
+
+/* _EoF_ */
@@ -0,0 +1,149 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// `tStuckStore` is a store whose `Load()` blocks until `release` is
+// closed and then returns `record`; `Store()` reports the stored IDs
+// to `stored`.
+type tStuckStore struct {
+	TStore
+	record  []byte
+	release chan struct{}
+	stored  chan string
+}
+
+func (ss tStuckStore) Load(aSID string) ([]byte, error) {
+	<-ss.release
+
+	return ss.record, nil
+} // Load()
+
+func (ss tStuckStore) Store(aSID string, aRecord []byte, aExpires time.Time) error {
+	ss.stored <- aSID
+
+	return nil
+} // Store()
+
+func TestTSession_GetCtx(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	ctx := context.Background()
+	so := &TSession{sID: newSID()}
+
+	if err := so.SetCtx(ctx, "Zahl", 123); nil != err {
+		t.Fatalf("SetCtx() error = %v", err)
+	}
+	if got, err := so.GetCtx(ctx, "Zahl"); (nil != err) || (123 != got) {
+		t.Errorf("GetCtx() = %v, %v, want %v", got, err, 123)
+	}
+	if got, err := so.LenCtx(ctx); (nil != err) || (1 != got) {
+		t.Errorf("LenCtx() = %v, %v, want %v", got, err, 1)
+	}
+	if got, err := so.ExpiresCtx(ctx); (nil != err) || got.IsZero() {
+		t.Errorf("ExpiresCtx() = %v, %v, want non-zero time", got, err)
+	}
+	if err := so.DeleteCtx(ctx, "Zahl"); nil != err {
+		t.Errorf("DeleteCtx() error = %v", err)
+	}
+	if got, _ := so.GetCtx(ctx, "Zahl"); nil != got {
+		t.Errorf("GetCtx() after DeleteCtx() = %v, want %v", got, nil)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := so.SetCtx(cancelled, "Zahl", 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("SetCtx() error = %v, want %v", err, context.Canceled)
+	}
+	if err := so.DestroyCtx(ctx); (nil != err) || ("" != so.ID()) {
+		t.Errorf("DestroyCtx() = %v, ID %q", err, so.ID())
+	}
+} // TestTSession_GetCtx()
+
+func TestTSession_GetCtx_stuck(t *testing.T) {
+	so := &TSession{sID: newSID()}
+
+	// a monitor that never answers
+	soEngine = tShRouter{make(chan tShRequest)}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := so.GetCtx(ctx, "Zahl"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetCtx() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// a partition locked by a slow request
+	le := startLockEngine(NewMemoryStore("", 0), 1)
+	soEngine = le
+	defer stopSession()
+	le.stripes[0].mtx.Lock()
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := so.SetCtx(ctx, "Zahl", 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SetCtx() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	le.stripes[0].mtx.Unlock()
+
+	// the abandoned request is carried out nevertheless
+	for deadline := time.Now().Add(time.Second); 1 != so.Get("Zahl"); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Get() = %v, want %v", so.Get("Zahl"), 1)
+		}
+	}
+} // TestTSession_GetCtx_stuck()
+
+func Test_wrapHandler_stuck(t *testing.T) {
+	sid := newSID()
+	record := newRecord(sid)
+	record.data["Zahl"] = 1
+	buf, err := encodeRecord(record)
+	if nil != err {
+		t.Fatalf("encodeRecord() error = %v", err)
+	}
+	store := tStuckStore{NewMemoryStore("", 0), buf, make(chan struct{}), make(chan string, 1)}
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+
+	called := false
+	handler := wrapHandler(http.HandlerFunc(
+		func(aWriter http.ResponseWriter, aRequest *http.Request) {
+			called = true
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/?"+string(soSidName)+"="+sid, nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+	if elapsed := time.Since(start); time.Second < elapsed {
+		t.Errorf("ServeHTTP() took %v, want < %v", elapsed, time.Second)
+	}
+	if called {
+		t.Error("ServeHTTP() called the handler of a stuck session")
+	}
+	if http.StatusServiceUnavailable != rec.Code {
+		t.Errorf("ServeHTTP() status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// the abandoned request is finished once the store recovers
+	close(store.release)
+	select {
+	case newsid := <-store.stored:
+		if newsid == sid {
+			t.Errorf("Store() SID = %q, want a new SID", newsid)
+		}
+	case <-time.After(time.Second):
+		t.Error("abandoned session not stored after the store recovered")
+	}
+} // Test_wrapHandler_stuck()
@@ -0,0 +1,227 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the policy protecting the stored session values
+ * against changes outside of the session engine.
+ *
+ * Values of reference types (maps, slices, pointers …) are shared
+ * between the caller and the session engine; changing them in place
+ * races with the engine writing the session to the store.  Depending
+ * on the policy the values are either copied when they're set and
+ * read (`CopyDeep`) or only values without references are accepted
+ * (`CopyImmutable`).
+ */
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// TCopyPolicy selects how session values are protected against
+	// changes outside of the session engine.
+	TCopyPolicy int32
+)
+
+const (
+	// CopyNone stores and returns the values as they are (default).
+	//
+	// The caller must not change a value of a reference type (map,
+	// slice, pointer …) after storing or reading it.
+	CopyNone = TCopyPolicy(iota)
+
+	// CopyDeep stores and returns deep copies of the values.
+	//
+	// The copies are made by the configured codec (see `SetCodec()`),
+	// so only values supported by the codec can be stored.
+	CopyDeep
+
+	// CopyImmutable accepts only values without references, i.e.
+	// booleans, numbers, strings, `time.Time` and arrays and structs
+	// consisting of those.
+	CopyImmutable
+)
+
+var (
+	// ErrMutableValue is returned when a value of a reference type is
+	// to be stored with the `CopyImmutable` policy.
+	ErrMutableValue = errors.New("sessions: mutable session value")
+
+	// `soCopyPolicy` is the policy applied to session values
+	// (accessed atomically).
+	soCopyPolicy = int32(CopyNone)
+)
+
+// CopyPolicy returns the policy protecting the session values.
+func CopyPolicy() TCopyPolicy {
+	return TCopyPolicy(atomic.LoadInt32(&soCopyPolicy))
+} // CopyPolicy()
+
+// SetCopyPolicy selects the policy protecting the session values
+// against changes outside of the session engine.
+//
+// With `CopyDeep` the session methods (`Set()`, `Get()`, `Range()` …)
+// hand over copies of the values, so callers may change the values
+// they stored or read without affecting the session.
+// With `CopyImmutable` values of reference types are rejected (and
+// logged) by the session methods setting values.
+// The policy applies to the values set and read after the call.
+//
+//	`aPolicy` The policy to use.
+func SetCopyPolicy(aPolicy TCopyPolicy) error {
+	if (CopyNone > aPolicy) || (CopyImmutable < aPolicy) {
+		return fmt.Errorf("sessions: unknown copy policy %d", aPolicy)
+	}
+	atomic.StoreInt32(&soCopyPolicy, int32(aPolicy))
+
+	return nil
+} // SetCopyPolicy()
+
+// String returns the policy's name.
+//
+// Part of the `fmt.Stringer` interface.
+func (p TCopyPolicy) String() string {
+	switch p {
+	case CopyNone:
+		return "none"
+	case CopyDeep:
+		return "deep"
+	case CopyImmutable:
+		return "immutable"
+	}
+
+	return fmt.Sprintf("policy(%d)", int32(p))
+} // String()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `copyIn()` returns the value to store for `aValue` according to the
+// copy policy.
+//
+//	`aKey` The session key of the value.
+//	`aValue` The value to store.
+func copyIn(aKey string, aValue interface{}) (interface{}, error) {
+	switch CopyPolicy() {
+	case CopyDeep:
+		return copyValue(aKey, aValue)
+
+	case CopyImmutable:
+		if (nil != aValue) && !immutableType(reflect.TypeOf(aValue)) {
+			return nil, fmt.Errorf("%w: %q (%T)", ErrMutableValue, aKey, aValue)
+		}
+	}
+
+	return aValue, nil
+} // copyIn()
+
+// `copyInData()` returns the values of `aData` to store according to
+// the copy policy; rejected values are logged and skipped.
+//
+//	`aData` The values to store.
+func copyInData(aData map[string]interface{}) tSessionData {
+	result := make(tSessionData, len(aData))
+	for key, val := range aData {
+		if val, err := copyIn(key, val); nil != err {
+			log.Printf("sessions: can't set session value: %v", err)
+		} else {
+			result[key] = val
+		}
+	}
+
+	return result
+} // copyInData()
+
+// `copyOut()` returns the value to hand out for the stored `aValue`
+// according to the copy policy.
+//
+//	`aKey` The session key of the value.
+//	`aValue` The stored value.
+func copyOut(aKey string, aValue interface{}) interface{} {
+	if CopyDeep != CopyPolicy() {
+		return aValue
+	}
+	result, err := copyValue(aKey, aValue)
+	if nil != err {
+		// a value stored before the policy changed
+		log.Printf("sessions: can't copy session value: %v", err)
+		return nil
+	}
+
+	return result
+} // copyOut()
+
+// `copyOutData()` returns the values of `aData` to hand out according
+// to the copy policy.
+//
+//	`aData` The stored values.
+func copyOutData(aData tSessionData) tSessionData {
+	if CopyDeep != CopyPolicy() {
+		return aData
+	}
+	result := make(tSessionData, len(aData))
+	for key, val := range aData {
+		result[key] = copyOut(key, val)
+	}
+
+	return result
+} // copyOutData()
+
+// `copyValue()` returns a deep copy of `aValue` made by the codec.
+//
+//	`aKey` The session key of the value.
+//	`aValue` The value to copy.
+func copyValue(aKey string, aValue interface{}) (interface{}, error) {
+	if (nil == aValue) || immutableType(reflect.TypeOf(aValue)) {
+		return aValue, nil // nothing to protect
+	}
+	data, err := Codec().copy(tSessionData{aKey: aValue})
+	if nil != err {
+		return nil, err
+	}
+
+	return data[aKey], nil
+} // copyValue()
+
+// `immutableType()` returns whether values of `aType` contain no
+// references (apart from `time.Time`'s location).
+//
+//	`aType` The type to check.
+func immutableType(aType reflect.Type) bool {
+	if reflect.TypeOf(time.Time{}) == aType {
+		return true
+	}
+
+	switch aType.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+
+	case reflect.Array:
+		return immutableType(aType.Elem())
+
+	case reflect.Struct:
+		for idx := 0; idx < aType.NumField(); idx++ {
+			if !immutableType(aType.Field(idx).Type) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+} // immutableType()
+
+/* _EoF_ */
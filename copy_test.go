@@ -0,0 +1,174 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type tCopyPoint struct {
+	X, Y int
+	At   time.Time
+}
+
+func TestSetCopyPolicy(t *testing.T) {
+	defer SetCopyPolicy(CopyNone)
+	if got := CopyPolicy(); CopyNone != got {
+		t.Errorf("CopyPolicy() = %v, want %v", got, CopyNone)
+	}
+	if err := SetCopyPolicy(TCopyPolicy(3)); nil == err {
+		t.Error("SetCopyPolicy(3): no error")
+	}
+	_ = SetCopyPolicy(CopyImmutable)
+	if got := CopyPolicy(); CopyImmutable != got {
+		t.Errorf("CopyPolicy() = %v, want %v", got, CopyImmutable)
+	}
+	if got := CopyDeep.String(); "deep" != got {
+		t.Errorf("String() = %q, want %q", got, "deep")
+	}
+} // TestSetCopyPolicy()
+
+func Test_immutableType(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  bool
+	}{
+		{" 1", 1, true},
+		{" 2", "Zeichenkette", true},
+		{" 3", time.Now(), true},
+		{" 4", tCopyPoint{X: 1}, true},
+		{" 5", [2]float64{1, 2}, true},
+		{" 6", []byte("abc"), false},
+		{" 7", map[string]int{}, false},
+		{" 8", &tCopyPoint{}, false},
+		{" 9", struct{ L []int }{}, false},
+		{"10", [1][]int{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := immutableType(reflect.TypeOf(tt.value)); got != tt.want {
+				t.Errorf("immutableType(%T) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+} // Test_immutableType()
+
+func TestCopyDeep(t *testing.T) {
+	defer SetCopyPolicy(CopyNone)
+	_ = SetCopyPolicy(CopyDeep)
+	sdir := t.TempDir()
+	settleDir(t, sdir)
+	store, _ := NewFileStore(sdir)
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+
+	list := []string{"a", "b"}
+	so.Set("Liste", list)
+	list[0] = "geändert" // doesn't affect the session
+	got := so.Get("Liste").([]string)
+	if "a" != got[0] {
+		t.Errorf("Get() = %v after changing the stored slice", got)
+	}
+	got[1] = "geändert" // neither does this
+	if want := []string{"a", "b"}; !reflect.DeepEqual(so.Get("Liste"), want) {
+		t.Errorf("Get() = %v, want %v", so.Get("Liste"), want)
+	}
+	so.SetMany(map[string]interface{}{"Kanal": make(chan int), "Zahl": 1})
+	if so.Has("Kanal") || !so.Has("Zahl") {
+		t.Errorf("SetMany() stored keys %v", so.Keys())
+	}
+
+	// changing the values read while the session is written to the
+	// store must not race (run with `-race`)
+	so.Set("Zahlen", []int{0, 0})
+	var wg sync.WaitGroup
+	for w := 0; 4 > w; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; 50 > i; i++ {
+				l := so.Get("Zahlen").([]int)
+				l[0] = i
+				so.Range(func(aKey string, aValue interface{}) bool {
+					if l, ok := aValue.([]string); ok {
+						l[0] = "x"
+					}
+					return true
+				})
+				so.request(smStoreSession, "", nil)
+			}
+		}()
+	}
+	wg.Wait()
+	if want := []int{0, 0}; !reflect.DeepEqual(so.Get("Zahlen"), want) {
+		t.Errorf("Get() = %v, want %v", so.Get("Zahlen"), want)
+	}
+} // TestCopyDeep()
+
+func TestCopyDeep_ctx(t *testing.T) {
+	defer SetCopyPolicy(CopyNone)
+	_ = SetCopyPolicy(CopyDeep)
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	ctx := context.Background()
+
+	list := []string{"a", "b"}
+	if err := so.SetCtx(ctx, "Liste", list); nil != err {
+		t.Fatalf("SetCtx() error = %v", err)
+	}
+	list[0] = "geändert" // doesn't affect the session
+	value, err := so.GetCtx(ctx, "Liste")
+	if nil != err {
+		t.Fatalf("GetCtx() error = %v", err)
+	}
+	value.([]string)[1] = "geändert" // neither does this
+	if want := []string{"a", "b"}; !reflect.DeepEqual(so.Get("Liste"), want) {
+		t.Errorf("Get() = %v, want %v", so.Get("Liste"), want)
+	}
+} // TestCopyDeep_ctx()
+
+func TestCopyImmutable(t *testing.T) {
+	defer SetCopyPolicy(CopyNone)
+	_ = SetCopyPolicy(CopyImmutable)
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+
+	point := tCopyPoint{X: 1, Y: 2, At: time.Now()}
+	so.Set("Punkt", point).Set("Liste", []string{"a"}).Set("Zeiger", &point)
+	if want := []string{"Punkt"}; !reflect.DeepEqual(so.Keys(), want) {
+		t.Errorf("Keys() = %v, want %v", so.Keys(), want)
+	}
+
+	if _, err := copyIn("Liste", []string{"a"}); !errors.Is(err, ErrMutableValue) {
+		t.Errorf("copyIn() error = %v, want %v", err, ErrMutableValue)
+	}
+	if err := so.SetCtx(context.Background(), "Liste", []string{"a"}); !errors.Is(err, ErrMutableValue) {
+		t.Errorf("SetCtx() error = %v, want %v", err, ErrMutableValue)
+	}
+	err := so.Update(func(aTx *TTransaction) error {
+		aTx.Set("Zahl", 1)
+		aTx.Set("Karte", map[string]int{})
+		return nil
+	})
+	if !errors.Is(err, ErrMutableValue) {
+		t.Errorf("Update() error = %v, want %v", err, ErrMutableValue)
+	}
+	if so.Has("Karte") || so.Has("Zahl") {
+		t.Errorf("Update() not rolled back: %v", so.Keys())
+	}
+	if so.CompareAndSwap("Punkt", point, []string{"b"}) {
+		t.Error("CompareAndSwap() swapped in a mutable value")
+	}
+} // TestCopyImmutable()
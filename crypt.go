@@ -0,0 +1,227 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the optional encryption of stored session data.
+ *
+ * An encrypted payload consists of the ID of the key used (4 bytes,
+ * big-endian), the nonce, and the AES-GCM sealed session data.
+ * The record's header and meta data are not encrypted but
+ * authenticated as additional data.
+ */
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// TKeyRing holds the keys used to encrypt/decrypt session data.
+	//
+	// New data is always encrypted with the ring's primary key
+	// while all keys in the ring are used for decryption.
+	// To rotate keys add a new key, make it the primary one and
+	// remove the old key once all sessions encrypted with it are
+	// either expired or have been stored again (which re-encrypts
+	// them with the current primary key).
+	TKeyRing struct {
+		mtx     sync.RWMutex
+		keys    map[uint32]cipher.AEAD
+		primary uint32
+	}
+
+	// `tEncryption` holds the encryption settings (which are
+	// replaced as a whole).
+	tEncryption struct {
+		keyRing    *TKeyRing // `nil`: encryption disabled
+		allowPlain bool      // whether unencrypted records are accepted
+	}
+)
+
+var (
+	// ErrDecrypt is returned when stored session data can't be
+	// decrypted (e.g. because of a missing key or tampered data).
+	ErrDecrypt = errors.New("sessions: can't decrypt session data")
+
+	// `soEncryption` holds the current `tEncryption` settings.
+	soEncryption atomic.Value
+)
+
+// NewKeyRing returns a new key ring with `aKey` as its primary key.
+//
+//	`aID` The identifier of the key.
+//	`aKey` The AES key (16, 24, or 32 bytes long).
+func NewKeyRing(aID uint32, aKey []byte) (*TKeyRing, error) {
+	result := &TKeyRing{
+		keys: make(map[uint32]cipher.AEAD, 2),
+	}
+	if err := result.AddKey(aID, aKey); nil != err {
+		return nil, err
+	}
+	result.primary = aID
+
+	return result, nil
+} // NewKeyRing()
+
+// AddKey adds `aKey` to the key ring.
+//
+// The new key is used for decryption only until it's made the
+// primary key by calling `SetPrimary()`.
+//
+//	`aID` The identifier of the key.
+//	`aKey` The AES key (16, 24, or 32 bytes long).
+func (kr *TKeyRing) AddKey(aID uint32, aKey []byte) error {
+	block, err := aes.NewCipher(aKey)
+	if nil != err {
+		return fmt.Errorf("sessions: key %d: %w", aID, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if nil != err {
+		return fmt.Errorf("sessions: key %d: %w", aID, err)
+	}
+
+	kr.mtx.Lock()
+	defer kr.mtx.Unlock()
+	if _, ok := kr.keys[aID]; ok {
+		return fmt.Errorf("sessions: duplicate key %d", aID)
+	}
+	kr.keys[aID] = aead
+
+	return nil
+} // AddKey()
+
+// Primary returns the ID of the key used for encryption.
+func (kr *TKeyRing) Primary() uint32 {
+	kr.mtx.RLock()
+	defer kr.mtx.RUnlock()
+
+	return kr.primary
+} // Primary()
+
+// RemoveKey removes the key identified by `aID` from the key ring.
+//
+// Session data encrypted with that key can't be read anymore.
+// The primary key can't be removed.
+//
+//	`aID` The identifier of the key to remove.
+func (kr *TKeyRing) RemoveKey(aID uint32) error {
+	kr.mtx.Lock()
+	defer kr.mtx.Unlock()
+	if aID == kr.primary {
+		return fmt.Errorf("sessions: can't remove primary key %d", aID)
+	}
+	delete(kr.keys, aID)
+
+	return nil
+} // RemoveKey()
+
+// SetPrimary makes the key identified by `aID` the one used for
+// encrypting session data.
+//
+//	`aID` The identifier of the new primary key.
+func (kr *TKeyRing) SetPrimary(aID uint32) error {
+	kr.mtx.Lock()
+	defer kr.mtx.Unlock()
+	if _, ok := kr.keys[aID]; !ok {
+		return fmt.Errorf("sessions: unknown key %d", aID)
+	}
+	kr.primary = aID
+
+	return nil
+} // SetPrimary()
+
+// `open()` decrypts and authenticates `aData`.
+//
+//	`aData` The encrypted payload.
+//	`aAdditional` The additional data to authenticate.
+func (kr *TKeyRing) open(aData, aAdditional []byte) ([]byte, error) {
+	if 4 > len(aData) {
+		return nil, ErrDecrypt
+	}
+	id := binary.BigEndian.Uint32(aData)
+	kr.mtx.RLock()
+	aead, ok := kr.keys[id]
+	kr.mtx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %d", ErrDecrypt, id)
+	}
+	aData = aData[4:]
+	if aead.NonceSize() > len(aData) {
+		return nil, ErrDecrypt
+	}
+	nonce, sealed := aData[:aead.NonceSize()], aData[aead.NonceSize():]
+	result, err := aead.Open(nil, nonce, sealed, aAdditional)
+	if nil != err {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+
+	return result, nil
+} // open()
+
+// `seal()` encrypts and authenticates `aData` with the primary key.
+//
+//	`aData` The plain payload.
+//	`aAdditional` The additional data to authenticate.
+func (kr *TKeyRing) seal(aData, aAdditional []byte) ([]byte, error) {
+	kr.mtx.RLock()
+	id, aead := kr.primary, kr.keys[kr.primary]
+	kr.mtx.RUnlock()
+
+	result := make([]byte, 4+aead.NonceSize(), 4+aead.NonceSize()+len(aData)+aead.Overhead())
+	binary.BigEndian.PutUint32(result, id)
+	if _, err := rand.Read(result[4:]); nil != err {
+		return nil, err
+	}
+
+	return aead.Seal(result, result[4:], aData, aAdditional), nil
+} // seal()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `allowPlain()` reports whether unencrypted session records are
+// accepted (which is the case if encryption is disabled).
+func allowPlain() bool {
+	settings, _ := soEncryption.Load().(tEncryption)
+
+	return (nil == settings.keyRing) || settings.allowPlain
+} // allowPlain()
+
+// KeyRing returns the key ring used for encrypting session data
+// (or `nil` if encryption is disabled).
+func KeyRing() *TKeyRing {
+	settings, _ := soEncryption.Load().(tEncryption)
+
+	return settings.keyRing
+} // KeyRing()
+
+// SetKeyRing enables the encryption of stored session data.
+//
+// Passing `nil` disables encryption for sessions stored afterwards;
+// already encrypted sessions can't be read anymore in that case.
+// With encryption enabled unencrypted session records are rejected
+// (as if they were tampered with) unless `aAllowPlain` is `true`;
+// allow them only while migrating existing plain sessions, which are
+// encrypted the next time they are stored.
+//
+//	`aKeyRing` The keys to use for encryption/decryption.
+//	`aAllowPlain` Whether to accept unencrypted session records.
+func SetKeyRing(aKeyRing *TKeyRing, aAllowPlain bool) {
+	soEncryption.Store(tEncryption{
+		keyRing:    aKeyRing,
+		allowPlain: aAllowPlain,
+	})
+} // SetKeyRing()
+
+/* _EoF_ */
@@ -0,0 +1,129 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewKeyRing(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     []byte
+		wantErr bool
+	}{
+		{" 1", make([]byte, 16), false},
+		{" 2", make([]byte, 24), false},
+		{" 3", make([]byte, 32), false},
+		{" 4", make([]byte, 17), true},
+		{" 5", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyRing(1, tt.key)
+			if (nil != err) != tt.wantErr {
+				t.Errorf("NewKeyRing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+} // TestNewKeyRing()
+
+func TestTKeyRing_rotation(t *testing.T) {
+	defer SetKeyRing(nil, false)
+	sdir := t.TempDir()
+	store := &TFileStore{dir: sdir}
+	fName := filepath.Join(sdir, "aTestSID.sid")
+	rec := newRecord("aTestSID")
+	rec.data["Zeichenkette"] = "eine geheime Zeichenkette"
+
+	kr, _ := NewKeyRing(1, bytes.Repeat([]byte{1}, 32))
+	SetKeyRing(kr, false)
+	goStore(store, rec.clone())
+	buf, _ := os.ReadFile(fName)
+	if bytes.Contains(buf, []byte("geheime")) {
+		t.Fatalf("session file contains plain text")
+	}
+	if got := loadSession(store, rec.sID); "eine geheime Zeichenkette" != got.data["Zeichenkette"] {
+		t.Errorf("loadSession() = %v, want %v", got.data, rec.data)
+	}
+
+	// rotate: the old key is still usable for reading …
+	if err := kr.AddKey(2, bytes.Repeat([]byte{2}, 16)); nil != err {
+		t.Fatal(err)
+	}
+	if err := kr.SetPrimary(2); nil != err {
+		t.Fatal(err)
+	}
+	got := loadSession(store, rec.sID)
+	if 1 != len(got.data) {
+		t.Errorf("loadSession() after rotation = %v, want %v", got.data, rec.data)
+	}
+	// … and the next write re-encrypts with the new key
+	goStore(store, got)
+	if err := kr.RemoveKey(1); nil != err {
+		t.Fatal(err)
+	}
+	if got = loadSession(store, rec.sID); 1 != len(got.data) {
+		t.Errorf("loadSession() after re-encryption = %v, want %v", got.data, rec.data)
+	}
+	if err := kr.RemoveKey(2); nil == err {
+		t.Errorf("RemoveKey() of primary key expected error")
+	}
+
+	// tampering with the (unencrypted) meta data is detected
+	buf, _ = os.ReadFile(fName)
+	buf[sfHeaderLen+2+len(rec.sID)+20] ^= 0xFF // expiry time
+	if _, err := decodeRecord(buf); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("decodeRecord() error = %v, want %v", err, ErrDecrypt)
+	}
+
+	// without key ring the data can't be read
+	SetKeyRing(nil, false)
+	if got = loadSession(store, rec.sID); 0 != len(got.data) {
+		t.Errorf("loadSession() without key = %v, want empty", got.data)
+	}
+} // TestTKeyRing_rotation()
+
+func TestSetKeyRing_plain(t *testing.T) {
+	defer SetKeyRing(nil, false)
+	sdir := t.TempDir()
+	store := &TFileStore{dir: sdir}
+	rec := newRecord("aPlainSID")
+	rec.data["Zeichenkette"] = "eine Zeichenkette"
+	goStore(store, rec.clone()) // stored before encryption is enabled
+	if err := legacyFile(sdir, "aLegacySID", rec.data, time.Now().Add(time.Hour)); nil != err {
+		t.Fatal(err)
+	}
+
+	kr, _ := NewKeyRing(1, make([]byte, 16))
+	SetKeyRing(kr, false)
+	for _, sid := range []string{"aPlainSID", "aLegacySID"} {
+		buf, _ := os.ReadFile(filepath.Join(sdir, sid+".sid"))
+		if _, err := decodeRecord(buf); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("decodeRecord(%q) error = %v, want %v", sid, err, ErrDecrypt)
+		}
+		if got := loadSession(store, sid); 0 != len(got.data) {
+			t.Errorf("loadSession(%q) = %v, want empty", sid, got.data)
+		}
+	}
+
+	// migrating: plain records are accepted and encrypted when stored
+	SetKeyRing(kr, true)
+	got := loadSession(store, rec.sID)
+	if "eine Zeichenkette" != got.data["Zeichenkette"] {
+		t.Fatalf("loadSession() = %v, want %v", got.data, rec.data)
+	}
+	goStore(store, got)
+	SetKeyRing(kr, false)
+	if got = loadSession(store, rec.sID); 1 != len(got.data) {
+		t.Errorf("loadSession() after migration = %v, want %v", got.data, rec.data)
+	}
+} // TestSetKeyRing_plain()
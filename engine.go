@@ -0,0 +1,208 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the selection of the engine handling the
+ * session requests.
+ *
+ * Both engines partition the sessions by a hash of their IDs and use
+ * the same request handling (see `tShMonitor`); they differ in how
+ * the access to a partition is serialised:
+ *
+ *   - `EngineChannels` runs a goroutine per partition which receives
+ *     the requests through a channel (see `router.go`);
+ *   - `EngineLocks` guards each partition by a mutex and handles the
+ *     requests in the caller's goroutine (see `lockengine.go`).
+ */
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+type (
+	// TEngine selects how the session requests are handled.
+	TEngine int32
+
+	// `tShEngine` is the interface of the session request engines.
+	tShEngine interface {
+		// `request()` hands `aRequest` to the partition of its
+		// session and returns the reply.
+		request(aRequest tShRequest) *TSession
+
+		// `requestCtx()` hands `aRequest` to the partition of its
+		// session and returns the reply unless `aCtx` is done before.
+		requestCtx(aCtx context.Context, aRequest tShRequest) (*TSession, error)
+
+		// `requestShard()` hands `aRequest` to the partition
+		// `aShard` and returns the reply.
+		requestShard(aShard int, aRequest tShRequest) *TSession
+
+		// `shard()` returns the partition of the session `aSID`.
+		shard(aSID string) int
+
+		// `shards()` returns the number of partitions.
+		shards() int
+
+		// `terminate()` stops the engine (for testing only).
+		terminate()
+	}
+
+	// `tEngineRef` wraps an engine to be stored in an `atomic.Value`
+	// (which requires the same concrete type for all values).
+	tEngineRef struct {
+		engine tShEngine
+	}
+)
+
+const (
+	// EngineChannels handles the session requests by goroutines
+	// receiving them through channels (default).
+	EngineChannels = TEngine(iota)
+
+	// EngineLocks handles the session requests in the calling
+	// goroutine guarding the sessions by mutexes.
+	EngineLocks
+)
+
+var (
+	// `soEngine` handles the session requests.
+	// Until the session handling is started (by `Wrap()` or
+	// `WrapStore()`) there's just a single channel nobody listens to.
+	soEngine tShEngine = tShRouter{make(chan tShRequest, 2)}
+
+	// `soEngineType` is the engine to start (accessed atomically).
+	soEngineType int32
+)
+
+// Engine returns the engine used to handle the session requests.
+func Engine() TEngine {
+	return TEngine(atomic.LoadInt32(&soEngineType))
+} // Engine()
+
+// SetEngine selects the engine to handle the session requests.
+//
+// With `EngineChannels` (the default) the sessions are held by
+// goroutines which receive the requests through channels, i.e. each
+// request takes two channel operations.
+// With `EngineLocks` the sessions are guarded by mutexes instead and
+// the requests are handled by the calling goroutine, i.e. reading a
+// session value takes a lock and a map lookup.
+// In both cases the sessions are partitioned (see `SetMonitorShards()`)
+// and all other features work the same.
+//
+// The engine must be selected before calling `Wrap()` or
+// `WrapStore()`; later changes have no effect.
+//
+//	`aEngine` The engine to use.
+func SetEngine(aEngine TEngine) error {
+	if (EngineChannels > aEngine) || (EngineLocks < aEngine) {
+		return fmt.Errorf("sessions: invalid engine %d", aEngine)
+	}
+	atomic.StoreInt32(&soEngineType, int32(aEngine))
+
+	return nil
+} // SetEngine()
+
+// String returns the engine's name.
+//
+// Part of the `fmt.Stringer` interface.
+func (e TEngine) String() string {
+	switch e {
+	case EngineChannels:
+		return "channels"
+	case EngineLocks:
+		return "locks"
+	}
+
+	return "unknown"
+} // String()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `gcCollector()` returns a function which starts a run of the
+// garbage collector unless the previous one is still active.
+//
+//	`aStore` The store holding the session records.
+//	`aEngine` The engine handling the session requests.
+func gcCollector(aStore TStore, aEngine tShEngine) func() {
+	if _, memOnly := aStore.(*TMemoryStore); memOnly {
+		return func() {} // the cache is all there is
+	}
+	var running int32
+
+	return func() {
+		if atomic.CompareAndSwapInt32(&running, 0, 1) {
+			go func() {
+				goGC(aStore, aEngine)
+				atomic.StoreInt32(&running, 0)
+			}()
+		}
+	}
+} // gcCollector()
+
+// `goSnapshot()` writes all sessions to the snapshot file of `aStore`.
+//
+//	`aStore` The memory store to snapshot.
+//	`aEngine` The engine holding the sessions.
+func goSnapshot(aStore *TMemoryStore, aEngine tShEngine) {
+	if err := aStore.snapshot(aStore.records(aEngine)); nil != err {
+		log.Printf("sessions: can't write snapshot: %v", err)
+	}
+} // goSnapshot()
+
+// `restoreSessions()` returns the sessions restored from the snapshot
+// of `aStore` (if it's a memory store).
+//
+//	`aStore` The store holding the session records.
+func restoreSessions(aStore TStore) tShList {
+	result := make(tShList)
+	if memStore, ok := aStore.(*TMemoryStore); ok {
+		if err := memStore.restore(result); nil != err {
+			log.Printf("sessions: can't restore snapshot: %v", err)
+		}
+	}
+
+	return result
+} // restoreSessions()
+
+// `shardIndex()` returns the partition of the session `aSID` out
+// of `aCount` partitions.
+//
+//	`aSID` The session ID to route.
+//	`aCount` The number of partitions.
+func shardIndex(aSID string, aCount int) int {
+	if 1 == aCount {
+		return 0
+	}
+
+	// FNV-1a (inlined to avoid allocations)
+	hash := uint32(2166136261)
+	for idx := 0; idx < len(aSID); idx++ {
+		hash ^= uint32(aSID[idx])
+		hash *= 16777619
+	}
+
+	return int(hash % uint32(aCount))
+} // shardIndex()
+
+// `startEngine()` starts the configured engine using `aStore`.
+//
+//	`aStore` The store holding the session records.
+func startEngine(aStore TStore) tShEngine {
+	if EngineLocks == Engine() {
+		return startLockEngine(aStore, MonitorShards())
+	}
+
+	return startMonitors(aStore, MonitorShards())
+} // startEngine()
+
+/* _EoF_ */
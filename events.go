@@ -0,0 +1,338 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the hooks to observe the sessions' lifecycle.
+ *
+ * Events are queued by the session monitor (and its helper
+ * goroutines) and handed to the registered hooks by a dispatcher
+ * goroutine of their own; hence a slow (or blocking) hook delays
+ * other hooks but never the session handling itself.
+ *
+ * The queue holds at most `EventQueueSize` events; while it's full
+ * new events are dropped (and counted, see `DroppedEvents()`).
+ */
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// TEventType is the kind of a session lifecycle event.
+	TEventType uint8
+
+	// TEvent describes a change in a session's lifecycle.
+	TEvent struct {
+		Type   TEventType   // the kind of event
+		SID    string       // the session's (current) ID
+		OldSID string       // the session's previous ID (`EventRotated` only)
+		Reason string       // why the event happened (see `ReasonXxx`)
+		Time   time.Time    // when the event happened
+		Data   TSessionView // the session's data (`EventExpired` and `EventDestroyed`)
+	}
+
+	// THook is a function called for session lifecycle events.
+	THook func(aEvent TEvent)
+
+	// TSessionView is a read-only view of a session's data.
+	//
+	// It holds a deep copy (made by the configured codec, see
+	// `SetCodec()`) of the data, so changing a value returned by
+	// `Get()` doesn't affect the session or other hooks.
+	TSessionView struct {
+		data tSessionData
+	}
+)
+
+const (
+	// EventCreated signals a new session.
+	EventCreated TEventType = iota + 1
+
+	// EventRotated signals a session getting a new ID.
+	EventRotated
+
+	// EventStored signals a session written to the store.
+	EventStored
+
+	// EventExpired signals a session removed because it expired.
+	EventExpired
+
+	// EventDestroyed signals a session removed by `TSession.Destroy()`.
+	EventDestroyed
+)
+
+const (
+	// EventQueueSize is the max. number of events waiting for the
+	// hooks; further events are dropped until the hooks caught up.
+	EventQueueSize = 4096
+)
+
+const (
+	// ReasonDestroyed: the session was destroyed explicitly.
+	ReasonDestroyed = "destroyed"
+
+	// ReasonGC: the garbage collector found the stored session expired.
+	ReasonGC = "gc"
+
+	// ReasonIdle: the session wasn't used within its idle timeout.
+	ReasonIdle = "idle"
+
+	// ReasonMaxAge: the session reached its max. lifetime.
+	ReasonMaxAge = "max-age"
+
+	// ReasonNew: a session was requested which didn't exist (anymore).
+	ReasonNew = "new"
+
+	// ReasonRequest: the session's ID was changed for a new request.
+	ReasonRequest = "request"
+)
+
+var (
+	// `soHooks` are the registered hooks (guarded by `soHookMtx`).
+	soHooks = make(map[int]THook)
+
+	// `soHookCount` is the number of registered hooks (accessed
+	// atomically) allowing for a quick check whether events are
+	// needed at all.
+	soHookCount int32
+
+	// `soHookID` is the ID of the latest hook registered.
+	soHookID int
+
+	// `soHookMtx` guards `soHooks` and `soHookID`.
+	soHookMtx sync.RWMutex
+
+	// `soEvents` is the queue of events not yet dispatched
+	// (guarded by `soEventMtx`).
+	soEvents []TEvent
+
+	// `soEventMtx` guards `soEvents`.
+	soEventMtx sync.Mutex
+
+	// `soEventsDropped` is the number of events dropped because the
+	// queue was full (accessed atomically).
+	soEventsDropped uint64
+
+	// `soEventSignal` wakes up the dispatcher.
+	soEventSignal = make(chan struct{}, 1)
+
+	// `soDispatchOnce` starts the dispatcher.
+	soDispatchOnce sync.Once
+)
+
+// AddHook registers `aHook` to be called for all session lifecycle
+// events; it returns an ID to remove the hook again.
+//
+// The hooks are called one after the other in a goroutine of their
+// own, i.e. not by the session handling itself.
+// Hence the session data may have changed already when an event is
+// handled (except for the read-only copy in `TEvent.Data`).
+//
+//	`aHook` The function to call for each event.
+func AddHook(aHook THook) int {
+	soDispatchOnce.Do(func() {
+		go goDispatch()
+	})
+
+	soHookMtx.Lock()
+	defer soHookMtx.Unlock()
+	soHookID++
+	soHooks[soHookID] = aHook
+	atomic.StoreInt32(&soHookCount, int32(len(soHooks)))
+
+	return soHookID
+} // AddHook()
+
+// DroppedEvents returns the number of events dropped because the
+// hooks didn't keep up with them (see `EventQueueSize`).
+func DroppedEvents() uint64 {
+	return atomic.LoadUint64(&soEventsDropped)
+} // DroppedEvents()
+
+// RemoveHook unregisters the hook identified by `aID`.
+//
+//	`aID` The value returned by `AddHook()`.
+func RemoveHook(aID int) {
+	soHookMtx.Lock()
+	defer soHookMtx.Unlock()
+	delete(soHooks, aID)
+	atomic.StoreInt32(&soHookCount, int32(len(soHooks)))
+} // RemoveHook()
+
+// String returns the event type's name.
+//
+// Part of the `fmt.Stringer` interface.
+func (et TEventType) String() string {
+	switch et {
+	case EventCreated:
+		return "created"
+	case EventRotated:
+		return "rotated"
+	case EventStored:
+		return "stored"
+	case EventExpired:
+		return "expired"
+	case EventDestroyed:
+		return "destroyed"
+	}
+
+	return "unknown"
+} // String()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// Get returns the value of `aKey` and whether it exists.
+//
+//	`aKey` The identifier to lookup.
+func (sv TSessionView) Get(aKey string) (interface{}, bool) {
+	result, ok := sv.data[aKey]
+
+	return result, ok
+} // Get()
+
+// Keys returns the sorted keys of the session data.
+func (sv TSessionView) Keys() []string {
+	result := make([]string, 0, len(sv.data))
+	for key := range sv.data {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+
+	return result
+} // Keys()
+
+// Len returns the number of session variables.
+func (sv TSessionView) Len() int {
+	return len(sv.data)
+} // Len()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `emit()` queues an event for the hooks (if there are any).
+//
+// If the queue is full the event is dropped (see `DroppedEvents()`).
+//
+//	`aType` The kind of event.
+//	`aSID` The session's ID.
+//	`aOldSID` The session's previous ID (rotation only).
+//	`aReason` Why the event happened.
+//	`aData` The session data to provide a deep copy of (may be `nil`).
+func emit(aType TEventType, aSID, aOldSID, aReason string, aData tSessionData) {
+	if !hooksActive() {
+		return
+	}
+	soEventMtx.Lock()
+	full := EventQueueSize <= len(soEvents)
+	soEventMtx.Unlock()
+	if full {
+		atomic.AddUint64(&soEventsDropped, 1)
+		return
+	}
+	event := TEvent{
+		Type:   aType,
+		SID:    aSID,
+		OldSID: aOldSID,
+		Reason: aReason,
+		Time:   time.Now(),
+	}
+	if nil != aData {
+		event.Data.data = make(tSessionData, len(aData))
+		for key, val := range aData {
+			if cp, err := copyValue(key, val); nil == err {
+				val = cp
+			} // values the codec can't handle are provided as they are
+			event.Data.data[key] = val
+		}
+	}
+
+	soEventMtx.Lock()
+	if full = EventQueueSize <= len(soEvents); !full {
+		soEvents = append(soEvents, event)
+	}
+	soEventMtx.Unlock()
+	if full { // filled up meanwhile
+		atomic.AddUint64(&soEventsDropped, 1)
+		return
+	}
+
+	select {
+	case soEventSignal <- struct{}{}:
+	default: // the dispatcher is awake already
+	}
+} // emit()
+
+// `expiryReason()` returns why `aRecord` expired.
+//
+//	`aRecord` The expired session record.
+func expiryReason(aRecord *tSessionRecord) string {
+	maxAge := aRecord.maxAge
+	if 0 >= maxAge {
+		maxAge = SessionMaxAge()
+	}
+	if (0 < maxAge) && !aRecord.created.IsZero() &&
+		!aRecord.created.Add(maxAge).After(aRecord.expires) {
+		return ReasonMaxAge
+	}
+
+	return ReasonIdle
+} // expiryReason()
+
+// `goDispatch()` hands the queued events to the registered hooks.
+func goDispatch() {
+	for range soEventSignal {
+		soEventMtx.Lock()
+		events := soEvents
+		soEvents = nil
+		soEventMtx.Unlock()
+
+		soHookMtx.RLock()
+		ids := make([]int, 0, len(soHooks))
+		for id := range soHooks {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids) // call the hooks in registration order
+		hooks := make([]THook, len(ids))
+		for idx, id := range ids {
+			hooks[idx] = soHooks[id]
+		}
+		soHookMtx.RUnlock()
+
+		for _, event := range events {
+			for _, hook := range hooks {
+				runHook(hook, event)
+			}
+		}
+	}
+} // goDispatch()
+
+// `hooksActive()` reports whether there are any hooks registered.
+func hooksActive() bool {
+	return 0 < atomic.LoadInt32(&soHookCount)
+} // hooksActive()
+
+// `runHook()` calls `aHook` with `aEvent` preventing a panicking
+// hook from stopping the dispatcher.
+//
+//	`aHook` The hook to call.
+//	`aEvent` The event to pass.
+func runHook(aHook THook, aEvent TEvent) {
+	defer func() {
+		if err := recover(); nil != err {
+			log.Printf("sessions: hook panicked on %s event: %v", aEvent.Type, err)
+		}
+	}()
+
+	aHook(aEvent)
+} // runHook()
+
+/* _EoF_ */
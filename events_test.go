@@ -0,0 +1,273 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type tEventLog struct {
+	mtx    sync.Mutex
+	events []TEvent
+}
+
+func (el *tEventLog) hook(aEvent TEvent) {
+	el.mtx.Lock()
+	defer el.mtx.Unlock()
+	el.events = append(el.events, aEvent)
+} // hook()
+
+// `wait()` returns the first logged event of `aType` for `aSID`.
+func (el *tEventLog) wait(t *testing.T, aType TEventType, aSID string) TEvent {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		el.mtx.Lock()
+		for _, event := range el.events {
+			if (aType == event.Type) && (aSID == event.SID) {
+				el.mtx.Unlock()
+				return event
+			}
+		}
+		el.mtx.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no %s event for %q", aType, aSID)
+
+	return TEvent{}
+} // wait()
+
+func TestAddHook(t *testing.T) {
+	store, _ := NewFileStore(t.TempDir())
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+	log := &tEventLog{}
+	id := AddHook(log.hook)
+	defer RemoveHook(id)
+
+	so := &TSession{sID: newSID()}
+	sid := so.sID
+	so.Set("Zahl", 1)
+	if got := log.wait(t, EventCreated, sid); ReasonNew != got.Reason {
+		t.Errorf("EventCreated reason = %q, want %q", got.Reason, ReasonNew)
+	}
+	so.request(smStoreSession, "", nil)
+	log.wait(t, EventStored, sid)
+
+	so.changeID()
+	if got := log.wait(t, EventRotated, so.sID); sid != got.OldSID {
+		t.Errorf("EventRotated OldSID = %q, want %q", got.OldSID, sid)
+	}
+	so.Set("Wort", "eins")
+	sid = so.sID
+	so.Destroy()
+	got := log.wait(t, EventDestroyed, sid)
+	if v, _ := got.Data.Get("Wort"); "eins" != v {
+		t.Errorf("EventDestroyed data = %v, want %q", v, "eins")
+	}
+	if keys := got.Data.Keys(); (2 != len(keys)) || ("Wort" != keys[0]) {
+		t.Errorf("EventDestroyed keys = %v, want %v", keys, []string{"Wort", "Zahl"})
+	}
+} // TestAddHook()
+
+func TestAddHook_deepCopy(t *testing.T) {
+	log := &tEventLog{}
+	id := AddHook(log.hook)
+	defer RemoveHook(id)
+
+	list := []string{"eins", "zwei"}
+	emit(EventDestroyed, "aCopySID", "", ReasonDestroyed, tSessionData{"Liste": list})
+	list[0] = "drei" // changed after the event was queued
+	got := log.wait(t, EventDestroyed, "aCopySID")
+	v, _ := got.Data.Get("Liste")
+	if l, ok := v.([]string); !ok || ("eins" != l[0]) {
+		t.Errorf("EventDestroyed data = %v, want %v", v, []string{"eins", "zwei"})
+	}
+} // TestAddHook_deepCopy()
+
+func TestAddHook_expired(t *testing.T) {
+	store, _ := NewFileStore(t.TempDir())
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+	log := &tEventLog{}
+	id := AddHook(log.hook)
+	defer RemoveHook(id)
+
+	// expired on access
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 1)
+	_ = so.SetTTL(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	so.Len()
+	got := log.wait(t, EventExpired, so.sID)
+	if ReasonIdle != got.Reason {
+		t.Errorf("EventExpired reason = %q, want %q", got.Reason, ReasonIdle)
+	}
+	if 1 != got.Data.Len() {
+		t.Errorf("EventExpired data len = %d, want %d", got.Data.Len(), 1)
+	}
+
+	// expired in the store
+	record := newRecord(newSID())
+	record.data["Zahl"] = 2
+	record.expires = time.Now().Add(-time.Second)
+	buf, _ := encodeRecord(record)
+	_ = store.Store(record.sID, buf, record.expires)
+	expireSessions(store, soEngine, []string{record.sID})
+	got = log.wait(t, EventExpired, record.sID)
+	if ReasonGC != got.Reason {
+		t.Errorf("EventExpired reason = %q, want %q", got.Reason, ReasonGC)
+	}
+	if v, _ := got.Data.Get("Zahl"); 2 != v {
+		t.Errorf("EventExpired data = %v, want %v", v, 2)
+	}
+	if _, err := store.Load(record.sID); nil == err {
+		t.Error("expired session not removed")
+	}
+
+	// sessions still in use are kept
+	so = &TSession{sID: newSID()}
+	so.Set("Zahl", 3)
+	if n, _ := expireSessions(store, soEngine, []string{so.sID}); 0 != n {
+		t.Errorf("expireSessions() = %d, want %d", n, 0)
+	}
+	if got, _ := so.GetInt("Zahl"); 3 != got {
+		t.Errorf("GetInt() = %v, want %v", got, 3)
+	}
+} // TestAddHook_expired()
+
+func TestAddHook_expiredLog(t *testing.T) {
+	store, err := NewLogStore(t.TempDir(), 0, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+	log := &tEventLog{}
+	id := AddHook(log.hook)
+	defer RemoveHook(id)
+
+	// the GC provides the data although `Load()` skips the record
+	record := newRecord(newSID())
+	record.data["Zahl"] = 2
+	record.expires = time.Now().Add(-time.Second)
+	buf, _ := encodeRecord(record)
+	_ = store.Store(record.sID, buf, record.expires)
+	expireSessions(store, soEngine, []string{record.sID})
+	got := log.wait(t, EventExpired, record.sID)
+	if v, _ := got.Data.Get("Zahl"); 2 != v {
+		t.Errorf("EventExpired data = %v, want %v", v, 2)
+	}
+} // TestAddHook_expiredLog()
+
+func TestRemoveHook(t *testing.T) {
+	initMemorySession(NewMemoryStore("", 0))
+	defer stopSession()
+	log := &tEventLog{}
+	id := AddHook(log.hook)
+	panicID := AddHook(func(TEvent) { panic("hook") })
+	defer RemoveHook(panicID)
+
+	// a panicking hook doesn't stop the dispatcher
+	sid := newSID()
+	(&TSession{sID: sid}).Set("Zahl", 1)
+	log.wait(t, EventCreated, sid)
+	sid = newSID()
+	(&TSession{sID: sid}).Set("Zahl", 1)
+	log.wait(t, EventCreated, sid)
+
+	RemoveHook(id)
+	sid = newSID()
+	(&TSession{sID: sid}).Set("Zahl", 1)
+	time.Sleep(20 * time.Millisecond)
+	log.mtx.Lock()
+	defer log.mtx.Unlock()
+	for _, event := range log.events {
+		if sid == event.SID {
+			t.Errorf("removed hook called for %v", event)
+		}
+	}
+} // TestRemoveHook()
+
+func TestAddHook_blocking(t *testing.T) {
+	initMemorySession(NewMemoryStore("", 0))
+	defer stopSession()
+	release := make(chan struct{})
+	id := AddHook(func(TEvent) { <-release })
+	defer RemoveHook(id)
+	defer close(release)
+
+	// a blocking hook doesn't delay the sessions
+	done := make(chan struct{})
+	go func() {
+		for i := 0; 100 > i; i++ {
+			(&TSession{sID: newSID()}).Set("Zahl", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("sessions blocked by hook")
+	}
+} // TestAddHook_blocking()
+
+func TestDroppedEvents(t *testing.T) {
+	initMemorySession(NewMemoryStore("", 0))
+	defer stopSession()
+	release := make(chan struct{})
+	id := AddHook(func(TEvent) { <-release })
+	defer RemoveHook(id)
+	dropped := DroppedEvents()
+
+	queued := func() int {
+		soEventMtx.Lock()
+		defer soEventMtx.Unlock()
+		return len(soEvents)
+	}
+
+	// wait for the dispatcher to block in the hook
+	emit(EventCreated, newSID(), "", ReasonNew, nil)
+	for deadline := time.Now().Add(time.Second); 0 < queued(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("event not dispatched")
+		}
+	}
+	for i := 0; EventQueueSize+10 > i; i++ {
+		emit(EventCreated, newSID(), "", ReasonNew, nil)
+	}
+	if got := DroppedEvents() - dropped; 10 > got {
+		t.Errorf("DroppedEvents() = %d, want >= %d", got, 10)
+	}
+	if got := queued(); EventQueueSize < got {
+		t.Errorf("queued events = %d, want <= %d", got, EventQueueSize)
+	}
+	close(release)
+} // TestDroppedEvents()
+
+func TestTEventType_String(t *testing.T) {
+	tests := []struct {
+		name string
+		et   TEventType
+		want string
+	}{
+		{" 1", EventCreated, "created"},
+		{" 2", EventRotated, "rotated"},
+		{" 3", EventStored, "stored"},
+		{" 4", EventExpired, "expired"},
+		{" 5", EventDestroyed, "destroyed"},
+		{" 6", 0, "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.et.String(); got != tt.want {
+				t.Errorf("TEventType.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // TestTEventType_String()
@@ -0,0 +1,106 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides one-shot messages ("flashes") e.g. to be shown
+ * on the page following a POST-redirect-GET.
+ *
+ * The messages are kept in the session data under keys starting with
+ * `FlashPrefix`; adding and consuming them are transactions (see
+ * `TSession.Update()`), so a message is neither lost nor shown twice
+ * even with concurrent requests.
+ */
+
+import (
+	"log"
+)
+
+const (
+	// FlashPrefix starts the (reserved) session keys holding the
+	// flash messages.
+	FlashPrefix = "_flash."
+)
+
+// AddFlash appends `aMessage` to the session's flash messages of
+// `aKind`.
+//
+// A message exceeding the session limits (see `SetSessionLimits()`)
+// is rejected and logged; use `TryAddFlash()` to handle that error
+// yourself.
+//
+//	`aKind` The kind of message (e.g. "info" or "error").
+//	`aMessage` The message to add.
+func (so *TSession) AddFlash(aKind, aMessage string) *TSession {
+	if err := so.TryAddFlash(aKind, aMessage); nil != err {
+		log.Printf("sessions: can't add flash message: %v", err)
+	}
+
+	return so
+} // AddFlash()
+
+// FlashFuncs returns template functions to access the session's flash
+// messages:
+//
+//	`flashes` returns (and consumes) the messages of the given kind.
+//
+// The result can be passed to the `Funcs()` method of `html/template`
+// and `text/template` templates (usually of a clone of the parsed
+// template since the functions are bound to the session).
+func (so *TSession) FlashFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"flashes": so.Flashes,
+	}
+} // FlashFuncs()
+
+// Flashes returns and removes the session's flash messages of `aKind`.
+//
+// The messages are returned in the order they were added; if there
+// are none the method returns `nil`.
+//
+//	`aKind` The kind of messages to return.
+func (so *TSession) Flashes(aKind string) (rMessages []string) {
+	err := so.Update(func(aTx *TTransaction) error {
+		key := FlashPrefix + aKind
+		if list, ok := aTx.data[key].([]string); ok {
+			rMessages = append(rMessages, list...)
+			aTx.modify(key)
+			delete(aTx.data, key)
+		}
+		return nil
+	})
+	if nil != err {
+		// the messages weren't consumed, so they're shown later
+		log.Printf("sessions: can't consume flash messages: %v", err)
+		return nil
+	}
+
+	return
+} // Flashes()
+
+// TryAddFlash appends `aMessage` to the session's flash messages of
+// `aKind` returning an error if the message is rejected.
+//
+// If the message would exceed the session limits (see
+// `SetSessionLimits()`) it's not stored and an error wrapping
+// `ErrSessionLimit` is returned.
+//
+//	`aKind` The kind of message (e.g. "info" or "error").
+//	`aMessage` The message to add.
+func (so *TSession) TryAddFlash(aKind, aMessage string) error {
+	return so.Update(func(aTx *TTransaction) error {
+		key := FlashPrefix + aKind
+		list, _ := aTx.data[key].([]string)
+		aTx.modify(key)
+		// don't append to a slice shared with a stored copy
+		aTx.data[key] = append(list[:len(list):len(list)], aMessage)
+		return nil
+	})
+} // TryAddFlash()
+
+/* _EoF_ */
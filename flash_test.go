@@ -0,0 +1,112 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"errors"
+	"html/template"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTSession_Flashes(t *testing.T) {
+	store, _ := NewFileStore(t.TempDir())
+	soEngine = startMonitors(store, 2)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+
+	so.AddFlash("info", "eins").AddFlash("info", "zwei").AddFlash("error", "kaputt")
+	so.changeID() // the messages survive the SID rotation
+	if got, want := so.Flashes("info"), []string{"eins", "zwei"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Flashes(info) = %v, want %v", got, want)
+	}
+	if got := so.Flashes("info"); nil != got {
+		t.Errorf("Flashes(info) again = %v, want %v", got, nil)
+	}
+	if got, want := so.Flashes("error"), []string{"kaputt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Flashes(error) = %v, want %v", got, want)
+	}
+	if got := so.Len(); 0 != got {
+		t.Errorf("Len() = %v, want %v", got, 0)
+	}
+
+	// concurrent requests get each message exactly once
+	for i := 0; 100 > i; i++ {
+		so.AddFlash("info", strings.Repeat("x", i))
+	}
+	var (
+		mtx  sync.Mutex
+		seen = make(map[string]int)
+		wg   sync.WaitGroup
+	)
+	for w := 0; 4 > w; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; 10 > i; i++ {
+				for _, msg := range so.Flashes("info") {
+					mtx.Lock()
+					seen[msg]++
+					mtx.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if 100 != len(seen) {
+		t.Errorf("got %d distinct messages, want %d", len(seen), 100)
+	}
+	for msg, cnt := range seen {
+		if 1 != cnt {
+			t.Errorf("message %q seen %d times", msg, cnt)
+		}
+	}
+} // TestTSession_Flashes()
+
+func TestTSession_TryAddFlash(t *testing.T) {
+	defer SetSessionLimits(0, 0)
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+
+	SetSessionLimits(1, 0)
+	if err := so.TryAddFlash("info", "eins"); nil != err {
+		t.Errorf("TryAddFlash() error = %v", err)
+	}
+	if err := so.TryAddFlash("error", "kaputt"); !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("TryAddFlash() error = %v, want %v", err, ErrSessionLimit)
+	}
+	so.AddFlash("error", "kaputt") // logged
+	if got := so.Flashes("error"); nil != got {
+		t.Errorf("Flashes(error) = %v, want %v", got, nil)
+	}
+	if got, want := so.Flashes("info"), []string{"eins"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Flashes(info) = %v, want %v", got, want)
+	}
+} // TestTSession_TryAddFlash()
+
+func TestTSession_FlashFuncs(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	so.AddFlash("info", "Artikel <b>hinzugefügt</b>")
+
+	tpl := template.Must(template.New("page").
+		Funcs(template.FuncMap{"flashes": func(string) []string { return nil }}).
+		Parse(`{{range flashes "info"}}<p>{{.}}</p>{{end}}`))
+	var buf strings.Builder
+	if err := template.Must(tpl.Clone()).Funcs(so.FlashFuncs()).Execute(&buf, nil); nil != err {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got, want := buf.String(), "<p>Artikel &lt;b&gt;hinzugefügt&lt;/b&gt;</p>"; want != got {
+		t.Errorf("Execute() = %q, want %q", got, want)
+	}
+	if got := so.Flashes("info"); nil != got {
+		t.Errorf("Flashes() after Execute() = %v, want %v", got, nil)
+	}
+} // TestTSession_FlashFuncs()
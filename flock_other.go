@@ -0,0 +1,35 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package sessions
+
+import (
+	"os"
+)
+
+const (
+	// `flockSupported` tells whether `lockFile()` actually locks.
+	flockSupported = false
+)
+
+// `lockFile()` is a no-op on platforms without `flock(2)`.
+//
+//	`aFile` The file to lock.
+//	`aExclusive` Whether to acquire an exclusive (or a shared) lock.
+func lockFile(aFile *os.File, aExclusive bool) error {
+	return nil
+} // lockFile()
+
+// `unlockFile()` is a no-op on platforms without `flock(2)`.
+//
+//	`aFile` The file to unlock.
+func unlockFile(aFile *os.File) error {
+	return nil
+} // unlockFile()
+
+/* _EoF_ */
@@ -0,0 +1,48 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	// `flockSupported` tells whether `lockFile()` actually locks.
+	flockSupported = true
+)
+
+// `lockFile()` acquires an advisory lock on `aFile`.
+//
+// The function blocks until the lock is granted.
+//
+//	`aFile` The file to lock.
+//	`aExclusive` Whether to acquire an exclusive (or a shared) lock.
+func lockFile(aFile *os.File, aExclusive bool) (rErr error) {
+	how := syscall.LOCK_SH
+	if aExclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		if rErr = syscall.Flock(int(aFile.Fd()), how); syscall.EINTR != rErr {
+			return
+		}
+	}
+} // lockFile()
+
+// `unlockFile()` releases the advisory lock on `aFile`.
+//
+//	`aFile` The file to unlock.
+func unlockFile(aFile *os.File) error {
+	return syscall.Flock(int(aFile.Fd()), syscall.LOCK_UN)
+} // unlockFile()
+
+/* _EoF_ */
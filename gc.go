@@ -0,0 +1,243 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the garbage collector removing expired sessions
+ * from the store.
+ *
+ * The GC walks the store incrementally: expired sessions are handed
+ * to the session monitors in batches (instead of one request per
+ * session), and the number of sessions examined per second can be
+ * limited to keep the I/O load of large stores down.
+ */
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// TGCStats are the statistics of a garbage collector run.
+	TGCStats struct {
+		Started  time.Time     // when the run started
+		Duration time.Duration // how long the run took
+		Scanned  int           // number of sessions examined
+		Expired  int           // number of expired sessions removed
+		Errors   int           // number of errors encountered
+	}
+)
+
+var (
+	// `soGCBatchSize` is the number of sessions the GC handles at
+	// once (zero: default).
+	soGCBatchSize int64
+
+	// `soGCRate` is the max. number of sessions the GC examines per
+	// second (zero: unlimited).
+	soGCRate int64
+
+	// `soGCStats` are the statistics of the latest GC run
+	// (guarded by `soGCStatsMtx`).
+	soGCStats TGCStats
+
+	// `soGCStatsMtx` guards `soGCStats`.
+	soGCStatsMtx sync.Mutex
+)
+
+// GCBatchSize returns the number of sessions the garbage collector
+// handles at once.
+func GCBatchSize() int {
+	if result := atomic.LoadInt64(&soGCBatchSize); 0 < result {
+		return int(result)
+	}
+
+	return 100
+} // GCBatchSize()
+
+// GCRate returns the max. number of sessions the garbage collector
+// examines per second (zero means unlimited).
+func GCRate() int {
+	return int(atomic.LoadInt64(&soGCRate))
+} // GCRate()
+
+// GCStats returns the statistics of the latest completed run of the
+// garbage collector.
+func GCStats() TGCStats {
+	soGCStatsMtx.Lock()
+	defer soGCStatsMtx.Unlock()
+
+	return soGCStats
+} // GCStats()
+
+// SetGCBatchSize sets the number of sessions the garbage collector
+// handles at once.
+//
+// The expired sessions found are handed to the session monitors in
+// batches of that size, and the rate limit (see `SetGCRate()`) is
+// applied after each batch of sessions examined.
+//
+//	`aSize` The batch size; zero selects the default of 100.
+func SetGCBatchSize(aSize int) error {
+	if 0 > aSize {
+		return fmt.Errorf("sessions: invalid GC batch size %d", aSize)
+	}
+	atomic.StoreInt64(&soGCBatchSize, int64(aSize))
+
+	return nil
+} // SetGCBatchSize()
+
+// SetGCRate limits the number of sessions the garbage collector
+// examines per second.
+//
+// With lots of sessions in a file based store this keeps the GC
+// from hogging the I/O; a run then takes (at least) the number of
+// stored sessions divided by `aRate` seconds.
+//
+//	`aRate` The max. number of sessions per second; zero means unlimited.
+func SetGCRate(aRate int) error {
+	if 0 > aRate {
+		return fmt.Errorf("sessions: invalid GC rate %d", aRate)
+	}
+	atomic.StoreInt64(&soGCRate, int64(aRate))
+
+	return nil
+} // SetGCRate()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `expireSessions()` removes the expired sessions `aSIDs`.
+//
+// The session monitors drop the sessions from their caches (unless
+// they're still in use) and return the ones to delete from the store.
+//
+//	`aStore` The store holding the session records.
+//	`aEngine` The engine handling the session requests.
+//	`aSIDs` The IDs of the expired sessions.
+func expireSessions(aStore TStore, aEngine tShEngine, aSIDs []string) (rExpired, rErrors int) {
+	shards := make([]map[string]*tSessionRecord, aEngine.shards())
+	hooks := hooksActive()
+	for _, sid := range aSIDs {
+		idx := aEngine.shard(sid)
+		if nil == shards[idx] {
+			shards[idx] = make(map[string]*tSessionRecord)
+		}
+		shards[idx][sid] = nil
+		if hooks {
+			// provide the session data for the `EventExpired` hooks
+			if buf, err := loadExpired(aStore, sid); nil == err {
+				shards[idx][sid], _ = decodeRecord(buf)
+			}
+			// don't hold the session while waiting for the engine
+			releaseSession(aStore, sid)
+		}
+	}
+
+	for idx, records := range shards {
+		if nil == records {
+			continue
+		}
+		sids, _ := aEngine.requestShard(idx, tShRequest{
+			rType:  smExpireSessions,
+			rValue: records,
+		}).sValue.([]string)
+
+		for _, sid := range sids {
+			if err := aStore.Delete(sid); nil != err {
+				rErrors++
+				continue
+			}
+			rExpired++
+		}
+	}
+
+	return
+} // expireSessions()
+
+// `goGC()` removes the expired sessions from `aStore`.
+//
+// The store is walked incrementally, handling `GCBatchSize()`
+// sessions at once and examining at most `GCRate()` sessions per
+// second.
+// The run's statistics are available by `GCStats()` afterwards.
+//
+//	`aStore` The store holding the session records.
+//	`aEngine` The engine handling the session requests.
+func goGC(aStore TStore, aEngine tShEngine) {
+	stats := TGCStats{Started: time.Now()}
+	size, rate := GCBatchSize(), GCRate()
+	batch := make([]string, 0, size)
+
+	flush := func() {
+		if 0 < len(batch) {
+			expired, errors := expireSessions(aStore, aEngine, batch)
+			stats.Expired += expired
+			stats.Errors += errors
+			batch = batch[:0]
+		}
+	}
+	check := func(aSID string, aExpires time.Time, aErr error) bool {
+		stats.Scanned++
+		if nil != aErr {
+			stats.Errors++
+		} else if !aExpires.After(stats.Started) {
+			if batch = append(batch, aSID); size <= len(batch) {
+				flush()
+			}
+		}
+		if (0 < rate) && (0 == stats.Scanned%size) {
+			// stay within the rate limit
+			due := stats.Started.Add(time.Duration(stats.Scanned) * time.Second / time.Duration(rate))
+			if pause := time.Until(due); 0 < pause {
+				time.Sleep(pause)
+			}
+		}
+		return true
+	}
+
+	var err error
+	if walker, ok := aStore.(TWalkStore); ok {
+		err = walker.Walk(check)
+	} else {
+		// we only get to see the expired sessions
+		err = aStore.Scan(stats.Started, func(aSID string) bool {
+			return check(aSID, stats.Started, nil)
+		})
+	}
+	if nil != err {
+		stats.Errors++
+		log.Printf("sessions: GC can't scan the store: %v", err)
+	}
+	flush()
+	stats.Duration = time.Since(stats.Started)
+
+	soGCStatsMtx.Lock()
+	soGCStats = stats
+	soGCStatsMtx.Unlock()
+} // goGC()
+
+// `loadExpired()` returns the (expired) session record of `aSID`.
+//
+// Stores whose `Load()` skips expired records must implement the
+// `TExpiredStore` interface to provide the data; otherwise `Load()`
+// is used.
+//
+//	`aStore` The store holding the session records.
+//	`aSID` The ID of the expired session.
+func loadExpired(aStore TStore, aSID string) ([]byte, error) {
+	if es, ok := aStore.(TExpiredStore); ok {
+		return es.LoadExpired(aSID)
+	}
+
+	return aStore.Load(aSID)
+} // loadExpired()
+
+/* _EoF_ */
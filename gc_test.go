@@ -0,0 +1,86 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// `storeExpired()` writes `aCount` sessions expired a second ago.
+func storeExpired(aStore TStore, aCount int) {
+	for i := 0; aCount > i; i++ {
+		record := newRecord(newSID() + strconv.Itoa(i))
+		record.data["Zahl"] = i
+		record.expires = time.Now().Add(-time.Second)
+		buf, _ := encodeRecord(record)
+		_ = aStore.Store(record.sID, buf, record.expires)
+	}
+} // storeExpired()
+
+// `waitGC()` waits for the GC run started by the session monitor
+// to report `aScanned` sessions.
+func waitGC(aScanned int) TGCStats {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		if result := GCStats(); aScanned == result.Scanned {
+			return result
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return GCStats()
+} // waitGC()
+
+func Test_goGC(t *testing.T) {
+	defer SetGCBatchSize(0)
+	store, _ := NewFileStore(t.TempDir())
+	_ = SetGCBatchSize(2)
+
+	storeExpired(store, 5)
+	for i := 0; 3 > i; i++ {
+		goStore(store, newRecord(newSID()))
+	}
+	_ = os.WriteFile(store.fileName("kaputt"), []byte("kaputt"), 0600)
+
+	// the monitor runs the GC when it starts
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+	got := waitGC(9)
+	if (9 != got.Scanned) || (6 != got.Expired) || (0 != got.Errors) {
+		t.Errorf("GCStats() = %+v, want 9 scanned, 6 expired", got)
+	}
+	if files, _ := filepath.Glob(store.dir + "/*.sid"); 3 != len(files) {
+		t.Errorf("%d session files left, want %d", len(files), 3)
+	}
+} // Test_goGC()
+
+func Test_goGC_rate(t *testing.T) {
+	defer SetGCBatchSize(0)
+	defer SetGCRate(0)
+	store, _ := NewFileStore(t.TempDir())
+	if err := SetGCRate(-1); nil == err {
+		t.Error("SetGCRate(-1): no error")
+	}
+	if err := SetGCBatchSize(-1); nil == err {
+		t.Error("SetGCBatchSize(-1): no error")
+	}
+	_ = SetGCBatchSize(2)
+	_ = SetGCRate(100)
+
+	storeExpired(store, 10)
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+	got := waitGC(10)
+	if (10 != got.Scanned) || (10 != got.Expired) {
+		t.Errorf("GCStats() = %+v, want 10 scanned and expired", got)
+	}
+	if 90*time.Millisecond > got.Duration {
+		t.Errorf("GCStats().Duration = %v, want >= %v", got.Duration, 100*time.Millisecond)
+	}
+} // Test_goGC_rate()
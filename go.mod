@@ -1,3 +1,3 @@
 module github.com/mwat56/sessions
 
-go 1.17
+go 1.18
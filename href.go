@@ -45,14 +45,14 @@ var (
 //
 // `aData` The web/http response.
 func (hr *tHRefWriter) appendSID(aData []byte) []byte {
-	so := &TSession{sID: hr.sID}
-	if so.Empty() {
-		return aData
-	}
 	linkMatches := soHrefRE.FindAllSubmatch(aData, -1)
 	if nil == linkMatches {
 		return aData
 	}
+	// asking the session monitor is more expensive than the regex
+	if (&TSession{sID: hr.sID}).Empty() {
+		return aData
+	}
 	cgi := fmt.Sprintf("%s=%s", soSidName, hr.sID)
 	/*
 		There are three cases to consider:
@@ -13,7 +13,7 @@ import (
 func Test_tHRefWriter_appendSID(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	h1 := tHRefWriter{sID: sid}
 	ExcludePaths("css", "thumb/")
@@ -0,0 +1,201 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the limits of a single session's data.
+ *
+ * The limits are checked by the session monitor whenever values are
+ * set (`smSetKey`, `smSetMany`, `smUpdateSession`); a write making
+ * the session exceed a limit is rejected (and counted in
+ * `TCacheStats.Rejected`) while the session's data stay unchanged.
+ *
+ * A session's size is the sum of its values' sizes, each value being
+ * encoded (along with its key) on its own.  The sizes are kept with
+ * the session record, so a write needs to encode just the values it
+ * changes.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	// ErrSessionLimit is returned when setting a value would exceed
+	// the session limits (see `SetSessionLimits()`).
+	ErrSessionLimit = errors.New("sessions: session limit exceeded")
+
+	// `soSessionMaxKeys` is the max. number of values per session
+	// (zero: unlimited).
+	soSessionMaxKeys int64
+
+	// `soSessionMaxBytes` is the max. encoded size of a session's
+	// values (zero: unlimited).
+	soSessionMaxBytes int64
+)
+
+// SessionLimits returns the max. number of values per session and the
+// max. encoded size of a session's values; zero means unlimited.
+func SessionLimits() (rMaxKeys int, rMaxBytes int64) {
+	return int(atomic.LoadInt64(&soSessionMaxKeys)),
+		atomic.LoadInt64(&soSessionMaxBytes)
+} // SessionLimits()
+
+// SetSessionLimits limits the data of each single session.
+//
+// Setting values which would make a session exceed a limit is
+// rejected: `TrySet()`, `SetCtx()` and `Update()` return an error
+// wrapping `ErrSessionLimit` while `Set()` and `SetMany()` log it.
+// The size is the sum of the values' sizes, each value encoded along
+// with its key by the configured codec (see `SetCodec()`), i.e. before
+// compression and encryption.
+// Sessions already exceeding a new limit are kept; only writes making
+// them grow further are rejected.
+//
+//	`aMaxKeys` The max. number of values; zero means unlimited.
+//	`aMaxBytes` The max. encoded size in bytes; zero means unlimited.
+func SetSessionLimits(aMaxKeys int, aMaxBytes int64) {
+	if 0 > aMaxKeys {
+		aMaxKeys = 0
+	}
+	if 0 > aMaxBytes {
+		aMaxBytes = 0
+	}
+	atomic.StoreInt64(&soSessionMaxKeys, int64(aMaxKeys))
+	atomic.StoreInt64(&soSessionMaxBytes, aMaxBytes)
+} // SetSessionLimits()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `dataSize()` returns the encoded size of the record's values (see
+// `encodedSize()`).
+//
+// The values' sizes are computed once and then kept up to date by
+// `setValues()`.
+func (sr *tSessionRecord) dataSize() int64 {
+	if codec := Codec(); (nil == sr.sizes) || (codec != sr.sizeCodec) {
+		sr.sizes = make(map[string]int64, len(sr.data))
+		sr.size, sr.sizeCodec = 0, codec
+		for key, value := range sr.data {
+			size := entrySize(key, value)
+			sr.sizes[key] = size
+			sr.size += size
+		}
+	}
+
+	return sr.size
+} // dataSize()
+
+// `encodedSize()` returns the encoded size of the values `aData`,
+// i.e. the sum of their sizes (see `entrySize()`).
+//
+//	`aData` The session data to inspect.
+func encodedSize(aData tSessionData) (rSize int64) {
+	for key, value := range aData {
+		rSize += entrySize(key, value)
+	}
+
+	return
+} // encodedSize()
+
+// `entrySize()` returns the size of the value `aValue` encoded along
+// with its key `aKey` by the configured codec.
+//
+// If the value can't be encoded its estimated memory usage is
+// returned instead.
+//
+//	`aKey` The value's identifier.
+//	`aValue` The value to inspect.
+func entrySize(aKey string, aValue interface{}) int64 {
+	buf, err := Codec().encode(tSessionData{aKey: aValue})
+	if nil != err {
+		return int64(len(aKey)) + valueSize(aValue)
+	}
+
+	return int64(len(buf))
+} // entrySize()
+
+// `sessionLimited()` returns whether any session limit is set.
+func sessionLimited() bool {
+	maxKeys, maxBytes := SessionLimits()
+
+	return (0 < maxKeys) || (0 < maxBytes)
+} // sessionLimited()
+
+// `setValues()` sets the values of `aKeys` to those in `aData` (a key
+// missing in `aData` removing the value) unless that makes the session
+// exceed a limit and grow in that respect; then an error wrapping
+// `ErrSessionLimit` is returned and the session remains unchanged.
+//
+// Only the values of `aKeys` are encoded to check the session's size.
+//
+//	`aData` The new values.
+//	`aKeys` The identifiers of the values to set (or remove).
+func (sr *tSessionRecord) setValues(aData tSessionData, aKeys []string) error {
+	maxKeys, maxBytes := SessionLimits()
+	if 0 < maxKeys {
+		count := len(sr.data)
+		for _, key := range aKeys {
+			_, had := sr.data[key]
+			_, has := aData[key]
+			if had && !has {
+				count--
+			} else if has && !had {
+				count++
+			}
+		}
+		if (maxKeys < count) && (len(sr.data) < count) {
+			return fmt.Errorf("%w: more than %d values", ErrSessionLimit, maxKeys)
+		}
+	}
+
+	var sizes map[string]int64
+	size := int64(0)
+	if 0 < maxBytes {
+		current := sr.dataSize()
+		size = current
+		sizes = make(map[string]int64, len(aKeys))
+		for _, key := range aKeys {
+			size -= sr.sizes[key]
+			if value, ok := aData[key]; ok {
+				sizes[key] = entrySize(key, value)
+				size += sizes[key]
+			}
+		}
+		if (maxBytes < size) && (current < size) {
+			return fmt.Errorf("%w: %d bytes exceed %d bytes",
+				ErrSessionLimit, size, maxBytes)
+		}
+	} else {
+		sr.sizes = nil // not maintained without a size limit
+	}
+
+	for _, key := range aKeys {
+		if value, ok := aData[key]; ok {
+			sr.data[key] = value
+		} else {
+			delete(sr.data, key)
+		}
+		if nil != sr.sizes {
+			if size, ok := sizes[key]; ok {
+				sr.sizes[key] = size
+			} else {
+				delete(sr.sizes, key)
+			}
+		}
+	}
+	if nil != sr.sizes {
+		sr.size = size
+	}
+
+	return nil
+} // setValues()
+
+/* _EoF_ */
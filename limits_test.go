@@ -0,0 +1,133 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetSessionLimits(t *testing.T) {
+	defer SetSessionLimits(0, 0)
+
+	SetSessionLimits(-1, 1024)
+	if maxKeys, maxBytes := SessionLimits(); (0 != maxKeys) || (1024 != maxBytes) {
+		t.Errorf("SessionLimits() = %d, %d, want %d, %d", maxKeys, maxBytes, 0, 1024)
+	}
+	SetSessionLimits(0, 0)
+	if sessionLimited() {
+		t.Error("sessionLimited() = true, want false")
+	}
+} // TestSetSessionLimits()
+
+func TestTSession_TrySet(t *testing.T) {
+	defer SetSessionLimits(0, 0)
+	soEngine = startMonitors(NewMemoryStore("", 0), 2)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	rejected := CacheStats().Rejected
+
+	SetSessionLimits(2, 0)
+	_ = so.TrySet("eins", 1)
+	_ = so.TrySet("zwei", 2)
+	if err := so.TrySet("drei", 3); !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("TrySet() error = %v, want %v", err, ErrSessionLimit)
+	}
+	if err := so.TrySet("zwei", 22); nil != err {
+		t.Errorf("TrySet() of existing key error = %v", err)
+	}
+	if err := so.SetCtx(context.Background(), "drei", 3); !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("SetCtx() error = %v, want %v", err, ErrSessionLimit)
+	}
+	so.SetMany(map[string]interface{}{"eins": 11, "drei": 3})
+	if got := so.Get("eins"); 1 != got {
+		t.Errorf("Get() after rejected SetMany() = %v, want %v", got, 1)
+	}
+
+	SetSessionLimits(0, 256)
+	if err := so.TrySet("eins", strings.Repeat("x", 512)); !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("TrySet() error = %v, want %v", err, ErrSessionLimit)
+	}
+	so.Set("eins", strings.Repeat("x", 512))
+	if got := so.Get("eins"); 1 != got {
+		t.Errorf("Get() after rejected Set() = %v, want %v", got, 1)
+	}
+	err := so.Update(func(aTx *TTransaction) error {
+		aTx.Set("drei", strings.Repeat("x", 512))
+		return nil
+	})
+	if !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("Update() error = %v, want %v", err, ErrSessionLimit)
+	}
+	if got := so.Len(); 2 != got {
+		t.Errorf("Len() = %v, want %v", got, 2)
+	}
+	if got := CacheStats().Rejected - rejected; 6 != got {
+		t.Errorf("Rejected = %v, want %v", got, 6)
+	}
+} // TestTSession_TrySet()
+
+func TestTSession_TrySet_shrink(t *testing.T) {
+	defer SetSessionLimits(0, 0)
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+
+	so.Set("eins", strings.Repeat("x", 512)).Set("zwei", 2).Set("drei", 3)
+	SetSessionLimits(2, 256) // lowered below the current data
+
+	if err := so.TrySet("eins", "x"); nil != err {
+		t.Errorf("TrySet() shrinking error = %v", err)
+	}
+	if err := so.TrySet("vier", 4); !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("TrySet() error = %v, want %v", err, ErrSessionLimit)
+	}
+	so.Delete("drei")
+	if err := so.TrySet("vier", 4); !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("TrySet() error = %v, want %v", err, ErrSessionLimit)
+	}
+	if err := so.TrySet("zwei", 22); nil != err {
+		t.Errorf("TrySet() error = %v", err)
+	}
+} // TestTSession_TrySet_shrink()
+
+func TestTSession_TrySet_sizes(t *testing.T) {
+	defer SetSessionLimits(0, 0)
+	le := startLockEngine(NewMemoryStore("", 0), 1)
+	soEngine = le
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	check := func(aStep string) {
+		le.stripes[0].mtx.Lock()
+		defer le.stripes[0].mtx.Unlock()
+		record := le.stripes[0].monitor.cache.peek(so.sID)
+		if nil == record.sizes {
+			t.Fatalf("%s: sizes not kept", aStep)
+		}
+		if want := encodedSize(record.data); want != record.size {
+			t.Errorf("%s: size = %d, want %d", aStep, record.size, want)
+		}
+	}
+
+	SetSessionLimits(0, 1<<20)
+	so.Set("eins", 1).Set("zwei", "zwei")
+	check("Set")
+	so.SetMany(map[string]interface{}{"eins": "eins", "drei": []int{1, 2, 3}})
+	check("SetMany")
+	so.Delete("zwei")
+	check("Delete")
+	_ = so.Update(func(aTx *TTransaction) error {
+		aTx.Delete("eins")
+		aTx.Set("vier", strings.Repeat("x", 100))
+		aTx.Set("vier", 4)
+		return nil
+	})
+	check("Update")
+	so.Clear().Set("fünf", 5)
+	check("Clear")
+} // TestTSession_TrySet_sizes()
@@ -0,0 +1,247 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the lock based engine handling the session
+ * requests (`EngineLocks`).
+ *
+ * The sessions are partitioned by a hash of their IDs, each partition
+ * being guarded by a mutex of its own.  A request locks the partition
+ * of its session and is handled right away by the calling goroutine,
+ * i.e. without any channel round-trips.
+ *
+ * Store I/O is done without holding the partition's lock: a session
+ * not cached is read while the lock is released (with requests for
+ * that very session waiting until it's loaded, while requests for
+ * the other sessions of the partition go on), and the records are
+ * written by goroutines of their own or after the lock is released.
+ *
+ * The periodic tasks (cache sweeps, garbage collection and snapshots)
+ * are done by a single housekeeping goroutine.
+ */
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// `tLockEngine` holds the mutex guarded session partitions.
+	tLockEngine struct {
+		stripes []tLockStripe
+		done    chan struct{} // closed to stop the housekeeping
+		once    sync.Once     // guards closing `done`
+	}
+
+	// `tLockStripe` is a single partition of the sessions.
+	tLockStripe struct {
+		mtx     sync.Mutex
+		monitor *tShMonitor
+		loading map[string]chan struct{} // closed when loaded
+	}
+)
+
+// `startLockEngine()` sets up `aCount` session partitions using
+// `aStore` and starts the housekeeping goroutine.
+//
+//	`aStore` The store holding the session records.
+//	`aCount` The number of partitions.
+func startLockEngine(aStore TStore, aCount int) *tLockEngine {
+	if 0 >= aCount {
+		aCount = 1
+	}
+	result := &tLockEngine{
+		stripes: make([]tLockStripe, aCount),
+		done:    make(chan struct{}),
+	}
+	restored := restoreSessions(aStore)
+	for idx := range result.stripes {
+		result.stripes[idx].monitor = newMonitor(aStore, result, idx, restored)
+		result.stripes[idx].loading = make(map[string]chan struct{})
+	}
+	if memStore, ok := aStore.(*TMemoryStore); ok {
+		// available right away for `Close()`
+		memStore.engine.Store(tEngineRef{result})
+	}
+	go result.goHousekeeping(aStore)
+
+	return result
+} // startLockEngine()
+
+// `goHousekeeping()` does the periodic tasks: sweeping the caches,
+// running the garbage collector and writing snapshots.
+//
+//	`aStore` The store holding the session records.
+func (le *tLockEngine) goHousekeeping(aStore TStore) {
+	collect := gcCollector(aStore, le)
+	collect() // cleanup old session records
+
+	configChange := configNotify()
+	gcTimer := time.NewTimer(gcDelay())
+	defer gcTimer.Stop()
+
+	var snapTicker <-chan time.Time // `nil` blocks forever
+	memStore, memOnly := aStore.(*TMemoryStore)
+	if memOnly {
+		if ("" != memStore.fileName) && (0 < memStore.interval) {
+			ticker := time.NewTicker(memStore.interval)
+			defer ticker.Stop()
+			snapTicker = ticker.C
+		}
+		defer memStore.engine.Store(tEngineRef{})
+	}
+
+	for {
+		select {
+		case <-le.done:
+			return
+
+		case <-gcTimer.C:
+			now := time.Now()
+			for idx := range le.stripes {
+				stripe := &le.stripes[idx]
+				stripe.mtx.Lock()
+				stripe.monitor.cache.sweep(now)
+				stripe.mtx.Unlock()
+			}
+			collect()
+			gcTimer.Reset(gcDelay())
+
+		case <-configChange:
+			configChange = configNotify()
+			if !gcTimer.Stop() {
+				select {
+				case <-gcTimer.C:
+				default:
+				}
+			}
+			gcTimer.Reset(gcDelay())
+
+		case <-snapTicker:
+			go goSnapshot(memStore, le)
+		}
+	}
+} // goHousekeeping()
+
+// `load()` reads the session of `aRequest` from the store if its
+// handling needs it but it isn't cached.  The partition's lock is
+// released while reading; requests for a session being read wait
+// until it's done.
+//
+// The partition's lock has to be held when calling and is held again
+// when returning.
+//
+//	`aRequest` The request to prepare.
+func (ls *tLockStripe) load(aRequest tShRequest) {
+	sid := aRequest.rSID
+	for {
+		done, busy := ls.loading[sid]
+		if !busy {
+			break
+		}
+		ls.mtx.Unlock()
+		<-done
+		ls.mtx.Lock()
+	}
+	if !ls.monitor.needsLoad(aRequest) {
+		return
+	}
+
+	done := make(chan struct{})
+	ls.loading[sid] = done
+	ls.mtx.Unlock()
+	record, found := loadRecord(ls.monitor.store, sid)
+	ls.mtx.Lock()
+	delete(ls.loading, sid)
+	close(done)
+
+	ls.monitor.preload(record, found)
+} // load()
+
+// `request()` handles `aRequest` in the partition of its session.
+//
+// Part of the `tShEngine` interface.
+//
+//	`aRequest` The request to handle.
+func (le *tLockEngine) request(aRequest tShRequest) *TSession {
+	return le.requestShard(le.shard(aRequest.rSID), aRequest)
+} // request()
+
+// `requestCtx()` handles `aRequest` in the partition of its session
+// unless `aCtx` is done before.
+//
+// Since waiting for a mutex can't be cancelled the request is handled
+// by a goroutine of its own.
+//
+// Part of the `tShEngine` interface.
+//
+//	`aCtx` The context bounding the request.
+//	`aRequest` The request to handle.
+func (le *tLockEngine) requestCtx(aCtx context.Context, aRequest tShRequest) (*TSession, error) {
+	// buffered so the goroutine ends even if we gave up waiting
+	answer := make(chan *TSession, 1)
+	go func() {
+		answer <- le.request(aRequest)
+	}()
+
+	select {
+	case result := <-answer:
+		return result, nil
+	case <-aCtx.Done():
+		return nil, aCtx.Err()
+	}
+} // requestCtx()
+
+// `requestShard()` handles `aRequest` in the partition `aShard`.
+//
+// Part of the `tShEngine` interface.
+//
+//	`aShard` The index of the partition.
+//	`aRequest` The request to handle.
+func (le *tLockEngine) requestShard(aShard int, aRequest tShRequest) *TSession {
+	stripe := &le.stripes[aShard]
+	stripe.mtx.Lock()
+	stripe.load(aRequest)
+	result, after := stripe.monitor.handle(aRequest)
+	stripe.mtx.Unlock()
+
+	if nil != after {
+		after()
+	}
+
+	return result
+} // requestShard()
+
+// `shard()` returns the partition of the session `aSID`.
+//
+// Part of the `tShEngine` interface.
+//
+//	`aSID` The session ID.
+func (le *tLockEngine) shard(aSID string) int {
+	return shardIndex(aSID, len(le.stripes))
+} // shard()
+
+// `shards()` returns the number of partitions.
+//
+// Part of the `tShEngine` interface.
+func (le *tLockEngine) shards() int {
+	return len(le.stripes)
+} // shards()
+
+// `terminate()` stops the housekeeping goroutine.
+//
+// Part of the `tShEngine` interface.
+func (le *tLockEngine) terminate() {
+	le.once.Do(func() {
+		close(le.done)
+	})
+} // terminate()
+
+/* _EoF_ */
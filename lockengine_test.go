@@ -0,0 +1,232 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetEngine(t *testing.T) {
+	defer SetEngine(EngineChannels)
+	if got := Engine(); EngineChannels != got {
+		t.Errorf("Engine() = %v, want %v", got, EngineChannels)
+	}
+	if err := SetEngine(TEngine(2)); nil == err {
+		t.Error("SetEngine(2): no error")
+	}
+	_ = SetEngine(EngineLocks)
+	if got := Engine(); EngineLocks != got {
+		t.Errorf("Engine() = %v, want %v", got, EngineLocks)
+	}
+	if got := EngineLocks.String(); "locks" != got {
+		t.Errorf("String() = %q, want %q", got, "locks")
+	}
+	if got := TEngine(7).String(); "unknown" != got {
+		t.Errorf("String() = %q, want %q", got, "unknown")
+	}
+} // TestSetEngine()
+
+func Test_startLockEngine(t *testing.T) {
+	store, _ := NewFileStore(t.TempDir())
+	storeExpired(store, 5)
+
+	// the housekeeping runs the GC when it starts
+	soEngine = startLockEngine(store, 4)
+	defer stopSession()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		files, _ := filepath.Glob(store.dir + "/*.sid")
+		if 0 == len(files) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d expired session files left, want %d", len(files), 0)
+		}
+	}
+
+	// the session data move along with the changing IDs
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 1)
+	moved := false
+	for i := 0; 20 > i; i++ {
+		old := so.sID
+		so.changeID()
+		moved = moved || (soEngine.shard(old) != soEngine.shard(so.sID))
+		if got, _ := so.GetInt("Zahl"); 1 != got {
+			t.Fatalf("GetInt() after changeID() = %v, want %v", got, 1)
+		}
+	}
+	if !moved {
+		t.Error("changeID() never moved the session to another partition")
+	}
+
+	for i := 0; 100 > i; i++ {
+		(&TSession{sID: newSID()}).Set("Zahl", i)
+	}
+	if got := CacheStats().Entries; 101 != got {
+		t.Errorf("CacheStats().Entries = %d, want %d", got, 101)
+	}
+} // Test_startLockEngine()
+
+func Test_startLockEngine_memory(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "sessions.snapshot")
+	ms := NewMemoryStore(fName, 0)
+	soEngine = startLockEngine(ms, 4)
+	sids := make([]string, 20)
+	for idx := range sids {
+		sids[idx] = newSID()
+		(&TSession{sID: sids[idx]}).Set("Zahl", idx)
+	}
+	if err := ms.Close(); nil != err {
+		t.Fatalf("Close() error = %v", err)
+	}
+	stopSession()
+
+	// the snapshot is read by either engine
+	ms = NewMemoryStore(fName, 0)
+	soEngine = startMonitors(ms, 3)
+	defer stopSession()
+	for idx, sid := range sids {
+		if got, _ := (&TSession{sID: sid}).GetInt("Zahl"); int64(idx) != got {
+			t.Errorf("GetInt() = %v, want %v", got, idx)
+		}
+	}
+} // Test_startLockEngine_memory()
+
+// `tSlowStore` is a store whose `Load()` of the session `sid` reports
+// to `started` and blocks until `release` is closed.
+type tSlowStore struct {
+	TStore
+	sid     string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (ss tSlowStore) Load(aSID string) ([]byte, error) {
+	if aSID == ss.sid {
+		ss.started <- struct{}{}
+		<-ss.release
+	}
+
+	return ss.TStore.Load(aSID)
+} // Load()
+
+func Test_tLockEngine_load(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if nil != err {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	slow := &TSession{sID: newSID()}
+	store := tSlowStore{fs, slow.sID, make(chan struct{}, 2), make(chan struct{})}
+	soEngine = startLockEngine(store, 1)
+	defer stopSession()
+
+	loaded := make(chan int, 2)
+	go func() {
+		loaded <- slow.Len()
+	}()
+	<-store.started
+	go func() {
+		slow.Set("Zahl", 1) // waits for the session being loaded
+		loaded <- slow.Len()
+	}()
+
+	// a session of the same partition isn't blocked by the slow load
+	so := &TSession{sID: newSID()}
+	done := make(chan struct{})
+	go func() {
+		so.Set("Zahl", 2)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Set() blocked by the load of another session")
+	}
+	if got := so.Get("Zahl"); 2 != got {
+		t.Errorf("Get() = %v, want %v", got, 2)
+	}
+	select {
+	case got := <-loaded:
+		t.Fatalf("Len() = %v before the session was loaded", got)
+	default:
+	}
+
+	close(store.release)
+	if got := <-loaded + <-loaded; (1 != got) && (2 != got) {
+		t.Errorf("Len() sum = %v, want 1 or 2", got)
+	}
+	if got := slow.Get("Zahl"); 1 != got {
+		t.Errorf("Get() = %v, want %v", got, 1)
+	}
+	if got := CacheStats().Misses; 2 != got {
+		t.Errorf("CacheStats().Misses = %d, want %d", got, 2)
+	}
+} // Test_tLockEngine_load()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `benchmarkEngine()` runs parallel session requests against the
+// engine `aEngine`; with `aShared == true` all goroutines use the
+// same session (i.e. they contend for the same partition).
+func benchmarkEngine(b *testing.B, aEngine TEngine, aShared bool, aBody func(*TSession, int)) {
+	store := NewMemoryStore("", 0)
+	if EngineLocks == aEngine {
+		soEngine = startLockEngine(store, 4)
+	} else {
+		soEngine = startMonitors(store, 4)
+	}
+	defer stopSession()
+	shared := &TSession{sID: newSID()}
+	shared.Set("Zahl", 0)
+	var mtx sync.Mutex
+	worker := 0
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		so := shared
+		if !aShared {
+			mtx.Lock()
+			worker++
+			so = &TSession{sID: newSID() + strconv.Itoa(worker)}
+			mtx.Unlock()
+			so.Set("Zahl", 0)
+		}
+		for i := 0; pb.Next(); i++ {
+			aBody(so, i)
+		}
+	})
+} // benchmarkEngine()
+
+// `benchmarkEngines()` runs `aBody` against both engines, with
+// a shared session and with distinct sessions.
+func benchmarkEngines(b *testing.B, aBody func(*TSession, int)) {
+	for _, engine := range []TEngine{EngineChannels, EngineLocks} {
+		engine := engine
+		b.Run(engine.String()+"/same-session", func(b *testing.B) {
+			benchmarkEngine(b, engine, true, aBody)
+		})
+		b.Run(engine.String()+"/distinct-sessions", func(b *testing.B) {
+			benchmarkEngine(b, engine, false, aBody)
+		})
+	}
+} // benchmarkEngines()
+
+func BenchmarkGet(b *testing.B) {
+	benchmarkEngines(b, func(aSession *TSession, aIdx int) {
+		_, _ = aSession.GetInt("Zahl")
+	})
+} // BenchmarkGet()
+
+func BenchmarkSet(b *testing.B) {
+	benchmarkEngines(b, func(aSession *TSession, aIdx int) {
+		aSession.Set("Zahl", aIdx)
+	})
+} // BenchmarkSet()
@@ -0,0 +1,549 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides a session store appending all session records
+ * to a segmented log.
+ *
+ * Each log entry consists of a fixed-size header followed by the
+ * session ID and the encoded session record:
+ *
+ *	offset  size  content
+ *	     0     4  CRC-32 (IEEE) of all following bytes of the entry
+ *	     4     1  operation (`leStore` or `leDelete`)
+ *	     5     2  length of the session ID (`n`)
+ *	     7     8  expiry time (Unix nanoseconds)
+ *	    15     4  length of the session record (`m`)
+ *	    19     n  session ID
+ *	  19+n     m  session record
+ *
+ * All numbers are stored in big-endian byte order.
+ *
+ * New entries are always appended to the active (i.e. newest)
+ * segment. An in-memory index maps each session ID to the position
+ * of its latest entry. When opening the store the index is rebuilt
+ * by replaying all segments in order; an incomplete entry at the end
+ * of the last segment (e.g. after a crash) is cut off.
+ * Compaction copies the live entries of all older segments to the
+ * active one, dropping superseded, deleted and expired entries, and
+ * removes the older segments afterwards.
+ */
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// `tLogPos` is the position of a log entry.
+	tLogPos struct {
+		seg     uint32 // the segment containing the entry
+		off     int64  // offset of the entry within the segment
+		size    int64  // size of the whole entry
+		sLen    int    // length of the session ID
+		rLen    int    // length of the session record
+		expires int64  // expiry time (Unix nanoseconds)
+	}
+
+	// TLogStore is a session store appending all session records
+	// to a segmented log within a single directory.
+	TLogStore struct {
+		mtx      sync.RWMutex
+		dir      string              // directory of the segment files
+		index    map[string]tLogPos  // latest entry of each session
+		segments map[uint32]*os.File // open segment files
+		active   uint32              // number of the active segment
+		size     int64               // size of the active segment
+		maxSize  int64               // max. size of a segment
+		live     int64               // size of all indexed entries
+		total    int64               // size of all segments
+		done     chan struct{}       // signals the compactor to stop
+	}
+)
+
+const (
+	// Log entry operations:
+	leStore  = byte(1)
+	leDelete = byte(2)
+
+	// `leHeaderLen` is the size of a log entry's fixed header.
+	leHeaderLen = 19
+
+	// `lsDefaultSegmentSize` is the default max. size of a segment.
+	lsDefaultSegmentSize = 8 << 20
+)
+
+// NewLogStore returns a store appending all session records to
+// a segmented log inside `aDir`.
+//
+// If `aDir` doesn't exist it's created; otherwise the existing
+// log segments are replayed to restore the stored sessions.
+//
+//	`aDir` The directory to store the log segments.
+//	`aSegmentSize` The max. size (in bytes) of a log segment; if zero a default of 8 MB is used.
+//	`aCompactInterval` The interval to check whether compaction is due; if zero there's no automatic compaction.
+func NewLogStore(aDir string, aSegmentSize int64, aCompactInterval time.Duration) (*TLogStore, error) {
+	dir, err := checkSessionDir(aDir)
+	if nil != err {
+		return nil, err
+	}
+	if 0 >= aSegmentSize {
+		aSegmentSize = lsDefaultSegmentSize
+	}
+	ls := &TLogStore{
+		dir:      dir,
+		index:    make(map[string]tLogPos, 64),
+		segments: make(map[uint32]*os.File, 4),
+		maxSize:  aSegmentSize,
+		done:     make(chan struct{}),
+	}
+	if err = ls.recover(); nil != err {
+		ls.closeSegments()
+		return nil, err
+	}
+	if 0 < aCompactInterval {
+		go ls.goCompactor(aCompactInterval)
+	}
+
+	return ls, nil
+} // NewLogStore()
+
+// `append()` writes an entry to the active segment.
+//
+// The caller must hold the write lock.
+//
+//	`aOp` The entry's operation.
+//	`aSID` The session ID.
+//	`aRecord` The encoded session record.
+//	`aExpires` The expiry time (Unix nanoseconds).
+func (ls *TLogStore) append(aOp byte, aSID string, aRecord []byte, aExpires int64) (tLogPos, error) {
+	if 0xFFFF < len(aSID) {
+		return tLogPos{}, fmt.Errorf("%w: session ID too long", ErrBadRecord)
+	}
+	entry := make([]byte, 4, leHeaderLen+len(aSID)+len(aRecord))
+	entry = append(entry, aOp)
+	entry = appendUint16(entry, uint16(len(aSID)))
+	entry = appendUint64(entry, uint64(aExpires))
+	entry = appendUint32(entry, uint32(len(aRecord)))
+	entry = append(entry, aSID...)
+	entry = append(entry, aRecord...)
+	binary.BigEndian.PutUint32(entry, crc32.ChecksumIEEE(entry[4:]))
+
+	if (0 < ls.size) && (ls.maxSize < ls.size+int64(len(entry))) {
+		if err := ls.rotate(); nil != err {
+			return tLogPos{}, err
+		}
+	}
+	if _, err := ls.segments[ls.active].WriteAt(entry, ls.size); nil != err {
+		return tLogPos{}, err
+	}
+	result := tLogPos{
+		seg:     ls.active,
+		off:     ls.size,
+		size:    int64(len(entry)),
+		sLen:    len(aSID),
+		rLen:    len(aRecord),
+		expires: aExpires,
+	}
+	ls.size += result.size
+	ls.total += result.size
+
+	return result, nil
+} // append()
+
+// `apply()` updates the index with an entry.
+//
+// The caller must hold the write lock.
+//
+//	`aOp` The entry's operation.
+//	`aSID` The session ID.
+//	`aPos` The entry's position.
+func (ls *TLogStore) apply(aOp byte, aSID string, aPos tLogPos) {
+	if old, ok := ls.index[aSID]; ok {
+		ls.live -= old.size
+		delete(ls.index, aSID)
+	}
+	if leStore == aOp {
+		ls.index[aSID] = aPos
+		ls.live += aPos.size
+	}
+} // apply()
+
+// Close stops the background compaction and closes all segments.
+//
+// Part of the `TStore` interface.
+func (ls *TLogStore) Close() error {
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+
+	select {
+	case <-ls.done: // already closed
+		return nil
+	default:
+		close(ls.done)
+	}
+
+	return ls.closeSegments()
+} // Close()
+
+// `closeSegments()` closes all open segment files.
+func (ls *TLogStore) closeSegments() (rErr error) {
+	if f, ok := ls.segments[ls.active]; ok {
+		rErr = f.Sync()
+	}
+	for seg, f := range ls.segments {
+		if err := f.Close(); (nil != err) && (nil == rErr) {
+			rErr = err
+		}
+		delete(ls.segments, seg)
+	}
+
+	return
+} // closeSegments()
+
+// Compact copies all live entries of the older log segments to the
+// active one and removes the older segments afterwards.
+//
+// Superseded, deleted and expired entries are dropped.
+func (ls *TLogStore) Compact() error {
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+
+	if nil == ls.segments[ls.active] {
+		return os.ErrClosed
+	}
+	if 0 < ls.size {
+		if err := ls.rotate(); nil != err {
+			return err
+		}
+	}
+	last := ls.active - 1
+	now := time.Now().UnixNano()
+	for sid, pos := range ls.index {
+		if pos.seg > last {
+			continue // already in the active segment
+		}
+		if pos.expires <= now {
+			ls.apply(leDelete, sid, pos)
+			continue
+		}
+		record, err := ls.read(pos)
+		if nil != err {
+			return err
+		}
+		npos, err := ls.append(leStore, sid, record, pos.expires)
+		if nil != err {
+			return err
+		}
+		ls.apply(leStore, sid, npos)
+	}
+	if err := ls.segments[ls.active].Sync(); nil != err {
+		return err
+	}
+
+	// Remove the old segments in ascending order so that a crash
+	// in between can't resurrect deleted entries.
+	for _, seg := range ls.segmentList() {
+		if seg > last {
+			continue
+		}
+		f := ls.segments[seg]
+		_ = f.Close()
+		delete(ls.segments, seg)
+		if err := os.Remove(f.Name()); nil != err {
+			return err
+		}
+	}
+	ls.total = ls.size
+
+	return nil
+} // Compact()
+
+// Delete appends a deletion entry for `aSID`.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID being destroyed.
+func (ls *TLogStore) Delete(aSID string) error {
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+
+	if _, ok := ls.index[aSID]; !ok {
+		return nil
+	}
+	if nil == ls.segments[ls.active] {
+		return os.ErrClosed
+	}
+	pos, err := ls.append(leDelete, aSID, nil, 0)
+	if nil != err {
+		return err
+	}
+	ls.apply(leDelete, aSID, pos)
+
+	return nil
+} // Delete()
+
+// `goCompactor()` runs `Compact()` whenever at least half of the
+// log consists of obsolete entries.
+//
+//	`aInterval` The time between checks.
+func (ls *TLogStore) goCompactor(aInterval time.Duration) {
+	ticker := time.NewTicker(aInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ls.done:
+			return
+
+		case <-ticker.C:
+			ls.mtx.RLock()
+			garbage := ls.total - ls.live
+			due := (0 < garbage) && (garbage >= ls.live)
+			ls.mtx.RUnlock()
+			if due {
+				if err := ls.Compact(); nil != err {
+					log.Printf("sessions: log compaction failed: %v", err)
+				}
+			}
+		}
+	}
+} // goCompactor()
+
+// Load returns the latest session record of `aSID`.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID whose data are to be read.
+func (ls *TLogStore) Load(aSID string) ([]byte, error) {
+	ls.mtx.RLock()
+	defer ls.mtx.RUnlock()
+
+	pos, ok := ls.index[aSID]
+	if !ok || (pos.expires <= time.Now().UnixNano()) {
+		return nil, ErrNoSession
+	}
+
+	return ls.read(pos)
+} // Load()
+
+// LoadExpired returns the latest session record of `aSID` even if
+// it's expired.
+//
+// Part of the `TExpiredStore` interface.
+//
+//	`aSID` The session ID whose data are to be read.
+func (ls *TLogStore) LoadExpired(aSID string) ([]byte, error) {
+	ls.mtx.RLock()
+	defer ls.mtx.RUnlock()
+
+	pos, ok := ls.index[aSID]
+	if !ok {
+		return nil, ErrNoSession
+	}
+
+	return ls.read(pos)
+} // LoadExpired()
+
+// `read()` returns the session record stored at `aPos`.
+//
+// The caller must hold (at least) the read lock.
+//
+//	`aPos` The position of the entry to read.
+func (ls *TLogStore) read(aPos tLogPos) ([]byte, error) {
+	f, ok := ls.segments[aPos.seg]
+	if !ok {
+		return nil, os.ErrClosed
+	}
+	result := make([]byte, aPos.rLen)
+	if _, err := f.ReadAt(result, aPos.off+leHeaderLen+int64(aPos.sLen)); nil != err {
+		return nil, err
+	}
+
+	return result, nil
+} // read()
+
+// `recover()` rebuilds the index by replaying all log segments.
+func (ls *TLogStore) recover() error {
+	files, err := filepath.Glob(filepath.Join(ls.dir, "*.log"))
+	if nil != err {
+		return err
+	}
+	for _, fName := range files {
+		var seg uint32
+		if _, err = fmt.Sscanf(filepath.Base(fName), "%08x.log", &seg); nil != err {
+			continue // not one of ours
+		}
+		f, err := os.OpenFile(fName, os.O_RDWR, 0600)
+		if nil != err {
+			return err
+		}
+		ls.segments[seg] = f
+	}
+	segs := ls.segmentList()
+	if 0 == len(segs) {
+		ls.active = 0
+		return ls.rotate()
+	}
+
+	for idx, seg := range segs {
+		size, err := ls.replay(seg)
+		if nil != err {
+			if idx < len(segs)-1 {
+				// A broken older segment will be removed by the
+				// next compaction; we keep what we could read.
+				log.Printf("sessions: %s: %v", ls.segments[seg].Name(), err)
+			} else if err = ls.segments[seg].Truncate(size); nil != err {
+				// we couldn't cut off the incomplete entry
+				// at the end of the log
+				return err
+			}
+		}
+		ls.total += size
+		ls.size = size
+	}
+	ls.active = segs[len(segs)-1]
+
+	return nil
+} // recover()
+
+// `replay()` applies all entries of segment `aSeg` to the index.
+//
+// The method returns the size of the valid part of the segment
+// and an error if an invalid entry was found.
+//
+//	`aSeg` The number of the segment to replay.
+func (ls *TLogStore) replay(aSeg uint32) (int64, error) {
+	buf, err := os.ReadFile(ls.segments[aSeg].Name())
+	if nil != err {
+		return 0, err
+	}
+	var off int64
+	for len(buf) > 0 {
+		if leHeaderLen > len(buf) {
+			return off, fmt.Errorf("%w: incomplete log entry at %d", ErrBadRecord, off)
+		}
+		sLen := int(binary.BigEndian.Uint16(buf[5:]))
+		rLen := int(binary.BigEndian.Uint32(buf[15:]))
+		size := leHeaderLen + sLen + rLen
+		if size > len(buf) {
+			return off, fmt.Errorf("%w: incomplete log entry at %d", ErrBadRecord, off)
+		}
+		if binary.BigEndian.Uint32(buf) != crc32.ChecksumIEEE(buf[4:size]) {
+			return off, fmt.Errorf("%w: checksum mismatch at %d", ErrBadRecord, off)
+		}
+		op := buf[4]
+		sid := string(buf[leHeaderLen : leHeaderLen+sLen])
+		ls.apply(op, sid, tLogPos{
+			seg:     aSeg,
+			off:     off,
+			size:    int64(size),
+			sLen:    sLen,
+			rLen:    rLen,
+			expires: int64(binary.BigEndian.Uint64(buf[7:])),
+		})
+		off += int64(size)
+		buf = buf[size:]
+	}
+
+	return off, nil
+} // replay()
+
+// `rotate()` starts a new active segment.
+//
+// The caller must hold the write lock.
+func (ls *TLogStore) rotate() error {
+	if f, ok := ls.segments[ls.active]; ok {
+		if err := f.Sync(); nil != err {
+			return err
+		}
+	}
+	seg := ls.active + 1
+	fName := filepath.Join(ls.dir, fmt.Sprintf("%08x.log", seg))
+	f, err := os.OpenFile(fName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if nil != err {
+		return err
+	}
+	ls.segments[seg] = f
+	ls.active, ls.size = seg, 0
+
+	return nil
+} // rotate()
+
+// Scan calls `aFunc` for each stored session expiring before `aTime`.
+//
+// Part of the `TStore` interface.
+//
+//	`aTime` The time to compare the expiry time with.
+//	`aFunc` The function to call for each expired session.
+func (ls *TLogStore) Scan(aTime time.Time, aFunc func(aSID string) bool) error {
+	limit := aTime.UnixNano()
+	ls.mtx.RLock()
+	list := make([]string, 0, 16)
+	for sid, pos := range ls.index {
+		if pos.expires < limit {
+			list = append(list, sid)
+		}
+	}
+	ls.mtx.RUnlock()
+
+	for _, sid := range list {
+		if !aFunc(sid) {
+			break
+		}
+	}
+
+	return nil
+} // Scan()
+
+// `segmentList()` returns the numbers of all open segments in
+// ascending order.
+func (ls *TLogStore) segmentList() []uint32 {
+	result := make([]uint32, 0, len(ls.segments))
+	for seg := range ls.segments {
+		result = append(result, seg)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+
+	return result
+} // segmentList()
+
+// Store appends the session record `aRecord` of `aSID` to the log.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID of the data to be stored.
+//	`aRecord` The encoded session record.
+//	`aExpires` The session's expiry time.
+func (ls *TLogStore) Store(aSID string, aRecord []byte, aExpires time.Time) error {
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+
+	if nil == ls.segments[ls.active] {
+		return os.ErrClosed
+	}
+	pos, err := ls.append(leStore, aSID, aRecord, aExpires.UnixNano())
+	if nil != err {
+		return err
+	}
+	ls.apply(leStore, aSID, pos)
+
+	return nil
+} // Store()
+
+/* _EoF_ */
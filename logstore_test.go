@@ -0,0 +1,145 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLogStore(t *testing.T) {
+	ldir := t.TempDir()
+	ls, err := NewLogStore(ldir, 256, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour)
+	for _, sid := range []string{"sid1", "sid2", "sid3"} {
+		if err = ls.Store(sid, bytes.Repeat([]byte(sid), 16), expires); nil != err {
+			t.Fatalf("Store(%q) error = %v", sid, err)
+		}
+	}
+	_ = ls.Store("sid2", []byte("updated"), expires)
+	_ = ls.Store("sid4", []byte("expired"), time.Now().Add(-time.Second))
+	_ = ls.Delete("sid3")
+	if 1 >= len(ls.segments) {
+		t.Errorf("segments = %d, want > 1", len(ls.segments))
+	}
+
+	check := func(aStore *TLogStore) {
+		t.Helper()
+		tests := []struct {
+			sid     string
+			want    []byte
+			wantErr error
+		}{
+			{"sid1", bytes.Repeat([]byte("sid1"), 16), nil},
+			{"sid2", []byte("updated"), nil},
+			{"sid3", nil, ErrNoSession},
+			{"sid4", nil, ErrNoSession},
+			{"sid5", nil, ErrNoSession},
+		}
+		for _, tt := range tests {
+			got, err := aStore.Load(tt.sid)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Load(%q) error = %v, want %v", tt.sid, err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Load(%q) = %q, want %q", tt.sid, got, tt.want)
+			}
+		}
+	}
+	check(ls)
+
+	var expired []string
+	_ = ls.Scan(time.Now(), func(aSID string) bool {
+		expired = append(expired, aSID)
+		return true
+	})
+	if (1 != len(expired)) || ("sid4" != expired[0]) {
+		t.Errorf("Scan() = %v, want %v", expired, []string{"sid4"})
+	}
+	if got, _ := ls.LoadExpired("sid4"); "expired" != string(got) {
+		t.Errorf("LoadExpired() = %q, want %q", got, "expired")
+	}
+	if _, err := ls.LoadExpired("sid3"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("LoadExpired() of deleted session error = %v, want %v", err, ErrNoSession)
+	}
+
+	// crash recovery: replaying the log restores the index
+	_ = ls.Close()
+	if ls, err = NewLogStore(ldir, 256, 0); nil != err {
+		t.Fatal(err)
+	}
+	check(ls)
+
+	// compaction drops superseded, deleted and expired entries
+	if err = ls.Compact(); nil != err {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	check(ls)
+	if _, ok := ls.index["sid4"]; ok {
+		t.Errorf("Compact() kept expired entry")
+	}
+	if ls.total != ls.live {
+		t.Errorf("Compact() total = %d, live = %d", ls.total, ls.live)
+	}
+	_ = ls.Close()
+	if ls, err = NewLogStore(ldir, 256, 0); nil != err {
+		t.Fatal(err)
+	}
+	check(ls)
+	_ = ls.Close()
+} // TestTLogStore()
+
+func TestTLogStore_tornWrite(t *testing.T) {
+	ldir := t.TempDir()
+	ls, _ := NewLogStore(ldir, 0, 0)
+	expires := time.Now().Add(time.Hour)
+	_ = ls.Store("sid1", []byte("eins"), expires)
+	_ = ls.Store("sid2", []byte("zwei"), expires)
+	_ = ls.Close()
+
+	// simulate a crash in the middle of writing the last entry
+	fName := filepath.Join(ldir, "00000001.log")
+	fi, _ := os.Stat(fName)
+	if err := os.Truncate(fName, fi.Size()-2); nil != err {
+		t.Fatal(err)
+	}
+	ls, err := NewLogStore(ldir, 0, 0)
+	if nil != err {
+		t.Fatalf("NewLogStore() error = %v", err)
+	}
+	defer ls.Close()
+	if got, _ := ls.Load("sid1"); "eins" != string(got) {
+		t.Errorf("Load() = %q, want %q", got, "eins")
+	}
+	if _, err = ls.Load("sid2"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNoSession)
+	}
+	// new entries are appended after the valid part
+	_ = ls.Store("sid3", []byte("drei"), expires)
+	_ = ls.Close()
+	ls, _ = NewLogStore(ldir, 0, 0)
+	if got, _ := ls.Load("sid3"); "drei" != string(got) {
+		t.Errorf("Load() = %q, want %q", got, "drei")
+	}
+} // TestTLogStore_tornWrite()
+
+func TestTLogStore_sessions(t *testing.T) {
+	ls, _ := NewLogStore(t.TempDir(), 0, 0)
+	defer ls.Close()
+	rec := newRecord("aTestSID")
+	rec.data["Zahl"] = 123456789
+	goStore(ls, rec.clone())
+	if got := loadSession(ls, rec.sID); 123456789 != got.data["Zahl"] {
+		t.Errorf("loadSession() = %v, want %v", got.data, rec.data)
+	}
+} // TestTLogStore_sessions()
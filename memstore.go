@@ -0,0 +1,195 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the memory-only session store with optional
+ * snapshotting of all sessions to a single file.
+ *
+ * A snapshot file consists of a header (magic bytes and a format
+ * version) followed by the sessions' records, each prefixed by its
+ * length (4 bytes, big-endian):
+ *
+ *	offset  size  content
+ *	     0     4  magic bytes "\x89SNP"
+ *	     4     1  format version
+ *	     5     3  reserved (zero)
+ *	     8     4  length of the first record (`n`)
+ *	    12     n  first record
+ *	     …
+ */
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// TMemoryStore is a pseudo store used to keep all sessions in
+	// memory only.
+	//
+	// With this store the session monitor's internal list is the
+	// only place where sessions live: nothing is written to disk
+	// except for the optional snapshots.
+	TMemoryStore struct {
+		fileName string        // name of the snapshot file
+		interval time.Duration // time between snapshots
+		engine   atomic.Value  // the `tEngineRef` of the engine using the store
+	}
+)
+
+const (
+	// `snMagic` identifies a snapshot file.
+	snMagic = "\x89SNP"
+
+	// `snVersion` is the current version of the snapshot format.
+	snVersion = 1
+)
+
+// NewMemoryStore returns a store keeping all sessions in memory only.
+//
+// If `aFileName` is not empty all sessions are restored from that
+// file when the session handling starts, and written to it every
+// `aInterval` as well as when the store is closed.
+//
+//	`aFileName` The name of the snapshot file (may be empty).
+//	`aInterval` The time between snapshots; if zero there are no periodic snapshots.
+func NewMemoryStore(aFileName string, aInterval time.Duration) *TMemoryStore {
+	return &TMemoryStore{
+		fileName: aFileName,
+		interval: aInterval,
+	}
+} // NewMemoryStore()
+
+// Close writes a final snapshot (if a snapshot file is configured).
+//
+// Part of the `TStore` interface.
+func (ms *TMemoryStore) Close() error {
+	ref, _ := ms.engine.Load().(tEngineRef)
+	if ("" == ms.fileName) || (nil == ref.engine) {
+		return nil
+	}
+
+	return ms.snapshot(ms.records(ref.engine))
+} // Close()
+
+// Delete does nothing since the session monitor holds all sessions.
+//
+// Part of the `TStore` interface.
+func (ms *TMemoryStore) Delete(aSID string) error {
+	return nil
+} // Delete()
+
+// Load always returns `ErrNoSession` since the session monitor holds
+// all sessions.
+//
+// Part of the `TStore` interface.
+func (ms *TMemoryStore) Load(aSID string) ([]byte, error) {
+	return nil, ErrNoSession
+} // Load()
+
+// `records()` returns copies of all sessions held by the session
+// partitions of `aEngine`.
+//
+//	`aEngine` The engine holding the sessions.
+func (ms *TMemoryStore) records(aEngine tShEngine) []*tSessionRecord {
+	var result []*tSessionRecord
+	for idx := 0; idx < aEngine.shards(); idx++ {
+		list, _ := aEngine.requestShard(idx, tShRequest{
+			rType: smSnapshot,
+		}).sValue.([]*tSessionRecord)
+		result = append(result, list...)
+	}
+
+	return result
+} // records()
+
+// `restore()` reads all unexpired sessions from the snapshot file
+// into `aList`.
+//
+//	`aList` The session monitor's list of sessions.
+func (ms *TMemoryStore) restore(aList tShList) error {
+	if "" == ms.fileName {
+		return nil
+	}
+	buf, err := os.ReadFile(ms.fileName)
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if (sfHeaderLen > len(buf)) || (snMagic != string(buf[:len(snMagic)])) {
+		return fmt.Errorf("%w: not a snapshot file", ErrBadRecord)
+	}
+	if snVersion < buf[4] {
+		return fmt.Errorf("%w: %d", ErrVersion, buf[4])
+	}
+
+	now := time.Now()
+	for buf = buf[sfHeaderLen:]; 0 < len(buf); {
+		if 4 > len(buf) {
+			return fmt.Errorf("%w: truncated snapshot", ErrBadRecord)
+		}
+		rLen := int(binary.BigEndian.Uint32(buf))
+		if 4+rLen > len(buf) {
+			return fmt.Errorf("%w: truncated snapshot", ErrBadRecord)
+		}
+		record, err := decodeRecord(buf[4 : 4+rLen])
+		if nil != err {
+			return err
+		}
+		if record.expires.After(now) {
+			aList[record.sID] = record
+		}
+		buf = buf[4+rLen:]
+	}
+
+	return nil
+} // restore()
+
+// Scan does nothing since the session monitor takes care of
+// expired sessions itself.
+//
+// Part of the `TStore` interface.
+func (ms *TMemoryStore) Scan(aTime time.Time, aFunc func(aSID string) bool) error {
+	return nil
+} // Scan()
+
+// `snapshot()` writes `aRecords` to the snapshot file.
+//
+//	`aRecords` Copies of all sessions held by the session monitor.
+func (ms *TMemoryStore) snapshot(aRecords []*tSessionRecord) error {
+	buf := make([]byte, 0, 256*len(aRecords)+sfHeaderLen)
+	buf = append(buf, snMagic...)
+	buf = append(buf, snVersion, 0, 0, 0)
+	for _, record := range aRecords {
+		rb, err := encodeRecord(record)
+		if nil != err {
+			log.Printf("sessions: can't snapshot session %q: %v", record.sID, err)
+			continue
+		}
+		buf = appendUint32(buf, uint32(len(rb)))
+		buf = append(buf, rb...)
+	}
+
+	return writeRecordFile(ms.fileName, buf)
+} // snapshot()
+
+// Store does nothing since the session monitor holds all sessions.
+//
+// Part of the `TStore` interface.
+func (ms *TMemoryStore) Store(aSID string, aRecord []byte, aExpires time.Time) error {
+	return nil
+} // Store()
+
+/* _EoF_ */
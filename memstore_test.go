@@ -0,0 +1,77 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func initMemorySession(aStore *TMemoryStore) {
+	soEngine = startMonitors(aStore, 1)
+	// make sure the monitor has started (and restored the snapshot)
+	(&TSession{}).Len()
+} // initMemorySession()
+
+func TestTMemoryStore(t *testing.T) {
+	sdir := t.TempDir()
+	fName := filepath.Join(sdir, "sessions.snapshot")
+
+	ms := NewMemoryStore(fName, 0)
+	initMemorySession(ms)
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 123456789).Set("Zeichenkette", "eine Zeichenkette")
+	so.request(smStoreSession, "", nil)
+	empty := &TSession{sID: newSID()}
+	empty.request(smStoreSession, "", nil)
+
+	// no files apart from the snapshot
+	if files, _ := os.ReadDir(sdir); 0 != len(files) {
+		t.Errorf("memory store created %d files", len(files))
+	}
+	if err := ms.Close(); nil != err {
+		t.Fatalf("Close() error = %v", err)
+	}
+	stopSession()
+
+	// restore from the snapshot
+	ms = NewMemoryStore(fName, 0)
+	initMemorySession(ms)
+	defer stopSession()
+	if got, _ := so.GetInt("Zahl"); 123456789 != got {
+		t.Errorf("GetInt() = %v, want %v", got, 123456789)
+	}
+	if got := so.Len(); 2 != got {
+		t.Errorf("Len() = %v, want %v", got, 2)
+	}
+	if got := empty.Len(); 0 != got {
+		t.Errorf("Len() = %v, want %v", got, 0)
+	}
+} // TestTMemoryStore()
+
+func TestTMemoryStore_noStore(t *testing.T) {
+	initMemorySession(NewMemoryStore("", 0))
+	defer stopSession()
+	log := &tEventLog{}
+	id := AddHook(log.hook)
+	defer RemoveHook(id)
+
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 1)
+	so.request(smStoreSession, "", nil)
+	log.wait(t, EventCreated, so.sID)
+	time.Sleep(20 * time.Millisecond)
+
+	log.mtx.Lock()
+	defer log.mtx.Unlock()
+	for _, event := range log.events {
+		if EventStored == event.Type {
+			t.Errorf("memory store emitted %v", event)
+		}
+	}
+} // TestTMemoryStore_noStore()
@@ -13,9 +13,8 @@ package sessions
  */
 
 import (
-	"encoding/gob"
-	"os"
-	"path/filepath"
+	"log"
+	"math/rand"
 	"time"
 )
 
@@ -23,12 +22,29 @@ type (
 	// `tSessionData` stores the session data.
 	tSessionData map[string]interface{}
 
-	// `tShList` is the list of known sessions.
-	tShList map[string]*tSessionData
+	// `tShList` is a list of sessions.
+	tShList map[string]*tSessionRecord
 
 	// `tShLookupType` is the kind of request to `goMonitor()`.
 	tShLookupType int
 
+	// `tShMonitor` handles the requests for a partition of the
+	// sessions (see `handle()`).
+	//
+	// The monitor itself isn't safe for concurrent use; the engine
+	// serialises the access to it (see `tShEngine`).
+	tShMonitor struct {
+		cache   *tShCache // list of active sessions
+		engine  tShEngine // the engine the monitor belongs to
+		store   TStore    // the store holding the session records
+		memOnly bool      // whether `cache` is the source of truth
+		shared  bool      // whether sessions are held during a request only
+
+		// a record read outside the monitor (see `preload()`)
+		loaded      *tSessionRecord
+		loadedFound bool // whether `loaded` was found in the store
+	}
+
 	// `tShRequest` is the request structure channelled to `goMonitor()`.
 	tShRequest struct {
 		rKey   string
@@ -37,16 +53,6 @@ type (
 		rValue interface{}
 		reply  chan *TSession
 	}
-
-	// Structure to store the session data:
-	//
-	//	tStoreStruct{
-	//		"data":    tSessionData,
-	//		"expires": Unix.secs,
-	//		"sid":     aSID,
-	//	}
-	//
-	tStoreStruct map[string]interface{}
 )
 
 const (
@@ -59,151 +65,101 @@ const (
 	smLoadSession
 	smSessionLen
 	smSetKey
+	smSnapshot
 	smStoreSession
+	smCacheStats
+	smFlushed
+	smExpires
+	smSetMaxAge
+	smSetTTL
+	smExpireSessions
+	smDetachSession
+	smAttachSession
+	smUpdateSession
+	smClearSession
+	smCopySession
+	smGetMany
+	smHasKey
+	smKeys
+	smSetMany
 )
 
-// `goDel()` deletes the file and session data for `aSID`.
-//
-// This function is called from `goGC()`
-//
-// We need this additional level of indirection to delete both,
-// the session data in memory and the session file.
-func goDel(aSID string) {
-	answer := make(chan *TSession)
-	defer close(answer)
-
-	soSessionChannel <- tShRequest{
-		rSID:  aSID,
-		rType: smDestroySession,
-		reply: answer,
+// The request types whose handling needs the session record (which
+// `lookup()` reads from the store if it's not cached).
+const smLookupTypes = smClearSession | smCopySession | smDeleteKey |
+	smExpires | smGetKey | smGetMany | smHasKey | smKeys |
+	smLoadSession | smSessionLen | smSetKey | smSetMany |
+	smSetMaxAge | smSetTTL | smUpdateSession
+
+// `gcDelay()` returns the time until the next GC run.
+func gcDelay() time.Duration {
+	result := GCInterval()
+	if jitter := GCJitter(); 0 < jitter {
+		result += time.Duration(rand.Int63n(int64(jitter)))
 	}
-	<-answer // ignore the result
-} // goDel()
 
-// `goGC()` cleans up old sessions.
-//
-// Sessions that have not been updated for at least
-// `SessionTTL()` seconds will be removed.
+	return result
+} // gcDelay()
+
+// `goFlush()` writes the session `aCopy` evicted from the cache (or
+// removes it from the store if it's empty).
 //
-//	`aSessionDir` The directory where the session files are stored.
-func goGC(aSessionDir string) {
-	secs := time.Now().Unix() - int64(soSessionTTL)
-	expired := time.Unix(secs, 0)
-	files, err := filepath.Glob(aSessionDir + "/*.sid")
-	if nil != err {
-		return
-	}
-	var (
-		// re-use variables instead of re-creating them in the loop
-		fi          os.FileInfo
-		file, fName string
-	)
-	for _, file = range files {
-		if fi, err = os.Stat(file); nil != err {
-			continue
-		}
-		if fi.ModTime().Before(expired) {
-			fName = filepath.Base(file)
-			go goDel(fName[:len(fName)-4])
-		}
+//	`aStore` The store to hold the session record.
+//	`aCopy` A copy of the evicted session record.
+//	`aRecord` The evicted session record (used as a token only).
+//	`aEngine` The engine to report the completion to.
+func goFlush(aStore TStore, aCopy, aRecord *tSessionRecord, aEngine tShEngine) {
+	if 0 == len(aCopy.data) {
+		goRemove(aStore, aCopy.sID)
+	} else {
+		goStore(aStore, aCopy)
+		releaseSession(aStore, aCopy.sID)
 	}
-} // goGC()
 
-// `goMonitor()` handles the access to the internal list of session data.
+	aEngine.request(tShRequest{
+		rSID:   aCopy.sID,
+		rType:  smFlushed,
+		rValue: aRecord,
+	})
+} // goFlush()
+
+// `goMonitor()` handles the requests sent to `aMonitor`.
+//
+// The main monitor (`aMain == true`) also takes care of the store as
+// a whole (garbage collection and snapshots).
 //
-//	`aSessionDir` The directory where the session files are stored.
+//	`aMonitor` The session monitor handling the requests.
 //	`aRequest` The channel to receive request through.
-func goMonitor(aSessionDir string, aRequest <-chan tShRequest) {
-	shList := make(tShList, 32) // list of active sessions
-	go goGC(aSessionDir)        // cleanup old session files
-
-	gcInterval := time.Duration(soSessionTTL<<1)*time.Second + 1
-	gcTimer := time.NewTimer(gcInterval)
+//	`aMain` Whether this is the main monitor.
+func goMonitor(aMonitor *tShMonitor, aRequest <-chan tShRequest, aMain bool) {
+	configChange := configNotify()
+	gcTimer := time.NewTimer(gcDelay())
 	defer gcTimer.Stop()
 
+	collect := func() {}            // only the main monitor collects garbage
+	var snapTicker <-chan time.Time // `nil` blocks forever
+	memStore, memOnly := aMonitor.store.(*TMemoryStore)
+	if aMain {
+		collect = gcCollector(aMonitor.store, aMonitor.engine)
+		if memOnly {
+			if ("" != memStore.fileName) && (0 < memStore.interval) {
+				ticker := time.NewTicker(memStore.interval)
+				defer ticker.Stop()
+				snapTicker = ticker.C
+			}
+			memStore.engine.Store(tEngineRef{aMonitor.engine})
+			defer memStore.engine.Store(tEngineRef{})
+		}
+	}
+	collect() // cleanup old session records
+
 	for { // wait for requests
 		select {
 		case request, more := <-aRequest:
 			if !more { // channel closed
 				return
 			}
-
-			switch request.rType {
-			case smChangeSession:
-				newsid := newSID()
-				if data, ok := shList[request.rSID]; ok {
-					shList[newsid] = data
-					delete(shList, request.rSID)
-				} else {
-					list := make(tSessionData)
-					shList[newsid] = &list
-				}
-				go goRemove(aSessionDir, request.rSID)
-				request.reply <- &TSession{sID: newsid}
-
-			case smDeleteKey:
-				if data, ok := shList[request.rSID]; ok {
-					delete(*data, request.rKey)
-				}
-				request.reply <- &TSession{sID: request.rSID}
-
-			case smDestroySession:
-				delete(shList, request.rSID)
-				go goRemove(aSessionDir, request.rSID)
-				request.reply <- &TSession{}
-
-			case smGetKey:
-				result := &TSession{
-					sID: request.rSID,
-				}
-				data, ok := shList[request.rSID]
-				if !ok {
-					data = loadSession(aSessionDir, request.rSID)
-					shList[request.rSID] = data
-				}
-				if val, ok := (*data)[request.rKey]; ok {
-					result.sValue = val
-				}
-				request.reply <- result
-
-			case smLoadSession:
-				if _, ok := shList[request.rSID]; !ok {
-					shList[request.rSID] = loadSession(aSessionDir, request.rSID)
-				}
-				request.reply <- &TSession{sID: request.rSID}
-
-			case smSessionLen:
-				result := &TSession{
-					sID:    request.rSID,
-					sValue: 0,
-				}
-				if data, ok := shList[request.rSID]; ok {
-					result.sValue = len(*data)
-				}
-				request.reply <- result
-
-			case smSetKey:
-				if data, ok := shList[request.rSID]; ok {
-					(*data)[request.rKey] = request.rValue
-				} else {
-					data = loadSession(aSessionDir, request.rSID)
-					(*data)[request.rKey] = request.rValue
-					shList[request.rSID] = data
-				}
-				request.reply <- &TSession{sID: request.rSID}
-
-			case smStoreSession:
-				if data, ok := shList[request.rSID]; ok {
-					if 0 == len(*data) {
-						// free unused memory
-						delete(shList, request.rSID)
-					} else {
-						go goStore(aSessionDir, request.rSID, data)
-					}
-				}
-				request.reply <- &TSession{sID: request.rSID}
-
-			case smTerminate:
+			if smTerminate == request.rType {
 				if chLen := len(aRequest); 0 < chLen {
 					for range aRequest {
 						chLen--
@@ -213,90 +169,529 @@ func goMonitor(aSessionDir string, aRequest <-chan tShRequest) {
 					}
 				}
 				return
-			} // switch
+			}
+
+			result, after := aMonitor.handle(request)
+			if nil == after {
+				request.reply <- result
+				break
+			}
+			go func(aReply chan *TSession) {
+				after()
+				aReply <- result
+			}(request.reply)
 
 		case <-gcTimer.C:
-			go goGC(aSessionDir)
-			gcTimer.Reset(gcInterval)
+			aMonitor.cache.sweep(time.Now())
+			collect()
+			gcTimer.Reset(gcDelay())
+
+		case <-configChange:
+			configChange = configNotify()
+			if !gcTimer.Stop() {
+				select {
+				case <-gcTimer.C:
+				default:
+				}
+			}
+			gcTimer.Reset(gcDelay())
+
+		case <-snapTicker:
+			go goSnapshot(memStore, aMonitor.engine)
 		} // select
 	} // for
 } // goMonitor()
 
-// `goRemove()` removes the session file.
+// `newMonitor()` returns a session monitor for the partition `aShard`
+// of `aEngine`.
+//
+//	`aStore` The store holding the session records.
+//	`aEngine` The engine the monitor belongs to.
+//	`aShard` The monitor's partition.
+//	`aRestored` Sessions restored from a snapshot (filtered by partition).
+func newMonitor(aStore TStore, aEngine tShEngine, aShard int, aRestored tShList) *tShMonitor {
+	result := &tShMonitor{
+		cache:  newCache(aEngine.shards()),
+		engine: aEngine,
+		store:  aStore,
+	}
+	// In memory-only mode `cache` is the source of truth:
+	_, result.memOnly = aStore.(*TMemoryStore)
+	// With a shared store sessions are held only during a request:
+	if ss, ok := aStore.(TSharedStore); ok {
+		result.shared = ss.Shared()
+	}
+	for sid, record := range aRestored {
+		if aShard == aEngine.shard(sid) {
+			result.cache.add(record)
+		}
+	}
+	result.cache.onExpire = func(aRecord *tSessionRecord) {
+		emit(EventExpired, aRecord.sID, "", expiryReason(aRecord), aRecord.data)
+		if !result.memOnly {
+			go goRemove(aStore, aRecord.sID)
+		}
+	}
+
+	return result
+} // newMonitor()
+
+// `attach()` puts `aRecord` (if any) into the cache as session
+// `aNewSID` replacing the session `aOldSID`.
+//
+//	`aRecord` The session record to attach (may be `nil`).
+//	`aOldSID` The session's previous ID.
+//	`aNewSID` The session's new ID.
+func (sm *tShMonitor) attach(aRecord *tSessionRecord, aOldSID, aNewSID string) {
+	if nil == aRecord {
+		sm.cache.add(newRecord(aNewSID))
+		emit(EventCreated, aNewSID, "", ReasonNew, nil)
+	} else {
+		aRecord.sID = aNewSID
+		sm.cache.add(aRecord)
+		sm.cache.changed(aNewSID)
+		emit(EventRotated, aNewSID, aOldSID, ReasonRequest, nil)
+	}
+	sm.evict()
+} // attach()
+
+// `detach()` removes the session `aSID` from the cache and returns
+// it (if it was cached).
+//
+//	`aSID` The ID of the session to detach.
+func (sm *tShMonitor) detach(aSID string) *tSessionRecord {
+	record := sm.cache.get(aSID)
+	if nil != record {
+		sm.cache.remove(aSID)
+	}
+	go goRemove(sm.store, aSID)
+
+	return record
+} // detach()
+
+// `evict()` keeps the cache within its limits.
+func (sm *tShMonitor) evict() {
+	for _, record := range sm.cache.evict() {
+		if !sm.memOnly {
+			sm.cache.pending[record.sID] = record
+			go goFlush(sm.store, record.clone(), record, sm.engine)
+		}
+	}
+} // evict()
+
+// `handle()` handles `aRequest` and returns the reply.
+//
+// If `rAfter` is not `nil` it has to be called (outside of any lock
+// or monitor loop) before the reply is handed out.
+//
+//	`aRequest` The request to handle.
+func (sm *tShMonitor) handle(aRequest tShRequest) (rReply *TSession, rAfter func()) {
+	cache := sm.cache
+
+	switch aRequest.rType {
+	case smClearSession:
+		record := sm.lookup(aRequest.rSID)
+		if 0 < len(record.data) {
+			record.data, record.sizes = make(tSessionData), nil
+			cache.changed(aRequest.rSID)
+		}
+		sm.evict()
+
+	case smCopySession:
+		record := sm.lookup(aRequest.rSID)
+		result := &TSession{sID: aRequest.rSID}
+		if data, err := Codec().copy(record.data); nil != err {
+			result.sValue = err
+		} else {
+			result.sValue = data
+		}
+		sm.evict()
+		return result, nil
+
+	case smGetMany:
+		record := sm.lookup(aRequest.rSID)
+		var data tSessionData
+		if keys, ok := aRequest.rValue.([]string); ok {
+			data = make(tSessionData, len(keys))
+			for _, key := range keys {
+				if val, ok := record.data[key]; ok {
+					data[key] = val
+				}
+			}
+		} else { // all of them
+			data = record.clone().data
+		}
+		sm.evict()
+		return &TSession{sID: aRequest.rSID, sValue: data}, nil
+
+	case smHasKey:
+		record := sm.lookup(aRequest.rSID)
+		_, ok := record.data[aRequest.rKey]
+		sm.evict()
+		return &TSession{sID: aRequest.rSID, sValue: ok}, nil
+
+	case smKeys:
+		record := sm.lookup(aRequest.rSID)
+		sm.evict()
+		return &TSession{sID: aRequest.rSID, sValue: sortedKeys(record.data)}, nil
+
+	case smSetMany:
+		record := sm.lookup(aRequest.rSID)
+		values, _ := aRequest.rValue.(tSessionData)
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		err := sm.setValues(record, values, keys)
+		sm.evict()
+		if nil != err {
+			return &TSession{sID: aRequest.rSID, sValue: err}, nil
+		}
+
+	case smCacheStats:
+		result := cache.stats
+		result.Entries = cache.lru.Len()
+		return &TSession{sValue: result}, nil
+
+	case smAttachSession:
+		record, _ := aRequest.rValue.(*tSessionRecord)
+		sm.attach(record, aRequest.rKey, aRequest.rSID)
+
+	case smChangeSession:
+		newsid, _ := aRequest.rValue.(string)
+		if "" == newsid {
+			newsid = newSID()
+		}
+		sm.attach(sm.detach(aRequest.rSID), aRequest.rSID, newsid)
+		return &TSession{sID: newsid}, nil
+
+	case smDetachSession:
+		return &TSession{sValue: sm.detach(aRequest.rSID)}, nil
+
+	case smDeleteKey:
+		record := sm.lookup(aRequest.rSID)
+		if _, ok := record.data[aRequest.rKey]; ok {
+			_ = sm.setValues(record, nil, []string{aRequest.rKey})
+		}
+		sm.evict()
+
+	case smDestroySession:
+		var data tSessionData
+		if record := cache.peek(aRequest.rSID); nil != record {
+			data = record.data
+		}
+		emit(EventDestroyed, aRequest.rSID, "", ReasonDestroyed, data)
+		cache.remove(aRequest.rSID)
+		go goRemove(sm.store, aRequest.rSID)
+		return &TSession{}, nil
+
+	case smExpireSessions:
+		records, _ := aRequest.rValue.(map[string]*tSessionRecord)
+		now := time.Now()
+		expired := make([]string, 0, len(records))
+		for sid, stored := range records {
+			record := cache.peek(sid)
+			if (nil != record) && record.expires.After(now) {
+				continue // still in use, it'll be stored again
+			}
+			if nil == record {
+				record = stored
+			}
+			var data tSessionData
+			if nil != record {
+				data = record.data
+			}
+			emit(EventExpired, sid, "", ReasonGC, data)
+			if nil != cache.peek(sid) {
+				// the session's loaded copy is dropped
+				releaseSession(sm.store, sid)
+			}
+			cache.remove(sid)
+			expired = append(expired, sid)
+		}
+		return &TSession{sValue: expired}, nil
+
+	case smExpires:
+		record := sm.lookup(aRequest.rSID)
+		sm.evict()
+		return &TSession{sID: aRequest.rSID, sValue: record.expires}, nil
+
+	case smFlushed:
+		if record, ok := aRequest.rValue.(*tSessionRecord); ok {
+			cache.flushed(aRequest.rSID, record)
+		}
+
+	case smGetKey:
+		result := &TSession{
+			sID: aRequest.rSID,
+		}
+		record := sm.lookup(aRequest.rSID)
+		if val, ok := record.data[aRequest.rKey]; ok {
+			result.sValue = val
+		}
+		sm.evict()
+		return result, nil
+
+	case smLoadSession:
+		_ = sm.lookup(aRequest.rSID)
+		sm.evict()
+
+	case smSessionLen:
+		record := sm.lookup(aRequest.rSID)
+		sm.evict()
+		return &TSession{sID: aRequest.rSID, sValue: len(record.data)}, nil
+
+	case smSetKey:
+		record := sm.lookup(aRequest.rSID)
+		err := sm.setValues(record,
+			tSessionData{aRequest.rKey: aRequest.rValue},
+			[]string{aRequest.rKey})
+		sm.evict()
+		if nil != err {
+			return &TSession{sID: aRequest.rSID, sValue: err}, nil
+		}
+
+	case smSetMaxAge, smSetTTL:
+		record := sm.lookup(aRequest.rSID)
+		d, _ := aRequest.rValue.(time.Duration)
+		if 0 > d {
+			d = 0
+		}
+		if smSetTTL == aRequest.rType {
+			record.idleTTL = d
+		} else {
+			record.maxAge = d
+		}
+		record.touch()
+		cache.changed(aRequest.rSID)
+		sm.evict()
+
+	case smUpdateSession:
+		record := sm.lookup(aRequest.rSID)
+		update, _ := aRequest.rValue.(func(*TTransaction) error)
+		tx := &TTransaction{data: record.data}
+		if err := tx.run(update); nil != err {
+			sm.evict()
+			return &TSession{sID: aRequest.rSID, sValue: err}, nil
+		}
+		if tx.changed {
+			if err := sm.setValues(record, tx.data, tx.changes()); nil != err {
+				sm.evict()
+				return &TSession{sID: aRequest.rSID, sValue: err}, nil
+			}
+		}
+		sm.evict()
+
+	case smSnapshot:
+		return &TSession{sValue: cache.records()}, nil
+
+	case smStoreSession:
+		if record := cache.get(aRequest.rSID); nil != record {
+			if 0 == len(record.data) {
+				// free unused memory …
+				dirty := cache.dirty(aRequest.rSID)
+				cache.remove(aRequest.rSID)
+				if dirty && !sm.memOnly {
+					// … and drop the values stored before
+					if sm.shared {
+						return &TSession{sID: aRequest.rSID}, func() {
+							goRemove(sm.store, aRequest.rSID)
+						}
+					}
+					// until it's removed the store's copy is outdated
+					cache.pending[aRequest.rSID] = record
+					go goFlush(sm.store, record.clone(), record, sm.engine)
+				} else if sm.shared {
+					releaseSession(sm.store, aRequest.rSID)
+				}
+			} else if sm.memOnly {
+				// the cache is the store, nothing to write
+				cache.stored(aRequest.rSID)
+			} else if sm.shared {
+				// other processes may access the session as
+				// soon as the request is answered
+				cache.remove(aRequest.rSID)
+				return &TSession{sID: aRequest.rSID}, func() {
+					goStore(sm.store, record)
+					releaseSession(sm.store, aRequest.rSID)
+				}
+			} else {
+				// hand over a copy to not race with
+				// later changes of the session data
+				go goStore(sm.store, record.clone())
+				cache.stored(aRequest.rSID)
+			}
+		}
+	} // switch
+
+	return &TSession{sID: aRequest.rSID}, nil
+} // handle()
+
+// `lookup()` returns the session of `aSID`, reading it from the
+// store if it's not cached.
 //
-//	`aSessionDir` The directory where the session files are stored.
+//	`aSID` The ID of the requested session.
+func (sm *tShMonitor) lookup(aSID string) *tSessionRecord {
+	loaded, found := sm.loaded, sm.loadedFound
+	sm.loaded = nil
+	if (nil != loaded) && (loaded.sID != aSID) {
+		sm.unload(loaded)
+		loaded = nil
+	}
+
+	if record := sm.cache.get(aSID); nil != record {
+		sm.cache.stats.Hits++
+		if nil != loaded {
+			sm.unload(loaded)
+		}
+		return record
+	}
+	sm.cache.stats.Misses++
+	record := loaded
+	if nil == record {
+		record, found = loadRecord(sm.store, aSID)
+	}
+	sm.cache.add(record)
+	if !found {
+		emit(EventCreated, aSID, "", ReasonNew, nil)
+	}
+
+	return record
+} // lookup()
+
+// `needsLoad()` reports whether handling `aRequest` would read the
+// session record from the store.
+//
+//	`aRequest` The request to check.
+func (sm *tShMonitor) needsLoad(aRequest tShRequest) bool {
+	if sm.memOnly || ("" == aRequest.rSID) ||
+		(0 == aRequest.rType&smLookupTypes) {
+		return false
+	}
+	record := sm.cache.peek(aRequest.rSID)
+
+	return (nil == record) || !record.expires.After(time.Now())
+} // needsLoad()
+
+// `preload()` hands the record `aRecord` read from the store outside
+// of the monitor to the next `lookup()`.
+//
+//	`aRecord` The session record read.
+//	`aFound` Whether `aRecord` was found in the store.
+func (sm *tShMonitor) preload(aRecord *tSessionRecord, aFound bool) {
+	if nil != sm.loaded {
+		sm.unload(sm.loaded)
+	}
+	sm.loaded, sm.loadedFound = aRecord, aFound
+} // preload()
+
+// `setValues()` sets the values of `aKeys` in `aRecord` to those in
+// `aData` (a key missing in `aData` removing the value) unless that
+// exceeds the session limits (see `SetSessionLimits()`).
+//
+//	`aRecord` The session to change.
+//	`aData` The new values.
+//	`aKeys` The identifiers of the values to set (or remove).
+func (sm *tShMonitor) setValues(aRecord *tSessionRecord, aData tSessionData, aKeys []string) error {
+	if err := aRecord.setValues(aData, aKeys); nil != err {
+		sm.cache.stats.Rejected++
+		return err
+	}
+	sm.cache.changed(aRecord.sID)
+
+	return nil
+} // setValues()
+
+// `unload()` drops the preloaded `aRecord` which isn't needed after
+// all (see `preload()`).
+//
+//	`aRecord` The session record read in vain.
+func (sm *tShMonitor) unload(aRecord *tSessionRecord) {
+	if sm.loaded == aRecord {
+		sm.loaded = nil
+	}
+	// the store's session lock was taken when loading
+	releaseSession(sm.store, aRecord.sID)
+} // unload()
+
+// `releaseSession()` unlocks the session `aSID` if `aStore` is a
+// shared store (see `TSharedStore`).
+//
+// It's called whenever a session loaded from the store is dropped
+// from memory.
+//
+//	`aStore` The store holding the session records.
+//	`aSID` The ID of the session to unlock.
+func releaseSession(aStore TStore, aSID string) {
+	if ss, ok := aStore.(TSharedStore); ok && ss.Shared() {
+		ss.Unlock(aSID)
+	}
+} // releaseSession()
+
+// `goRemove()` removes the stored session record.
+//
+//	`aStore` The store holding the session records.
 //	`aSID` The session ID being destroyed.
-func goRemove(aSessionDir, aSID string) {
-	fName := filepath.Join(aSessionDir, aSID) + ".sid"
-	// we try to remove the file w/o any checks
-	_ = os.Remove(fName)
+func goRemove(aStore TStore, aSID string) {
+	// we try to remove the record w/o any checks
+	_ = aStore.Delete(aSID)
+	releaseSession(aStore, aSID)
 } // goRemove()
 
-// `goStore()` saves `aData` of `aSID` on disk.
+// `goStore()` saves `aRecord` in `aStore`.
 //
-//	`aSessionDir` The directory where the session files are stored.
-//	`aSID` The session ID of the data to be stored.
-//	`aData` The session data to store.
-func goStore(aSessionDir, aSID string, aData *tSessionData) {
-	now := time.Now()
-	ss := tStoreStruct{
-		"data":    *aData,
-		"expires": now.Unix() + int64(soSessionTTL) + 1,
-		"sid":     aSID,
+//	`aStore` The store to hold the session record.
+//	`aRecord` The session record to store.
+func goStore(aStore TStore, aRecord *tSessionRecord) {
+	aRecord.touch()
+
+	buf, err := encodeRecord(aRecord)
+	if nil == err {
+		err = aStore.Store(aRecord.sID, buf, aRecord.expires)
 	}
-	gob.Register(*aData)
-	gob.Register(now)
-	gob.Register(ss)
-
-	fName := filepath.Join(aSessionDir, aSID) + ".sid"
-	file, err := os.OpenFile(fName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if nil != err {
+		log.Printf("sessions: can't store session %q: %v", aRecord.sID, err)
 		return
 	}
-	defer file.Close()
-
-	_ = gob.NewEncoder(file).Encode(ss)
+	emit(EventStored, aRecord.sID, "", "", nil)
 } // goStore()
 
-// `loadSession()` reads the data for `aSID` from disk.
+// `loadRecord()` reads the data for `aSID` from `aStore`.
 // If no (previous) session data is available, an empty session
-// is returned.
+// is returned and `rFound` is `false`.
 //
-//	`aSessionDir` The directory where the session files are stored.
-//	`aSID` The session ID whose data are to be read from disk.
-func loadSession(aSessionDir, aSID string) *tSessionData {
-	sData := make(tSessionData)
-	fName := filepath.Join(aSessionDir, aSID) + ".sid"
-	file, err := os.OpenFile(fName, os.O_RDONLY, 0)
+// Session records in the legacy format are read transparently;
+// they are converted the next time the session is stored.
+//
+//	`aStore` The store holding the session records.
+//	`aSID` The session ID whose data are to be read.
+func loadRecord(aStore TStore, aSID string) (rRecord *tSessionRecord, rFound bool) {
+	buf, err := aStore.Load(aSID)
 	if nil != err {
-		return &sData
+		return newRecord(aSID), false
 	}
-	defer file.Close()
-
-	var ss tStoreStruct
-	now := time.Now()
-	gob.Register(sData)
-	gob.Register(now)
-	gob.Register(ss)
-	decoder := gob.NewDecoder(file)
-	_ = decoder.Decode(&ss) // ignoring error: the following tests will catch it
-	if e, ok := ss["expires"]; ok {
-		if expireSecs, ok := e.(int64); ok &&
-			time.Unix(expireSecs, 0).After(now) {
-			if id, ok := ss["sid"]; ok {
-				if sid, ok := id.(string); ok &&
-					(sid == aSID) {
-					if d, ok := ss["data"]; ok {
-						if data, ok := d.(tSessionData); ok {
-							return &data
-						}
-					}
-				}
-			}
-		}
+	record, err := decodeRecord(buf)
+	if (nil != err) || (record.sID != aSID) ||
+		!record.expires.After(time.Now()) {
+		return newRecord(aSID), false
 	}
 
-	return &sData
+	return record, true
+} // loadRecord()
+
+// `loadSession()` reads the data for `aSID` from `aStore`.
+// If no (previous) session data is available, an empty session
+// is returned.
+// The session isn't held by a monitor, so it's not kept locked (see
+// `TSharedStore`).
+//
+//	`aStore` The store holding the session records.
+//	`aSID` The session ID whose data are to be read.
+func loadSession(aStore TStore, aSID string) *tSessionRecord {
+	result, _ := loadRecord(aStore, aSID)
+	releaseSession(aStore, aSID)
+
+	return result
 } // loadSession()
 
 /* _EoF_ */
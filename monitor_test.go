@@ -6,57 +6,106 @@
 package sessions
 
 import (
-	"path/filepath"
+	"os"
 	"testing"
 	"time"
 )
 
 func Test_goStore(t *testing.T) {
-	sdir, _ := filepath.Abs("./sessions")
+	store, _ := NewFileStore("./sessions")
 	sid := newSID()
-	list := make(tSessionData)
-	list["Zeichenkette"] = "eine Zeichenkette"
-	list["Zahl"] = 123456789
-	list["Datum"] = time.Now()
+	record := newRecord(sid)
+	record.data["Zeichenkette"] = "eine Zeichenkette"
+	record.data["Zahl"] = 123456789
+	record.data["Datum"] = time.Now()
 	type args struct {
-		aSessionDir string
-		aSID        string
-		aData       tSessionData
+		aStore  TStore
+		aRecord *tSessionRecord
 	}
 	tests := []struct {
 		name string
 		args args
+		want int
 	}{
 		// TODO: Add test cases.
-		{" 1", args{sdir, sid, list}},
+		{" 1", args{store, record}, 3},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			goStore(tt.args.aSessionDir, tt.args.aSID, &tt.args.aData)
+			goStore(tt.args.aStore, tt.args.aRecord)
+			got := loadSession(tt.args.aStore, tt.args.aRecord.sID)
+			if len(got.data) != tt.want {
+				t.Errorf("goStore() = %v, want %v", len(got.data), tt.want)
+			}
 		})
 	}
 } // Test_goStore()
 
 func Test_loadSession(t *testing.T) {
-	sdir, _ := filepath.Abs("./sessions")
+	store, _ := NewFileStore("./sessions")
 	sid := initTestSession()
 	type args struct {
-		aSessionDir string
-		aSID        string
+		aStore TStore
+		aSID   string
 	}
 	tests := []struct {
 		name string
 		args args
-		want int //*tSessionData
+		want int //*tSessionRecord
 	}{
 		// TODO: Add test cases.
-		{" 1", args{sdir, sid}, 5},
+		{" 1", args{store, sid}, 5},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := loadSession(tt.args.aSessionDir, tt.args.aSID); len(*got) != tt.want {
-				t.Errorf("loadSession() = %v, want %v", len(*got), tt.want)
+			if got := loadSession(tt.args.aStore, tt.args.aSID); len(got.data) != tt.want {
+				t.Errorf("loadSession() = %v, want %v", len(got.data), tt.want)
 			}
 		})
 	}
 } // Test_loadSession()
+
+func Test_tShMonitor_handle_evicted(t *testing.T) {
+	defer SetCacheLimits(CacheLimits())
+	SetCacheLimits(1, 0)
+	store := &TFileStore{dir: t.TempDir()}
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+
+	s1, s2 := &TSession{sID: newSID()}, &TSession{sID: newSID()}
+	modTime := func() (rTime time.Time) {
+		if fi, err := os.Stat(store.fileName(s1.sID)); nil == err {
+			rTime = fi.ModTime()
+		}
+		return
+	}
+	evict := func() { // and wait for the session to be written
+		before := modTime()
+		s2.Set("Zahl", 2)
+		for i := 0; (100 > i) && modTime().Equal(before); i++ {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond) // let the monitor drop the pending write
+	}
+
+	s1.Set("eins", 1).Set("zwei", 2)
+	evict()
+	if got := s1.Len(); 2 != got {
+		t.Errorf("Len() of evicted session = %v, want %v", got, 2)
+	}
+	evict()
+	if s1.Empty() {
+		t.Error("Empty() of evicted session = true")
+	}
+	evict()
+	if got := s1.Expires(); !got.After(time.Now()) {
+		t.Errorf("Expires() of evicted session = %v", got)
+	}
+	evict()
+	s1.Delete("eins")
+	evict()
+	if s1.Has("eins") || !s1.Has("zwei") {
+		t.Errorf("Delete() of evicted session kept %v", s1.Keys())
+	}
+	evict()
+} // Test_tShMonitor_handle_evicted()
@@ -0,0 +1,419 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides namespaces, i.e. independent sets of session
+ * values used by different parts of an application.
+ *
+ * Each namespace is kept in the session data under a key of its own
+ * (starting with `NamespacePrefix`) holding the namespace's values
+ * along with its settings:
+ *
+ *	"d": the values (`tSessionData`)
+ *	"t": the time of the latest access (`time.Time`)
+ *	"ttl": the idle timeout in nanoseconds (`int64`)
+ *	"mk": the max. number of values (`int64`)
+ *	"mb": the max. encoded size of the values (`int64`)
+ *	"sz": the encoded size of the values (`int64`, if known)
+ *	"sc": the codec "sz" was computed by (`int64`)
+ *
+ * All namespace operations are transactions (see `TSession.Update()`)
+ * replacing the namespace's entry as a whole, so the stored entries
+ * are never changed in place.  Reading a namespace doesn't change the
+ * session, except for refreshing the access time of a namespace with
+ * an idle timeout.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type (
+	// TNamespace is a view of a session restricted to the values of
+	// a certain namespace.
+	//
+	// The values of different namespaces are independent of each
+	// other even if they use the same keys.
+	TNamespace struct {
+		session *TSession
+		name    string
+	}
+
+	// `tNsEntry` is the decoded session entry of a namespace.
+	tNsEntry struct {
+		data     tSessionData  // the namespace's values
+		exists   bool          // whether the namespace was stored
+		touched  time.Time     // the latest access
+		ttl      time.Duration // the idle timeout (zero: none)
+		maxKeys  int64         // max. number of values (zero: unlimited)
+		maxBytes int64         // max. encoded size (zero: unlimited)
+		size     int64         // encoded size of `data` (negative: unknown)
+	}
+)
+
+const (
+	// NamespacePrefix starts the (reserved) session keys holding the
+	// namespaces.
+	NamespacePrefix = "_ns."
+)
+
+var (
+	// ErrNamespaceLimit is returned when setting a value would exceed
+	// a namespace's size limits.
+	ErrNamespaceLimit = errors.New("sessions: namespace limit exceeded")
+)
+
+// Namespace returns a view of the session restricted to the namespace
+// `aName`.
+//
+//	`aName` The name of the namespace.
+func (so *TSession) Namespace(aName string) *TNamespace {
+	return &TNamespace{
+		session: so,
+		name:    aName,
+	}
+} // Namespace()
+
+// Clear removes all values of the namespace (keeping its settings).
+func (ns *TNamespace) Clear() {
+	_ = ns.update(func(aEntry *tNsEntry) error {
+		aEntry.data, aEntry.size = make(tSessionData), 0
+		return nil
+	})
+} // Clear()
+
+// Delete removes the namespace's value identified by `aKey`.
+//
+//	`aKey` The identifier to lookup.
+func (ns *TNamespace) Delete(aKey string) {
+	_ = ns.update(func(aEntry *tNsEntry) error {
+		if value, ok := aEntry.data[aKey]; ok {
+			if 0 <= aEntry.size {
+				aEntry.size -= entrySize(aKey, value)
+			}
+			delete(aEntry.data, aKey)
+		}
+		return nil
+	})
+} // Delete()
+
+// Get returns the namespace's value identified by `aKey`.
+//
+// If `aKey` doesn't exist the method returns `nil`.
+//
+//	`aKey` The identifier to lookup.
+func (ns *TNamespace) Get(aKey string) (rValue interface{}) {
+	ns.read(func(aEntry *tNsEntry) {
+		rValue = aEntry.data[aKey]
+	})
+
+	return copyOut(aKey, rValue)
+} // Get()
+
+// Has returns whether there's a namespace value identified by `aKey`
+// (even if its value is `nil`).
+//
+//	`aKey` The identifier to lookup.
+func (ns *TNamespace) Has(aKey string) (rOK bool) {
+	ns.read(func(aEntry *tNsEntry) {
+		_, rOK = aEntry.data[aKey]
+	})
+
+	return
+} // Has()
+
+// `key()` returns the session key of the namespace.
+func (ns *TNamespace) key() string {
+	return NamespacePrefix + ns.name
+} // key()
+
+// Keys returns the identifiers of the namespace's values in ascending
+// order.
+func (ns *TNamespace) Keys() []string {
+	result := []string{}
+	ns.read(func(aEntry *tNsEntry) {
+		result = sortedKeys(aEntry.data)
+	})
+
+	return result
+} // Keys()
+
+// Len returns the number of the namespace's values.
+func (ns *TNamespace) Len() (rLen int) {
+	ns.read(func(aEntry *tNsEntry) {
+		rLen = len(aEntry.data)
+	})
+
+	return
+} // Len()
+
+// Limits returns the namespace's max. number of values and their max.
+// encoded size in bytes (zero means unlimited).
+func (ns *TNamespace) Limits() (rMaxKeys int, rMaxBytes int64) {
+	ns.read(func(aEntry *tNsEntry) {
+		rMaxKeys, rMaxBytes = int(aEntry.maxKeys), aEntry.maxBytes
+	})
+
+	return
+} // Limits()
+
+// Name returns the namespace's name.
+func (ns *TNamespace) Name() string {
+	return ns.name
+} // Name()
+
+// `read()` calls `aFunc` with the namespace's entry (if the namespace
+// exists) within a transaction.
+//
+// The entry's values are the stored ones, so `aFunc` mustn't change
+// them.  The session isn't modified unless the namespace has an idle
+// timeout; then just its access time is updated.
+//
+//	`aFunc` The function to read the namespace's entry.
+func (ns *TNamespace) read(aFunc func(aEntry *tNsEntry)) {
+	key := ns.key()
+
+	_ = ns.session.Update(func(aTx *TTransaction) error {
+		now := time.Now()
+		entry := loadNsEntry(aTx.data[key], now)
+		if !entry.exists {
+			return nil // nothing to read
+		}
+		aFunc(entry)
+		if (0 >= entry.ttl) || !entry.touched.Add(entry.ttl).After(now) {
+			return nil // no timeout to extend (or expired already)
+		}
+
+		// replace just the access time of the stored entry
+		stored, _ := sessionData(aTx.data[key])
+		refreshed := make(tSessionData, len(stored))
+		for name, value := range stored {
+			refreshed[name] = value
+		}
+		refreshed["t"] = now
+		aTx.modify(key)
+		aTx.data[key] = refreshed
+		return nil
+	})
+} // read()
+
+// Set adds/updates the namespace's value of `aKey` with `aValue`.
+//
+// If the value would make the namespace exceed a limit (see
+// `SetLimits()`) and grow in that respect, it's not stored and an
+// error wrapping `ErrNamespaceLimit` is returned; with the `CopyImmutable` policy (see `SetCopyPolicy()`) an
+// error wrapping `ErrMutableValue` may be returned as well.
+//
+//	`aKey` The identifier to lookup.
+//	`aValue` The value to assign.
+func (ns *TNamespace) Set(aKey string, aValue interface{}) error {
+	value, err := copyIn(aKey, aValue)
+	if nil != err {
+		return err
+	}
+
+	return ns.update(func(aEntry *tNsEntry) error {
+		old, had := aEntry.data[aKey]
+		if !had && (0 < aEntry.maxKeys) &&
+			(aEntry.maxKeys <= int64(len(aEntry.data))) {
+			return fmt.Errorf("%w: %q holds more than %d values",
+				ErrNamespaceLimit, ns.name, aEntry.maxKeys)
+		}
+		if 0 < aEntry.maxBytes {
+			current := aEntry.dataSize()
+			size := current + entrySize(aKey, value)
+			if had {
+				size -= entrySize(aKey, old)
+			}
+			if (aEntry.maxBytes < size) && (current < size) {
+				return fmt.Errorf("%w: %q holds more than %d bytes",
+					ErrNamespaceLimit, ns.name, aEntry.maxBytes)
+			}
+			aEntry.size = size
+		} else {
+			aEntry.size = -1 // not maintained without a size limit
+		}
+		aEntry.data[aKey] = value
+		return nil
+	})
+} // Set()
+
+// SetLimits sets the namespace's max. number of values and their max.
+// encoded size in bytes.
+//
+// The limits are stored with the session data and checked whenever
+// a value is set; values already stored are kept, and only writes
+// making the namespace grow further are rejected.  The size is
+// measured the same way as for the session limits (see
+// `SetSessionLimits()`).
+//
+//	`aMaxKeys` The max. number of values; zero means unlimited.
+//	`aMaxBytes` The max. encoded size of the values; zero means unlimited.
+func (ns *TNamespace) SetLimits(aMaxKeys int, aMaxBytes int64) error {
+	if (0 > aMaxKeys) || (0 > aMaxBytes) {
+		return fmt.Errorf("sessions: invalid namespace limits %d/%d", aMaxKeys, aMaxBytes)
+	}
+
+	return ns.update(func(aEntry *tNsEntry) error {
+		aEntry.maxKeys, aEntry.maxBytes = int64(aMaxKeys), aMaxBytes
+		return nil
+	})
+} // SetLimits()
+
+// SetTTL sets the namespace's idle timeout.
+//
+// If the namespace isn't accessed for `aTTL` its values are removed
+// (while the session and its other namespaces remain).
+// The value is stored with the session data; a negative value is
+// rejected with an error.
+//
+//	`aTTL` The namespace's idle timeout; zero means no timeout.
+func (ns *TNamespace) SetTTL(aTTL time.Duration) error {
+	if 0 > aTTL {
+		return fmt.Errorf("sessions: invalid namespace timeout %v", aTTL)
+	}
+
+	return ns.update(func(aEntry *tNsEntry) error {
+		aEntry.ttl = aTTL
+		return nil
+	})
+} // SetTTL()
+
+// `transaction()` calls `aFunc` with the namespace's entry within a
+// transaction; unless `aFunc` returns an error the entry is stored
+// again (with the access time updated).
+//
+//	`aCreate` Whether to create the namespace if it doesn't exist.
+//	`aFunc` The function to read and modify the namespace's entry.
+func (ns *TNamespace) transaction(aCreate bool, aFunc func(aEntry *tNsEntry) error) error {
+	key := ns.key()
+
+	return ns.session.Update(func(aTx *TTransaction) error {
+		now := time.Now()
+		entry := loadNsEntry(aTx.data[key], now)
+		if !entry.exists && !aCreate {
+			return nil // nothing to read
+		}
+		// work on a copy of the stored values
+		data := make(tSessionData, len(entry.data)+1)
+		for name, value := range entry.data {
+			data[name] = value
+		}
+		entry.data = data
+		if err := aFunc(entry); nil != err {
+			return err
+		}
+		entry.touched = now
+		aTx.modify(key)
+		aTx.data[key] = entry.encode()
+		return nil
+	})
+} // transaction()
+
+// TTL returns the namespace's idle timeout (zero means no timeout).
+func (ns *TNamespace) TTL() (rTTL time.Duration) {
+	ns.read(func(aEntry *tNsEntry) {
+		rTTL = aEntry.ttl
+	})
+
+	return
+} // TTL()
+
+// `update()` calls `aFunc` with the namespace's entry (creating the
+// namespace if necessary) within a transaction.
+//
+//	`aFunc` The function to read and modify the namespace's entry.
+func (ns *TNamespace) update(aFunc func(aEntry *tNsEntry) error) error {
+	return ns.transaction(true, aFunc)
+} // update()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `dataSize()` returns the encoded size of the entry's values (see
+// `encodedSize()`), computing it only if it's not known yet.
+func (ne *tNsEntry) dataSize() int64 {
+	if 0 > ne.size {
+		ne.size = encodedSize(ne.data)
+	}
+
+	return ne.size
+} // dataSize()
+
+// `encode()` returns the session value representing the entry.
+func (ne *tNsEntry) encode() tSessionData {
+	result := tSessionData{
+		"d":   ne.data,
+		"t":   ne.touched,
+		"ttl": int64(ne.ttl),
+		"mk":  ne.maxKeys,
+		"mb":  ne.maxBytes,
+	}
+	if 0 <= ne.size {
+		result["sz"] = ne.size
+		result["sc"] = int64(Codec())
+	}
+
+	return result
+} // encode()
+
+// `loadNsEntry()` returns the namespace entry represented by the
+// session value `aValue`.
+//
+// The entry's values are the stored ones (not a copy); if the
+// namespace wasn't accessed within its idle timeout they're dropped.
+//
+//	`aValue` The session value holding the namespace.
+//	`aNow` The current time.
+func loadNsEntry(aValue interface{}, aNow time.Time) *tNsEntry {
+	result := &tNsEntry{data: make(tSessionData)}
+	stored, ok := sessionData(aValue)
+	if !ok {
+		return result
+	}
+	result.size = -1
+	if codec, ok := intValue(stored["sc"]); ok && (int64(Codec()) == codec) {
+		if size, ok := intValue(stored["sz"]); ok {
+			result.size = size
+		}
+	}
+	result.exists = true
+	result.touched, _ = stored["t"].(time.Time)
+	ttl, _ := intValue(stored["ttl"])
+	result.ttl = time.Duration(ttl)
+	result.maxKeys, _ = intValue(stored["mk"])
+	result.maxBytes, _ = intValue(stored["mb"])
+	if (0 < result.ttl) && !result.touched.Add(result.ttl).After(aNow) {
+		result.size = 0
+		return result // expired
+	}
+	if data, ok := sessionData(stored["d"]); ok {
+		result.data = data
+	}
+
+	return result
+} // loadNsEntry()
+
+// `sessionData()` returns `aValue` as `tSessionData` (the codecs may
+// return nested session data as plain maps).
+//
+//	`aValue` The value to convert.
+func sessionData(aValue interface{}) (tSessionData, bool) {
+	switch v := aValue.(type) {
+	case tSessionData:
+		return v, true
+	case map[string]interface{}:
+		return tSessionData(v), true
+	}
+
+	return nil, false
+} // sessionData()
+
+/* _EoF_ */
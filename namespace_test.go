@@ -0,0 +1,249 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTNamespace(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	cart, wizard := so.Namespace("cart"), so.Namespace("wizard")
+
+	// reading doesn't create a namespace
+	if got := cart.Get("Artikel"); nil != got {
+		t.Errorf("Get() = %v, want %v", got, nil)
+	}
+	if got := so.Len(); 0 != got {
+		t.Errorf("Len() after reading = %v, want %v", got, 0)
+	}
+
+	_ = cart.Set("Schritt", "Bezahlung")
+	_ = cart.Set("Anzahl", 3)
+	_ = wizard.Set("Schritt", 2)
+	so.Set("Schritt", true)
+	if got := cart.Get("Schritt"); "Bezahlung" != got {
+		t.Errorf("cart.Get() = %v, want %v", got, "Bezahlung")
+	}
+	if got := wizard.Get("Schritt"); 2 != got {
+		t.Errorf("wizard.Get() = %v, want %v", got, 2)
+	}
+	if got := so.Get("Schritt"); true != got {
+		t.Errorf("Get() = %v, want %v", got, true)
+	}
+	if got, want := cart.Keys(), []string{"Anzahl", "Schritt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	if !cart.Has("Anzahl") || wizard.Has("Anzahl") {
+		t.Error("Has() doesn't separate the namespaces")
+	}
+
+	cart.Delete("Anzahl")
+	if got := cart.Len(); 1 != got {
+		t.Errorf("Len() after Delete() = %v, want %v", got, 1)
+	}
+	cart.Clear()
+	if got := cart.Len(); 0 != got {
+		t.Errorf("Len() after Clear() = %v, want %v", got, 0)
+	}
+	if got := wizard.Len(); 1 != got {
+		t.Errorf("wizard.Len() after cart.Clear() = %v, want %v", got, 1)
+	}
+} // TestTNamespace()
+
+func TestTNamespace_limits(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	ns := (&TSession{sID: newSID()}).Namespace("cart")
+
+	if err := ns.SetLimits(-1, 0); nil == err {
+		t.Error("SetLimits(-1): no error")
+	}
+	_ = ns.SetLimits(2, 1024)
+	if maxKeys, maxBytes := ns.Limits(); (2 != maxKeys) || (1024 != maxBytes) {
+		t.Errorf("Limits() = %d, %d, want %d, %d", maxKeys, maxBytes, 2, 1024)
+	}
+	_ = ns.Set("eins", 1)
+	_ = ns.Set("zwei", 2)
+	if err := ns.Set("drei", 3); !errors.Is(err, ErrNamespaceLimit) {
+		t.Errorf("Set() error = %v, want %v", err, ErrNamespaceLimit)
+	}
+	if err := ns.Set("zwei", 22); nil != err {
+		t.Errorf("Set() of existing key error = %v", err)
+	}
+	if err := ns.Set("eins", strings.Repeat("x", 2048)); !errors.Is(err, ErrNamespaceLimit) {
+		t.Errorf("Set() error = %v, want %v", err, ErrNamespaceLimit)
+	}
+	if got := ns.Get("eins"); 1 != got {
+		t.Errorf("Get() after rejected Set() = %v, want %v", got, 1)
+	}
+} // TestTNamespace_limits()
+
+func TestTNamespace_limits_shrink(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	ns := so.Namespace("cart")
+	size := func() (int64, int64) {
+		entry, _ := sessionData(so.Get(ns.key()))
+		data, _ := sessionData(entry["d"])
+		got, _ := intValue(entry["sz"])
+		return got, encodedSize(data)
+	}
+
+	_ = ns.Set("eins", strings.Repeat("x", 512))
+	_ = ns.Set("zwei", 2)
+	_ = ns.Set("drei", 3)
+	_ = ns.SetLimits(2, 256) // lowered below the current values
+
+	if err := ns.Set("zwei", 22); nil != err {
+		t.Errorf("Set() same size error = %v", err)
+	}
+	if err := ns.Set("eins", "x"); nil != err {
+		t.Errorf("Set() shrinking error = %v", err)
+	}
+	if got, want := size(); got != want {
+		t.Errorf("size = %d, want %d", got, want)
+	}
+	if err := ns.Set("vier", 4); !errors.Is(err, ErrNamespaceLimit) {
+		t.Errorf("Set() error = %v, want %v", err, ErrNamespaceLimit)
+	}
+	ns.Delete("drei")
+	if got, want := size(); got != want {
+		t.Errorf("size after Delete() = %d, want %d", got, want)
+	}
+	if err := ns.Set("zwei", strings.Repeat("x", 512)); !errors.Is(err, ErrNamespaceLimit) {
+		t.Errorf("Set() error = %v, want %v", err, ErrNamespaceLimit)
+	}
+} // TestTNamespace_limits_shrink()
+
+func TestTNamespace_SetTTL(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	cart, prefs := so.Namespace("cart"), so.Namespace("prefs")
+
+	_ = cart.Set("Artikel", "Buch")
+	_ = prefs.Set("Sprache", "de")
+	if err := cart.SetTTL(-time.Second); nil == err {
+		t.Error("SetTTL(-1s): no error")
+	}
+	if err := cart.SetTTL(50 * time.Millisecond); nil != err {
+		t.Fatalf("SetTTL() error = %v", err)
+	}
+	if got := cart.TTL(); 50*time.Millisecond != got {
+		t.Errorf("TTL() = %v, want %v", got, 50*time.Millisecond)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := cart.Get("Artikel"); "Buch" != got { // access resets the timeout
+		t.Errorf("Get() = %v, want %v", got, "Buch")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := cart.Get("Artikel"); "Buch" != got {
+		t.Errorf("Get() = %v, want %v", got, "Buch")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := cart.Get("Artikel"); nil != got {
+		t.Errorf("Get() after TTL = %v, want %v", got, nil)
+	}
+	if got := cart.TTL(); 50*time.Millisecond != got {
+		t.Errorf("TTL() after expiry = %v, want %v", got, 50*time.Millisecond)
+	}
+	if got := prefs.Get("Sprache"); "de" != got {
+		t.Errorf("prefs.Get() = %v, want %v", got, "de")
+	}
+} // TestTNamespace_SetTTL()
+
+func TestTNamespace_read(t *testing.T) {
+	le := startLockEngine(NewMemoryStore("", 0), 1)
+	soEngine = le
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	cart := so.Namespace("cart")
+	dirty := func() bool {
+		le.stripes[0].mtx.Lock()
+		defer le.stripes[0].mtx.Unlock()
+		return le.stripes[0].monitor.cache.dirty(so.sID)
+	}
+	values := func() uintptr {
+		entry, _ := sessionData(so.Get(cart.key()))
+		return reflect.ValueOf(entry["d"]).Pointer()
+	}
+
+	_ = cart.Set("Artikel", "Buch")
+	_ = cart.SetLimits(5, 0)
+	so.request(smStoreSession, "", nil)
+	_ = cart.Get("Artikel")
+	_ = cart.Has("Artikel")
+	_ = cart.Keys()
+	_ = cart.Len()
+	_, _ = cart.Limits()
+	_ = cart.TTL()
+	if dirty() {
+		t.Error("reading the namespace changed the session")
+	}
+
+	// with an idle timeout just the access time is refreshed
+	_ = cart.SetTTL(time.Hour)
+	so.request(smStoreSession, "", nil)
+	before := values()
+	if got := cart.Get("Artikel"); "Buch" != got {
+		t.Errorf("Get() = %v, want %v", got, "Buch")
+	}
+	if !dirty() {
+		t.Error("reading the namespace didn't refresh its access time")
+	}
+	if after := values(); before != after {
+		t.Error("reading the namespace replaced its values")
+	}
+} // TestTNamespace_read()
+
+func TestTNamespace_persisted(t *testing.T) {
+	defer SetCodec(CodecGob)
+	for _, codec := range []TCodec{CodecGob, CodecJSON, CodecBinary} {
+		t.Run(codec.String(), func(t *testing.T) {
+			_ = SetCodec(codec)
+			record := newRecord(newSID())
+			so := &TSession{sID: record.sID}
+			soEngine = startMonitors(NewMemoryStore("", 0), 1)
+			ns := so.Namespace("cart")
+			_ = ns.Set("Anzahl", 3)
+			_ = ns.SetLimits(5, 0)
+			_ = ns.SetTTL(time.Hour)
+			record.data[ns.key()] = so.Get(ns.key())
+			stopSession()
+
+			buf, err := encodeRecord(record)
+			if nil != err {
+				t.Fatalf("encodeRecord() error = %v", err)
+			}
+			decoded, err := decodeRecord(buf)
+			if nil != err {
+				t.Fatalf("decodeRecord() error = %v", err)
+			}
+			store := NewMemoryStore("", 0)
+			soEngine = startMonitors(store, 1)
+			defer stopSession()
+			so.Set(ns.key(), decoded.data[ns.key()])
+
+			if got := ns.Get("Anzahl"); 3 != got {
+				t.Errorf("Get() = %v (%T), want %v", got, got, 3)
+			}
+			if maxKeys, _ := ns.Limits(); 5 != maxKeys {
+				t.Errorf("Limits() = %v, want %v", maxKeys, 5)
+			}
+			if got := ns.TTL(); time.Hour != got {
+				t.Errorf("TTL() = %v, want %v", got, time.Hour)
+			}
+		})
+	}
+} // TestTNamespace_persisted()
@@ -0,0 +1,558 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the on-disk format of the session records.
+ *
+ * A session file consists of a fixed-size header followed by the
+ * record's meta data and the encoded session data (payload):
+ *
+ *	offset  size  content
+ *	     0     4  magic bytes "\x89SES"
+ *	     4     1  format version
+ *	     5     1  flags (see `sfFlagXxx` constants)
+ *	     6     1  payload encoding (codec)
+ *	     7     1  reserved (zero)
+ *	     8     2  length of the session ID (`n`)
+ *	    10     n  session ID
+ *	  10+n     8  creation time (Unix nanoseconds)
+ *	  18+n     8  time of last access (Unix nanoseconds)
+ *	  26+n     8  expiry time (Unix nanoseconds)
+ *	  34+n     8  idle timeout (nanoseconds, zero: default)
+ *	  42+n     8  max. lifetime (nanoseconds, zero: default)
+ *	  50+n     4  length of the payload (`m`)
+ *	  54+n     m  payload
+ *
+ * All numbers are stored in big-endian byte order.
+ * Version 1 of the format lacks the two timeouts.
+ *
+ * The first byte of the magic is chosen such that it can never start
+ * a `gob` stream which allows for telling apart the legacy file format
+ * (an untyped `gob` encoded map) from the current one.
+ */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type (
+	// `tSessionRecord` is the typed representation of a session
+	// as it is kept in memory and stored on disk.
+	tSessionRecord struct {
+		sID      string        // the session's ID
+		created  time.Time     // time of the session's creation
+		accessed time.Time     // time of the last access
+		expires  time.Time     // time when the session expires
+		idleTTL  time.Duration // session specific idle timeout
+		maxAge   time.Duration // session specific max. lifetime
+		data     tSessionData  // the actual session data
+
+		// the encoded sizes of the values (see `dataSize()`)
+		sizes     map[string]int64 // `nil`: not computed
+		size      int64            // the sum of `sizes`
+		sizeCodec TCodec           // the codec `sizes` were computed by
+	}
+
+	// Structure of the legacy (unversioned) session files:
+	//
+	//	tStoreStruct{
+	//		"data":    tSessionData,
+	//		"expires": Unix.secs,
+	//		"sid":     aSID,
+	//	}
+	//
+	tStoreStruct map[string]interface{}
+)
+
+const (
+	// `sfMagic` identifies a versioned session file.
+	sfMagic = "\x89SES"
+
+	// `sfVersion` is the current version of the file format.
+	sfVersion = 2
+
+	// `sfHeaderLen` is the size of the fixed file header.
+	sfHeaderLen = 8
+
+	// `sfFlagEncrypted` marks an encrypted payload.
+	sfFlagEncrypted = byte(1 << 0)
+
+	// `sfFlagCompressed` marks a compressed payload.
+	sfFlagCompressed = byte(1 << 1)
+)
+
+var (
+	// ErrBadRecord is returned when a session record can't be parsed.
+	ErrBadRecord = errors.New("sessions: malformed session record")
+
+	// ErrVersion is returned when a session record was written by
+	// a newer (unknown) format version.
+	ErrVersion = errors.New("sessions: unsupported session record version")
+)
+
+func init() {
+	gob.Register(tSessionData{})
+	gob.Register(time.Time{})
+	gob.Register(tStoreStruct{})
+} // init()
+
+// `newRecord()` returns a new, empty session record for `aSID`.
+//
+//	`aSID` The ID of the new session.
+func newRecord(aSID string) *tSessionRecord {
+	result := &tSessionRecord{
+		sID:     aSID,
+		created: time.Now(),
+		data:    make(tSessionData),
+	}
+	result.touch()
+
+	return result
+} // newRecord()
+
+// `clone()` returns a copy of the record.
+//
+// The session data map is copied shallowly so that the monitor can
+// go on modifying its own map while the copy is written to disk.
+func (sr *tSessionRecord) clone() *tSessionRecord {
+	result := *sr
+	result.data = make(tSessionData, len(sr.data))
+	for key, val := range sr.data {
+		result.data[key] = val
+	}
+	result.sizes = nil // not shared with the copy
+
+	return &result
+} // clone()
+
+// `touch()` updates the record's access and expiry times.
+//
+// The session expires after its idle timeout but not later than its
+// max. lifetime after its creation; if the record doesn't define its
+// own timeouts the global ones are used.
+func (sr *tSessionRecord) touch() {
+	sr.accessed = time.Now()
+	idle := sr.idleTTL
+	if 0 >= idle {
+		idle = SessionIdleTimeout() + time.Second
+	}
+	sr.expires = sr.accessed.Add(idle)
+
+	maxAge := sr.maxAge
+	if 0 >= maxAge {
+		maxAge = SessionMaxAge()
+	}
+	if (0 < maxAge) && !sr.created.IsZero() {
+		if limit := sr.created.Add(maxAge); limit.Before(sr.expires) {
+			sr.expires = limit
+		}
+	}
+} // touch()
+
+// `decodeLegacy()` parses a session file written in the legacy
+// (unversioned) `gob` format.
+//
+//	`aBuf` The raw file contents.
+func decodeLegacy(aBuf []byte) (*tSessionRecord, error) {
+	var ss tStoreStruct
+	if err := gob.NewDecoder(bytes.NewReader(aBuf)).Decode(&ss); nil != err {
+		return nil, fmt.Errorf("%w: %v", ErrBadRecord, err)
+	}
+
+	result := &tSessionRecord{}
+	if id, ok := ss["sid"].(string); ok {
+		result.sID = id
+	} else {
+		return nil, ErrBadRecord
+	}
+	if secs, ok := ss["expires"].(int64); ok {
+		result.expires = time.Unix(secs, 0)
+	} else {
+		return nil, ErrBadRecord
+	}
+	if data, ok := ss["data"].(tSessionData); ok {
+		result.data = data
+	} else {
+		result.data = make(tSessionData)
+	}
+	// The legacy format doesn't know about these times
+	// so we use the best approximation available:
+	result.accessed = result.expires.Add(-SessionIdleTimeout())
+	result.created = result.accessed
+
+	return result, nil
+} // decodeLegacy()
+
+// `decodeMeta()` parses the header and meta data of a session
+// record in the current format.
+//
+// It returns the record without its session data, the flags, the
+// codec, the authenticated meta data, and the (raw) payload.
+//
+//	`aBuf` The raw record data.
+func decodeMeta(aBuf []byte) (rRecord *tSessionRecord, rFlags byte, rCodec TCodec, rMeta, rPayload []byte, rErr error) {
+	if sfHeaderLen+2 > len(aBuf) {
+		rErr = ErrBadRecord
+		return
+	}
+	version := aBuf[4]
+	if sfVersion < version {
+		rErr = fmt.Errorf("%w: %d", ErrVersion, version)
+		return
+	}
+	if rCodec = TCodec(aBuf[6]); CodecBinary < rCodec {
+		rErr = fmt.Errorf("%w: unknown payload encoding %d",
+			ErrBadRecord, aBuf[6])
+		return
+	}
+	if rFlags = aBuf[5]; 0 != rFlags&^(sfFlagEncrypted|sfFlagCompressed) {
+		rErr = fmt.Errorf("%w: unknown flags %#x", ErrBadRecord, rFlags)
+		return
+	}
+
+	buf := aBuf[sfHeaderLen:]
+	sLen := int(binary.BigEndian.Uint16(buf))
+	buf = buf[2:]
+	metaLen := 8 + 8 + 8
+	if 1 < version {
+		metaLen += 8 + 8
+	}
+	if sLen+metaLen+4 > len(buf) {
+		rErr = ErrBadRecord
+		return
+	}
+	rRecord = &tSessionRecord{
+		sID: string(buf[:sLen]),
+	}
+	buf = buf[sLen:]
+	rRecord.created = nanoTime(binary.BigEndian.Uint64(buf))
+	rRecord.accessed = nanoTime(binary.BigEndian.Uint64(buf[8:]))
+	rRecord.expires = nanoTime(binary.BigEndian.Uint64(buf[16:]))
+	if 1 < version {
+		rRecord.idleTTL = time.Duration(binary.BigEndian.Uint64(buf[24:]))
+		rRecord.maxAge = time.Duration(binary.BigEndian.Uint64(buf[32:]))
+	}
+	rMeta = aBuf[:len(aBuf)-len(buf)+metaLen]
+	pLen := int(binary.BigEndian.Uint32(buf[metaLen:]))
+	if rPayload = buf[metaLen+4:]; pLen != len(rPayload) {
+		rRecord, rErr = nil, ErrBadRecord
+	}
+
+	return
+} // decodeMeta()
+
+// `decodeRecord()` parses the binary representation of a session
+// record, be it in the current or the legacy format.
+//
+// With encryption enabled unencrypted records are rejected unless
+// they're explicitly allowed (see `SetKeyRing()`).
+//
+//	`aBuf` The raw record data.
+func decodeRecord(aBuf []byte) (*tSessionRecord, error) {
+	if !isRecord(aBuf) {
+		if !allowPlain() {
+			return nil, fmt.Errorf("%w: unencrypted legacy record", ErrDecrypt)
+		}
+		return decodeLegacy(aBuf)
+	}
+	result, flags, codec, meta, buf, err := decodeMeta(aBuf)
+	if nil != err {
+		return nil, err
+	}
+
+	if 0 == flags&sfFlagEncrypted {
+		if !allowPlain() {
+			return nil, fmt.Errorf("%w: unencrypted record", ErrDecrypt)
+		}
+	} else {
+		kr := KeyRing()
+		if nil == kr {
+			return nil, fmt.Errorf("%w: no key ring", ErrDecrypt)
+		}
+		plain, err := kr.open(buf, meta)
+		if nil != err {
+			return nil, err
+		}
+		buf = plain
+	}
+	if 0 != flags&sfFlagCompressed {
+		plain, err := decompress(buf)
+		if nil != err {
+			return nil, err
+		}
+		buf = plain
+	}
+
+	if 0 < len(buf) {
+		data, err := codec.decode(buf)
+		if nil != err {
+			return nil, fmt.Errorf("%w: %v", ErrBadRecord, err)
+		}
+		result.data = data
+	} else {
+		result.data = make(tSessionData)
+	}
+
+	return result, nil
+} // decodeRecord()
+
+// `encodeRecord()` returns the binary representation of `aRecord`
+// in the current file format using the configured codec.
+//
+// Depending on the configuration the payload gets compressed
+// and/or encrypted (in that order).
+//
+//	`aRecord` The session record to encode.
+func encodeRecord(aRecord *tSessionRecord) ([]byte, error) {
+	codec := Codec()
+	payload, err := codec.encode(aRecord.data)
+	if nil != err {
+		return nil, err
+	}
+	if 0xFFFF < len(aRecord.sID) {
+		return nil, fmt.Errorf("%w: session ID too long", ErrBadRecord)
+	}
+	var flags byte
+	if compressed, ok := compress(payload); ok {
+		payload = compressed
+		flags |= sfFlagCompressed
+	}
+	kr := KeyRing()
+	if nil != kr {
+		flags |= sfFlagEncrypted
+	}
+
+	buf := make([]byte, 0, sfHeaderLen+2+len(aRecord.sID)+44+len(payload)+64)
+	buf = append(buf, sfMagic...)
+	buf = append(buf, sfVersion, flags, byte(codec), 0)
+	buf = appendUint16(buf, uint16(len(aRecord.sID)))
+	buf = append(buf, aRecord.sID...)
+	buf = appendUint64(buf, timeNano(aRecord.created))
+	buf = appendUint64(buf, timeNano(aRecord.accessed))
+	buf = appendUint64(buf, timeNano(aRecord.expires))
+	buf = appendUint64(buf, uint64(aRecord.idleTTL))
+	buf = appendUint64(buf, uint64(aRecord.maxAge))
+	if nil != kr {
+		// header and meta data are authenticated but not encrypted
+		if payload, err = kr.seal(payload, buf); nil != err {
+			return nil, err
+		}
+	}
+	buf = appendUint32(buf, uint32(len(payload)))
+	buf = append(buf, payload...)
+
+	return buf, nil
+} // encodeRecord()
+
+// `recordExpiry()` returns the expiry time of the record `aBuf`
+// without decoding its session data.
+//
+//	`aBuf` The raw record data.
+func recordExpiry(aBuf []byte) (time.Time, error) {
+	if !isRecord(aBuf) {
+		record, err := decodeLegacy(aBuf)
+		if nil != err {
+			return time.Time{}, err
+		}
+		return record.expires, nil
+	}
+	record, _, _, _, _, err := decodeMeta(aBuf)
+	if nil != err {
+		return time.Time{}, err
+	}
+
+	return record.expires, nil
+} // recordExpiry()
+
+// `peekExpiry()` returns the expiry time of the versioned record
+// `aBuf` which may end anywhere after the record's meta data.
+//
+// `rOK` is `false` if `aBuf` doesn't start with a complete header
+// of a known format version.
+//
+//	`aBuf` The (beginning of the) raw record data.
+func peekExpiry(aBuf []byte) (rTime time.Time, rOK bool) {
+	if !isRecord(aBuf) || (sfHeaderLen+2 > len(aBuf)) || (sfVersion < aBuf[4]) {
+		return
+	}
+	buf := aBuf[sfHeaderLen:]
+	offset := 2 + int(binary.BigEndian.Uint16(buf)) + 16
+	if offset+8 > len(buf) {
+		return
+	}
+
+	return nanoTime(binary.BigEndian.Uint64(buf[offset:])), true
+} // peekExpiry()
+
+// `isRecord()` reports whether `aBuf` starts with a versioned
+// record header.
+//
+//	`aBuf` The raw data to check.
+func isRecord(aBuf []byte) bool {
+	return (sfHeaderLen <= len(aBuf)) &&
+		(sfMagic == string(aBuf[:len(sfMagic)]))
+} // isRecord()
+
+// `nanoTime()` is the reverse of `timeNano()`.
+//
+//	`aNano` The number of nanoseconds since the Unix epoch.
+func nanoTime(aNano uint64) time.Time {
+	if 0 == aNano {
+		return time.Time{}
+	}
+
+	return time.Unix(0, int64(aNano))
+} // nanoTime()
+
+// `timeNano()` returns `aTime` as nanoseconds since the Unix epoch
+// with the zero time mapped to `0` (zero).
+//
+//	`aTime` The time to convert.
+func timeNano(aTime time.Time) uint64 {
+	if aTime.IsZero() {
+		return 0
+	}
+
+	return uint64(aTime.UnixNano())
+} // timeNano()
+
+// `writeRecordFile()` atomically replaces the file `aFileName`
+// with `aData`.
+//
+// The data is first written (and synced) to a temporary file in
+// the same directory which is then renamed.
+//
+//	`aFileName` The name of the session file to write.
+//	`aData` The encoded session record.
+func writeRecordFile(aFileName string, aData []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(aFileName), filepath.Base(aFileName)+".*.tmp")
+	if nil != err {
+		return err
+	}
+	tmpName := file.Name()
+	if _, err = file.Write(aData); nil == err {
+		err = file.Chmod(0600)
+	}
+	if nil == err { // survive a crash after the rename
+		err = file.Sync()
+	}
+	if cErr := file.Close(); nil == err {
+		err = cErr
+	}
+	if nil == err {
+		err = os.Rename(tmpName, aFileName)
+	}
+	if nil != err {
+		_ = os.Remove(tmpName)
+	}
+
+	return err
+} // writeRecordFile()
+
+// `appendUint16()` appends `aVal` in big-endian byte order to `aBuf`.
+func appendUint16(aBuf []byte, aVal uint16) []byte {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], aVal)
+
+	return append(aBuf, b[:]...)
+} // appendUint16()
+
+// `appendUint32()` appends `aVal` in big-endian byte order to `aBuf`.
+func appendUint32(aBuf []byte, aVal uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], aVal)
+
+	return append(aBuf, b[:]...)
+} // appendUint32()
+
+// `appendUint64()` appends `aVal` in big-endian byte order to `aBuf`.
+func appendUint64(aBuf []byte, aVal uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], aVal)
+
+	return append(aBuf, b[:]...)
+} // appendUint64()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// MigrateSessionDir converts all session files in `aSessionDir`
+// written in the legacy (unversioned) format to the current format.
+//
+// This function is meant to be run offline (i.e. before the session
+// handling is started by `Wrap()`).
+// A running server converts legacy files on the fly anyway: they
+// are read transparently and written back in the current format the
+// next time their session data is stored.
+// Files changed while the migration is running are skipped.
+//
+//	`aSessionDir` The directory where the session files are stored.
+//
+// The function returns the number of converted files and the
+// first error encountered (if any).
+func MigrateSessionDir(aSessionDir string) (rCount int, rErr error) {
+	files, err := filepath.Glob(filepath.Join(aSessionDir, "*.sid"))
+	if nil != err {
+		return 0, err
+	}
+	for _, fName := range files {
+		converted, err := migrateFile(fName)
+		if nil != err {
+			if nil == rErr {
+				rErr = fmt.Errorf("%s: %w", fName, err)
+			}
+			continue
+		}
+		if converted {
+			rCount++
+		}
+	}
+
+	return
+} // MigrateSessionDir()
+
+// `migrateFile()` converts a single legacy session file.
+//
+//	`aFileName` The name of the session file to convert.
+func migrateFile(aFileName string) (bool, error) {
+	fi, err := os.Stat(aFileName)
+	if nil != err {
+		return false, err
+	}
+	buf, err := os.ReadFile(aFileName)
+	if nil != err {
+		return false, err
+	}
+	if isRecord(buf) {
+		return false, nil // nothing to do
+	}
+	record, err := decodeLegacy(buf)
+	if nil != err {
+		return false, err
+	}
+	if buf, err = encodeRecord(record); nil != err {
+		return false, err
+	}
+	if fi2, err := os.Stat(aFileName); (nil != err) || !fi2.ModTime().Equal(fi.ModTime()) {
+		return false, nil // changed (or removed) meanwhile
+	}
+	if err = writeRecordFile(aFileName, buf); nil != err {
+		return false, err
+	}
+
+	return true, nil
+} // migrateFile()
+
+/* _EoF_ */
@@ -0,0 +1,240 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// `legacyFile()` writes a session file in the legacy format.
+func legacyFile(aSessionDir, aSID string, aData tSessionData, aExpires time.Time) error {
+	ss := tStoreStruct{
+		"data":    aData,
+		"expires": aExpires.Unix(),
+		"sid":     aSID,
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ss); nil != err {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(aSessionDir, aSID)+".sid", buf.Bytes(), 0600)
+} // legacyFile()
+
+func Test_encodeRecord(t *testing.T) {
+	now := time.Now()
+	r1 := newRecord("aTestSID")
+	r1.expires = now.Add(time.Hour)
+	r1.data["Datum"] = now.Round(0)
+	r1.data["Real"] = 12345.6789
+	r1.data["Wahr"] = true
+	r1.data["Zahl"] = 123456789
+	r1.data["Zeichenkette"] = "eine Zeichenkette"
+	r2 := newRecord("")
+	tests := []struct {
+		name string
+		rec  *tSessionRecord
+	}{
+		{" 1", r1},
+		{" 2", r2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := encodeRecord(tt.rec)
+			if nil != err {
+				t.Fatalf("encodeRecord() error = %v", err)
+			}
+			if !isRecord(buf) {
+				t.Errorf("isRecord() = false, want true")
+			}
+			got, err := decodeRecord(buf)
+			if nil != err {
+				t.Fatalf("decodeRecord() error = %v", err)
+			}
+			if got.sID != tt.rec.sID {
+				t.Errorf("decodeRecord() sID = %q, want %q", got.sID, tt.rec.sID)
+			}
+			if !got.created.Equal(tt.rec.created) ||
+				!got.accessed.Equal(tt.rec.accessed) ||
+				!got.expires.Equal(tt.rec.expires) {
+				t.Errorf("decodeRecord() times = %v,\nwant %v", got, tt.rec)
+			}
+			if !reflect.DeepEqual(got.data, tt.rec.data) {
+				t.Errorf("decodeRecord() data = %v,\nwant %v", got.data, tt.rec.data)
+			}
+		})
+	}
+} // Test_encodeRecord()
+
+func Test_decodeRecord(t *testing.T) {
+	r1, _ := encodeRecord(newRecord("aTestSID"))
+	r2 := append([]byte{}, r1...)
+	r2[4] = sfVersion + 1
+	tests := []struct {
+		name    string
+		buf     []byte
+		wantErr error
+	}{
+		{" 1", r1, nil},
+		{" 2", r2, ErrVersion},
+		{" 3", r1[:len(r1)-2], ErrBadRecord},
+		{" 4", []byte("garbage"), ErrBadRecord},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeRecord(tt.buf)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("decodeRecord() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+} // Test_decodeRecord()
+
+func TestMigrateSessionDir(t *testing.T) {
+	sdir := t.TempDir()
+	store := &TFileStore{dir: sdir}
+	data := tSessionData{
+		"Zahl":         123456789,
+		"Zeichenkette": "eine Zeichenkette",
+	}
+	expires := time.Now().Add(time.Hour)
+	if err := legacyFile(sdir, "aLegacySID", data, expires); nil != err {
+		t.Fatal(err)
+	}
+	// an already converted file must be left alone
+	goStore(store, newRecord("aCurrentSID"))
+
+	// the legacy file is readable before the migration …
+	if got := loadSession(store, "aLegacySID"); !reflect.DeepEqual(got.data, data) {
+		t.Errorf("loadSession() = %v, want %v", got.data, data)
+	}
+	got, err := MigrateSessionDir(sdir)
+	if nil != err {
+		t.Fatalf("MigrateSessionDir() error = %v", err)
+	}
+	if 1 != got {
+		t.Errorf("MigrateSessionDir() = %d, want %d", got, 1)
+	}
+	buf, _ := os.ReadFile(filepath.Join(sdir, "aLegacySID.sid"))
+	if !isRecord(buf) {
+		t.Errorf("MigrateSessionDir() didn't convert the legacy file")
+	}
+	// … and after it
+	rec := loadSession(store, "aLegacySID")
+	if !reflect.DeepEqual(rec.data, data) {
+		t.Errorf("loadSession() = %v, want %v", rec.data, data)
+	}
+	if rec.expires.Unix() != expires.Unix() {
+		t.Errorf("loadSession() expires = %v, want %v", rec.expires, expires)
+	}
+	if got, _ = MigrateSessionDir(sdir); 0 != got {
+		t.Errorf("MigrateSessionDir() = %d, want %d", got, 0)
+	}
+} // TestMigrateSessionDir()
+
+func Test_tSessionRecord_touch(t *testing.T) {
+	defer SetSessionMaxAge(SessionMaxAge())
+	if err := SetSessionMaxAge(-time.Second); nil == err {
+		t.Error("SetSessionMaxAge(-1s): no error")
+	}
+	_ = SetSessionMaxAge(0)
+	ttl := time.Duration(SessionTTL())*time.Second + time.Second
+
+	r := newRecord("sid1")
+	if got := r.expires.Sub(r.accessed); ttl != got {
+		t.Errorf("touch() idle = %v, want %v", got, ttl)
+	}
+	r.idleTTL = 7 * 24 * time.Hour
+	r.touch()
+	if got := r.expires.Sub(r.accessed); r.idleTTL != got {
+		t.Errorf("touch() idle = %v, want %v", got, r.idleTTL)
+	}
+
+	// the max. lifetime caps the idle timeout …
+	_ = SetSessionMaxAge(time.Hour)
+	r.touch()
+	if want := r.created.Add(time.Hour); !r.expires.Equal(want) {
+		t.Errorf("touch() expires = %v, want %v", r.expires, want)
+	}
+	// … unless the session defines its own one
+	r.maxAge = 30 * 24 * time.Hour
+	r.touch()
+	if got := r.expires.Sub(r.accessed); r.idleTTL != got {
+		t.Errorf("touch() idle = %v, want %v", got, r.idleTTL)
+	}
+	r.created = time.Now().Add(-r.maxAge)
+	r.touch()
+	if r.expires.After(time.Now()) {
+		t.Errorf("touch() extended session beyond its max. lifetime")
+	}
+} // Test_tSessionRecord_touch()
+
+func Test_decodeRecord_timeouts(t *testing.T) {
+	r1 := newRecord("aTestSID")
+	r1.idleTTL, r1.maxAge = time.Hour, 24*time.Hour
+	r1.data["Zahl"] = 1
+	buf, _ := encodeRecord(r1)
+	got, err := decodeRecord(buf)
+	if nil != err {
+		t.Fatalf("decodeRecord() error = %v", err)
+	}
+	if (r1.idleTTL != got.idleTTL) || (r1.maxAge != got.maxAge) {
+		t.Errorf("decodeRecord() timeouts = %v/%v, want %v/%v",
+			got.idleTTL, got.maxAge, r1.idleTTL, r1.maxAge)
+	}
+	if exp, _ := recordExpiry(buf); !exp.Equal(r1.expires) {
+		t.Errorf("recordExpiry() = %v, want %v", exp, r1.expires)
+	}
+
+	// version 1 records lack the timeouts
+	sLen := len(r1.sID)
+	v1 := append([]byte{}, buf[:sfHeaderLen+2+sLen+24]...)
+	v1 = append(v1, buf[sfHeaderLen+2+sLen+40:]...)
+	v1[4] = 1
+	if got, err = decodeRecord(v1); nil != err {
+		t.Fatalf("decodeRecord() of version 1 error = %v", err)
+	}
+	if (0 != got.idleTTL) || (0 != got.maxAge) || (1 != got.data["Zahl"]) ||
+		!got.expires.Equal(r1.expires) {
+		t.Errorf("decodeRecord() of version 1 = %+v", got)
+	}
+} // Test_decodeRecord_timeouts()
+
+func Test_peekExpiry(t *testing.T) {
+	r1 := newRecord("aTestSID")
+	r1.data["Zahl"] = 1
+	buf, _ := encodeRecord(r1)
+	sLen := len(r1.sID)
+	tests := []struct {
+		name   string
+		buf    []byte
+		wantOK bool
+	}{
+		{" 1", buf, true},
+		{" 2", buf[:sfHeaderLen+2+sLen+24], true},
+		{" 3", buf[:sfHeaderLen+2+sLen+23], false},
+		{" 4", buf[:sfHeaderLen], false},
+		{" 5", []byte("kaputt"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := peekExpiry(tt.buf)
+			if ok != tt.wantOK {
+				t.Fatalf("peekExpiry() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && !got.Equal(r1.expires) {
+				t.Errorf("peekExpiry() = %v, want %v", got, r1.expires)
+			}
+		})
+	}
+} // Test_peekExpiry()
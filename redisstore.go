@@ -0,0 +1,473 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides a session store using a key-value server
+ * speaking the Redis protocol (RESP), e.g. Redis, Valkey, or KeyDB.
+ *
+ * Only the few commands needed are implemented (AUTH, SELECT, PING,
+ * GET, SET with EX, DEL, and SCAN); the expiry of sessions is left
+ * to the server.
+ */
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// TRedisOptions are the settings of a `TRedisStore`.
+	TRedisOptions struct {
+		// Password is used to authenticate with the server (if not empty).
+		Password string
+
+		// DB is the number of the database to use.
+		DB int
+
+		// Prefix is prepended to the session IDs to form the keys
+		// (default "session:").
+		Prefix string
+
+		// PoolSize is the max. number of idle connections kept open
+		// (default 8).
+		PoolSize int
+
+		// Timeout limits connecting to the server as well as each
+		// command sent to it (default 5 seconds).
+		Timeout time.Duration
+	}
+
+	// TRedisStore is a session store keeping the sessions in
+	// a key-value server speaking the Redis protocol.
+	TRedisStore struct {
+		addr   string
+		opts   TRedisOptions
+		idle   chan *tRespConn // pool of idle connections
+		mtx    sync.Mutex      // guards `closed`
+		closed bool
+	}
+
+	// `tRespConn` is a single connection to the server.
+	tRespConn struct {
+		conn net.Conn
+		rd   *bufio.Reader
+	}
+
+	// `tRespError` is an error reply sent by the server.
+	tRespError string
+)
+
+const (
+	// `respMaxBulk` is the max. size of a bulk string (the server's
+	// own limit).
+	respMaxBulk = 512 << 20
+
+	// `respMaxArray` is the max. number of elements of an array.
+	respMaxArray = 1 << 20
+)
+
+var (
+	// `errRespProtocol` signals an unexpected reply of the server.
+	errRespProtocol = errors.New("sessions: RESP protocol error")
+)
+
+// NewRedisStore returns a store keeping the sessions in the server
+// listening at `aAddr`.
+//
+// The store checks the connection to the server before returning.
+// Since the server is usually shared by several processes the
+// sessions are not cached between requests (see `TSharedStore`).
+//
+//	`aAddr` The server's address (`host:port`).
+//	`aOptions` The store's settings (`nil` selects the defaults).
+func NewRedisStore(aAddr string, aOptions *TRedisOptions) (*TRedisStore, error) {
+	var opts TRedisOptions
+	if nil != aOptions {
+		opts = *aOptions
+	}
+	if "" == opts.Prefix {
+		opts.Prefix = "session:"
+	}
+	if 0 >= opts.PoolSize {
+		opts.PoolSize = 8
+	}
+	if 0 >= opts.Timeout {
+		opts.Timeout = 5 * time.Second
+	}
+	result := &TRedisStore{
+		addr: aAddr,
+		opts: opts,
+		idle: make(chan *tRespConn, opts.PoolSize),
+	}
+	if _, err := result.do("PING"); nil != err {
+		return nil, err
+	}
+
+	return result, nil
+} // NewRedisStore()
+
+// Close closes all idle connections to the server.
+//
+// Part of the `TStore` interface.
+func (rs *TRedisStore) Close() error {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	if rs.closed {
+		return nil
+	}
+	rs.closed = true
+	close(rs.idle)
+	for rc := range rs.idle {
+		_ = rc.conn.Close()
+	}
+
+	return nil
+} // Close()
+
+// Delete removes the session record of `aSID`.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID being destroyed.
+func (rs *TRedisStore) Delete(aSID string) error {
+	_, err := rs.do("DEL", rs.opts.Prefix+aSID)
+
+	return err
+} // Delete()
+
+// `dial()` opens a new connection to the server.
+func (rs *TRedisStore) dial() (*tRespConn, error) {
+	conn, err := net.DialTimeout("tcp", rs.addr, rs.opts.Timeout)
+	if nil != err {
+		return nil, err
+	}
+	result := &tRespConn{
+		conn: conn,
+		rd:   bufio.NewReader(conn),
+	}
+	if "" != rs.opts.Password {
+		if _, err = result.do(rs.opts.Timeout, "AUTH", rs.opts.Password); nil != err {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if 0 != rs.opts.DB {
+		if _, err = result.do(rs.opts.Timeout, "SELECT", strconv.Itoa(rs.opts.DB)); nil != err {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return result, nil
+} // dial()
+
+// `do()` sends a command to the server and returns its reply.
+//
+// After `Close()` the method returns `os.ErrClosed`.
+//
+//	`aArgs` The command and its arguments.
+func (rs *TRedisStore) do(aArgs ...string) (interface{}, error) {
+	var (
+		rc  *tRespConn
+		err error
+	)
+	rs.mtx.Lock()
+	closed := rs.closed
+	rs.mtx.Unlock()
+	if closed {
+		return nil, os.ErrClosed
+	}
+	select {
+	case rc = <-rs.idle:
+	default:
+	}
+	if nil == rc {
+		if rc, err = rs.dial(); nil != err {
+			return nil, err
+		}
+	}
+
+	result, err := rc.do(rs.opts.Timeout, aArgs...)
+	if _, ok := err.(tRespError); (nil != err) && !ok {
+		// the connection is in an unknown state
+		_ = rc.conn.Close()
+		return nil, err
+	}
+	rs.release(rc)
+
+	return result, err
+} // do()
+
+// Load returns the session record of `aSID`.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID whose data are to be read.
+func (rs *TRedisStore) Load(aSID string) ([]byte, error) {
+	reply, err := rs.do("GET", rs.opts.Prefix+aSID)
+	if nil != err {
+		return nil, err
+	}
+	if nil == reply {
+		return nil, ErrNoSession
+	}
+	if result, ok := reply.([]byte); ok {
+		return result, nil
+	}
+
+	return nil, errRespProtocol
+} // Load()
+
+// Range calls `aFunc` for each session ID stored in the server;
+// iterating stops when `aFunc` returns `false`.
+//
+// The server's `SCAN` command is used, i.e. sessions added or
+// removed while iterating might be missed or reported anyway.
+//
+//	`aFunc` The function to call for each session ID.
+func (rs *TRedisStore) Range(aFunc func(aSID string) bool) error {
+	pLen := len(rs.opts.Prefix)
+	cursor := "0"
+	for {
+		reply, err := rs.do("SCAN", cursor, "MATCH", rs.opts.Prefix+"*", "COUNT", "100")
+		if nil != err {
+			return err
+		}
+		list, ok := reply.([]interface{})
+		if !ok || (2 != len(list)) {
+			return errRespProtocol
+		}
+		next, ok1 := list[0].([]byte)
+		keys, ok2 := list[1].([]interface{})
+		if !ok1 || !ok2 {
+			return errRespProtocol
+		}
+		for _, key := range keys {
+			if k, ok := key.([]byte); ok && (pLen <= len(k)) {
+				if !aFunc(string(k[pLen:])) {
+					return nil
+				}
+			}
+		}
+		if cursor = string(next); "0" == cursor {
+			return nil
+		}
+	}
+} // Range()
+
+// `release()` puts `aConn` back into the pool of idle connections.
+//
+//	`aConn` The connection no longer in use.
+func (rs *TRedisStore) release(aConn *tRespConn) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	if !rs.closed {
+		select {
+		case rs.idle <- aConn:
+			return
+		default: // pool is full
+		}
+	}
+	_ = aConn.conn.Close()
+} // release()
+
+// Scan does nothing since the server removes expired sessions
+// itself (hence the GC emits no `EventExpired` for them).
+//
+// Part of the `TStore` interface.
+func (rs *TRedisStore) Scan(aTime time.Time, aFunc func(aSID string) bool) error {
+	return nil
+} // Scan()
+
+// Shared reports that the server may be used by other processes
+// as well.
+//
+// Part of the `TSharedStore` interface.
+func (rs *TRedisStore) Shared() bool {
+	return true
+} // Shared()
+
+// Store saves `aRecord` as the session record of `aSID`.
+//
+// The record is stored with a TTL so that the server removes it
+// when the session expires.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID of the data to be stored.
+//	`aRecord` The encoded session record.
+//	`aExpires` The session's expiry time.
+func (rs *TRedisStore) Store(aSID string, aRecord []byte, aExpires time.Time) error {
+	ttl := time.Until(aExpires)
+	if 0 >= ttl {
+		return rs.Delete(aSID)
+	}
+	secs := strconv.FormatInt(int64((ttl+time.Second-1)/time.Second), 10)
+	_, err := rs.do("SET", rs.opts.Prefix+aSID, string(aRecord), "EX", secs)
+
+	return err
+} // Store()
+
+// Unlock is a no-op since the store doesn't lock sessions (the data
+// written last wins).
+//
+// Part of the `TSharedStore` interface.
+//
+//	`aSID` The ID of the session to unlock.
+func (rs *TRedisStore) Unlock(aSID string) {
+} // Unlock()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `do()` sends a command to the server and reads its reply.
+//
+//	`aTimeout` The time allowed for the whole exchange.
+//	`aArgs` The command and its arguments.
+func (rc *tRespConn) do(aTimeout time.Duration, aArgs ...string) (interface{}, error) {
+	if err := rc.conn.SetDeadline(time.Now().Add(aTimeout)); nil != err {
+		return nil, err
+	}
+	if _, err := rc.conn.Write(appendRespCommand(nil, aArgs)); nil != err {
+		return nil, err
+	}
+
+	return readRespReply(rc.rd)
+} // do()
+
+// Error returns the error message sent by the server.
+func (re tRespError) Error() string {
+	return "sessions: server error: " + string(re)
+} // Error()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `appendRespCommand()` appends `aArgs` encoded as a RESP array of
+// bulk strings to `aBuf`.
+//
+//	`aBuf` The buffer to append to.
+//	`aArgs` The command and its arguments.
+func appendRespCommand(aBuf []byte, aArgs []string) []byte {
+	aBuf = append(aBuf, '*')
+	aBuf = strconv.AppendInt(aBuf, int64(len(aArgs)), 10)
+	aBuf = append(aBuf, '\r', '\n')
+	for _, arg := range aArgs {
+		aBuf = append(aBuf, '$')
+		aBuf = strconv.AppendInt(aBuf, int64(len(arg)), 10)
+		aBuf = append(aBuf, '\r', '\n')
+		aBuf = append(aBuf, arg...)
+		aBuf = append(aBuf, '\r', '\n')
+	}
+
+	return aBuf
+} // appendRespCommand()
+
+// `readRespLine()` returns the next CRLF terminated line (without
+// the line end).
+//
+//	`aReader` The reader to read from.
+func readRespLine(aReader *bufio.Reader) ([]byte, error) {
+	line, err := aReader.ReadSlice('\n')
+	if nil != err {
+		return nil, err
+	}
+	if (2 > len(line)) || ('\r' != line[len(line)-2]) {
+		return nil, errRespProtocol
+	}
+
+	return line[:len(line)-2], nil
+} // readRespLine()
+
+// `readRespReply()` reads a single reply from `aReader`.
+//
+// The returned value is a `string` (simple string), an `int64`
+// (integer), a `[]byte` (bulk string), an `[]interface{}` (array),
+// or `nil` (null bulk string or array).
+// Error replies are returned as `tRespError`; an error element of an
+// array is returned after reading the whole array (so the connection
+// can be used for the next command).  Lengths exceeding `respMaxBulk`
+// or `respMaxArray` are rejected as protocol errors.
+//
+//	`aReader` The reader to read from.
+func readRespReply(aReader *bufio.Reader) (interface{}, error) {
+	line, err := readRespLine(aReader)
+	if nil != err {
+		return nil, err
+	}
+	if 0 == len(line) {
+		return nil, errRespProtocol
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+
+	case '-':
+		return nil, tRespError(line[1:])
+
+	case ':':
+		num, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if nil != err {
+			return nil, errRespProtocol
+		}
+		return num, nil
+
+	case '$':
+		size, err := strconv.Atoi(string(line[1:]))
+		if (nil != err) || (-1 > size) || (respMaxBulk < size) {
+			return nil, errRespProtocol
+		}
+		if -1 == size {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(aReader, buf); nil != err {
+			return nil, err
+		}
+		if ('\r' != buf[size]) || ('\n' != buf[size+1]) {
+			return nil, errRespProtocol
+		}
+		return buf[:size], nil
+
+	case '*':
+		size, err := strconv.Atoi(string(line[1:]))
+		if (nil != err) || (-1 > size) || (respMaxArray < size) {
+			return nil, errRespProtocol
+		}
+		if -1 == size {
+			return nil, nil
+		}
+		var replyErr error
+		result := make([]interface{}, size)
+		for idx := range result {
+			if result[idx], err = readRespReply(aReader); nil != err {
+				if _, ok := err.(tRespError); !ok {
+					return nil, err // the connection is unusable
+				}
+				if nil == replyErr {
+					replyErr = err // read the remaining elements
+				}
+			}
+		}
+		if nil != replyErr {
+			return nil, replyErr
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown reply type %q", errRespProtocol, line[0])
+} // readRespReply()
+
+/* _EoF_ */
@@ -0,0 +1,318 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+ * A tiny in-process server understanding just the commands used by
+ * `TRedisStore`.
+ */
+
+type (
+	tRespServer struct {
+		ln       net.Listener
+		password string
+		mtx      sync.Mutex
+		data     map[string]tRespEntry
+	}
+
+	tRespEntry struct {
+		value   string
+		expires time.Time
+	}
+)
+
+func startRespServer(t *testing.T, aPassword string) *tRespServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	result := &tRespServer{
+		ln:       ln,
+		password: aPassword,
+		data:     make(map[string]tRespEntry),
+	}
+	go result.serve()
+	t.Cleanup(func() { ln.Close() })
+
+	return result
+} // startRespServer()
+
+func (srv *tRespServer) serve() {
+	for {
+		conn, err := srv.ln.Accept()
+		if nil != err {
+			return
+		}
+		go srv.handle(conn)
+	}
+} // serve()
+
+func (srv *tRespServer) handle(aConn net.Conn) {
+	defer aConn.Close()
+	rd := bufio.NewReader(aConn)
+	authed := "" == srv.password
+	for {
+		reply, err := readRespReply(rd)
+		if nil != err {
+			return
+		}
+		list, _ := reply.([]interface{})
+		args := make([]string, len(list))
+		for idx, arg := range list {
+			b, _ := arg.([]byte)
+			args[idx] = string(b)
+		}
+		if 0 == len(args) {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if !authed && ("AUTH" != cmd) {
+			aConn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+			continue
+		}
+		var out string
+		switch cmd {
+		case "AUTH":
+			if (2 == len(args)) && (srv.password == args[1]) {
+				authed, out = true, "+OK\r\n"
+			} else {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case "PING":
+			out = "+PONG\r\n"
+		case "SELECT":
+			out = "+OK\r\n"
+		default:
+			out = srv.command(cmd, args[1:])
+		}
+		if _, err = aConn.Write([]byte(out)); nil != err {
+			return
+		}
+	}
+} // handle()
+
+func (srv *tRespServer) command(aCmd string, aArgs []string) string {
+	srv.mtx.Lock()
+	defer srv.mtx.Unlock()
+	now := time.Now()
+
+	switch aCmd {
+	case "DEL":
+		n := 0
+		for _, key := range aArgs {
+			if _, ok := srv.data[key]; ok {
+				delete(srv.data, key)
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+
+	case "GET":
+		entry, ok := srv.data[aArgs[0]]
+		if !ok || (!entry.expires.IsZero() && !entry.expires.After(now)) {
+			return "$-1\r\n"
+		}
+		return string(appendRespCommand(nil, []string{entry.value})[4:])
+
+	case "SCAN":
+		var keys []string
+		for key, entry := range srv.data {
+			if ok, _ := path.Match(aArgs[2], key); ok && entry.expires.After(now) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		// return the keys in two chunks to exercise the cursor
+		cursor, start, end := "1", 0, len(keys)/2
+		if "1" == aArgs[0] {
+			cursor, start, end = "0", len(keys)/2, len(keys)
+		}
+		return "*2\r\n" + string(appendRespCommand(nil, []string{cursor})[4:]) +
+			string(appendRespCommand(nil, keys[start:end]))
+
+	case "SET":
+		entry := tRespEntry{value: aArgs[1]}
+		if (4 == len(aArgs)) && ("EX" == aArgs[2]) {
+			secs, _ := strconv.Atoi(aArgs[3])
+			entry.expires = now.Add(time.Duration(secs) * time.Second)
+		}
+		srv.data[aArgs[0]] = entry
+		return "+OK\r\n"
+	}
+
+	return "-ERR unknown command '" + aCmd + "'\r\n"
+} // command()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+func TestNewRedisStore(t *testing.T) {
+	srv := startRespServer(t, "geheim")
+	if _, err := NewRedisStore(srv.ln.Addr().String(), nil); nil == err {
+		t.Error("NewRedisStore() without password: no error")
+	}
+	if _, err := NewRedisStore(srv.ln.Addr().String(), &TRedisOptions{Password: "falsch"}); nil == err {
+		t.Error("NewRedisStore() with wrong password: no error")
+	}
+	rs, err := NewRedisStore(srv.ln.Addr().String(), &TRedisOptions{Password: "geheim", DB: 1})
+	if nil != err {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	rs.Close()
+
+	addr := srv.ln.Addr().String()
+	srv.ln.Close()
+	if _, err = NewRedisStore(addr, &TRedisOptions{Timeout: time.Second}); nil == err {
+		t.Error("NewRedisStore() without server: no error")
+	}
+} // TestNewRedisStore()
+
+func TestTRedisStore(t *testing.T) {
+	srv := startRespServer(t, "")
+	rs, err := NewRedisStore(srv.ln.Addr().String(), &TRedisOptions{PoolSize: 2})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	if !rs.Shared() {
+		t.Error("Shared() = false, want true")
+	}
+
+	expires := time.Now().Add(time.Hour)
+	record := "\x00binary\r\nrecord\xff"
+	_ = rs.Store("sid1", []byte(record), expires)
+	_ = rs.Store("sid2", []byte("zwei"), expires)
+	_ = rs.Store("sid3", []byte("drei"), time.Now().Add(-time.Second))
+
+	if got, _ := rs.Load("sid1"); record != string(got) {
+		t.Errorf("Load() = %q, want %q", got, record)
+	}
+	if _, err = rs.Load("sid3"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() of expired session error = %v, want %v", err, ErrNoSession)
+	}
+	var sids []string
+	if err = rs.Range(func(aSID string) bool {
+		sids = append(sids, aSID)
+		return true
+	}); nil != err {
+		t.Fatalf("Range() error = %v", err)
+	}
+	if (2 != len(sids)) || ("sid1" != sids[0]) || ("sid2" != sids[1]) {
+		t.Errorf("Range() = %v, want %v", sids, []string{"sid1", "sid2"})
+	}
+	if err = rs.Delete("sid1"); nil != err {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err = rs.Load("sid1"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNoSession)
+	}
+
+	// server errors don't break the connection
+	if _, err = rs.do("FLUSHALL"); nil == err {
+		t.Error("do() of unknown command: no error")
+	}
+	if got, _ := rs.Load("sid2"); "zwei" != string(got) {
+		t.Errorf("Load() = %q, want %q", got, "zwei")
+	}
+} // TestTRedisStore()
+
+func TestTRedisStore_pool(t *testing.T) {
+	srv := startRespServer(t, "")
+	rs, _ := NewRedisStore(srv.ln.Addr().String(), &TRedisOptions{PoolSize: 2})
+	defer rs.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; 8 > i; i++ {
+		wg.Add(1)
+		go func(aSID string) {
+			defer wg.Done()
+			for j := 0; 20 > j; j++ {
+				_ = rs.Store(aSID, []byte(aSID), time.Now().Add(time.Minute))
+				if got, err := rs.Load(aSID); (nil != err) || (aSID != string(got)) {
+					t.Errorf("Load() = %q, %v, want %q", got, err, aSID)
+					return
+				}
+			}
+		}("sid" + strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	if got := len(rs.idle); 2 < got {
+		t.Errorf("idle connections = %d, want max. %d", got, 2)
+	}
+} // TestTRedisStore_pool()
+
+func TestTRedisStore_closed(t *testing.T) {
+	srv := startRespServer(t, "")
+	rs, _ := NewRedisStore(srv.ln.Addr().String(), nil)
+	rs.Close()
+
+	if _, err := rs.Load("sid1"); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Load() after Close() error = %v, want %v", err, os.ErrClosed)
+	}
+	if err := rs.Store("sid1", []byte("eins"), time.Now().Add(time.Minute)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Store() after Close() error = %v, want %v", err, os.ErrClosed)
+	}
+} // TestTRedisStore_closed()
+
+func Test_readRespReply(t *testing.T) {
+	// an array holding an error element, followed by the next reply
+	rd := bufio.NewReader(strings.NewReader(
+		"*4\r\n:1\r\n-ERR falsch\r\n*1\r\n-ERR auch\r\n$4\r\nvier\r\n+OK\r\n"))
+	if _, err := readRespReply(rd); "sessions: server error: ERR falsch" != fmt.Sprint(err) {
+		t.Errorf("readRespReply() error = %v, want %q", err, "ERR falsch")
+	}
+	if got, err := readRespReply(rd); ("OK" != got) || (nil != err) {
+		t.Errorf("readRespReply() = %v, %v, want %q", got, err, "OK")
+	}
+
+	// malformed replies are rejected without panicking
+	for _, reply := range []string{
+		"$9223372036854775807\r\n",
+		"*9223372036854775807\r\n",
+		"$536870913\r\n",
+		"$4\r\nvierXX",
+	} {
+		rd = bufio.NewReader(strings.NewReader(reply))
+		if _, err := readRespReply(rd); !errors.Is(err, errRespProtocol) {
+			t.Errorf("readRespReply(%q) error = %v, want %v", reply, err, errRespProtocol)
+		}
+	}
+} // Test_readRespReply()
+
+func TestTRedisStore_sessions(t *testing.T) {
+	srv := startRespServer(t, "")
+	rs, _ := NewRedisStore(srv.ln.Addr().String(), nil)
+	defer rs.Close()
+	soEngine = startMonitors(rs, 1)
+	defer stopSession()
+
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 123456789)
+	so.request(smStoreSession, "", nil)
+
+	if got, _ := rs.Load(so.sID); 0 == len(got) {
+		t.Fatal("session not stored")
+	}
+	so.request(smLoadSession, "", nil)
+	if got, _ := so.GetInt("Zahl"); 123456789 != got {
+		t.Errorf("GetInt() = %v, want %v", got, 123456789)
+	}
+} // TestTRedisStore_sessions()
@@ -0,0 +1,175 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the routing of session requests to several
+ * session monitors (`EngineChannels`).
+ *
+ * The sessions are partitioned by a hash of their IDs, each partition
+ * (shard) being handled by a session monitor goroutine of its own.
+ * All requests for a certain session go to the same monitor, so the
+ * requests of a session are still handled in the order they were sent.
+ */
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+type (
+	// `tShRouter` holds the request channels of the session monitors.
+	tShRouter []chan tShRequest
+)
+
+var (
+	// `soShardCount` is the number of session partitions
+	// (zero: `runtime.GOMAXPROCS()`).
+	soShardCount int64
+)
+
+// MonitorShards returns the number of partitions the sessions are
+// split into, i.e. the number of session monitor goroutines (or
+// mutexes, see `SetEngine()`) started by `Wrap()` or `WrapStore()`.
+func MonitorShards() int {
+	if result := atomic.LoadInt64(&soShardCount); 0 < result {
+		return int(result)
+	}
+
+	return runtime.GOMAXPROCS(0)
+} // MonitorShards()
+
+// SetMonitorShards sets the number of partitions the sessions are
+// split into.
+//
+// The sessions are partitioned by their IDs, each partition being
+// handled by a goroutine (or guarded by a mutex) of its own; this
+// allows for using several CPU cores for the session handling.
+// The value must be set before calling `Wrap()` or `WrapStore()`;
+// later changes have no effect.
+// The cache limits (see `SetCacheLimits()`) are split evenly between
+// the partitions.
+//
+//	`aCount` The number of partitions; zero selects `runtime.GOMAXPROCS()`.
+func SetMonitorShards(aCount int) error {
+	if 0 > aCount {
+		return fmt.Errorf("sessions: invalid number of monitor shards %d", aCount)
+	}
+	atomic.StoreInt64(&soShardCount, int64(aCount))
+
+	return nil
+} // SetMonitorShards()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `startMonitors()` starts `aCount` session monitors using `aStore`
+// and returns the router to send the requests through.
+//
+//	`aStore` The store holding the session records.
+//	`aCount` The number of session monitors to start.
+func startMonitors(aStore TStore, aCount int) tShRouter {
+	if 0 >= aCount {
+		aCount = 1
+	}
+	result := make(tShRouter, aCount)
+	for idx := range result {
+		result[idx] = make(chan tShRequest, 16)
+	}
+	restored := restoreSessions(aStore)
+	for idx := range result {
+		go goMonitor(newMonitor(aStore, result, idx, restored), result[idx], 0 == idx)
+	}
+
+	return result
+} // startMonitors()
+
+// `request()` sends `aRequest` to the monitor handling its session
+// and returns the reply.
+//
+// Part of the `tShEngine` interface.
+//
+//	`aRequest` The request to send (its `reply` channel is set here).
+func (sr tShRouter) request(aRequest tShRequest) *TSession {
+	return sr.requestShard(sr.shard(aRequest.rSID), aRequest)
+} // request()
+
+// `requestCtx()` sends `aRequest` to the monitor handling its session
+// and returns the reply unless `aCtx` is done before.
+//
+// Part of the `tShEngine` interface.
+//
+//	`aCtx` The context bounding the request.
+//	`aRequest` The request to send (its `reply` channel is set here).
+func (sr tShRouter) requestCtx(aCtx context.Context, aRequest tShRequest) (*TSession, error) {
+	// buffered (and never closed) so the monitor doesn't block
+	// when replying to a caller which gave up waiting
+	answer := make(chan *TSession, 1)
+	aRequest.reply = answer
+
+	select {
+	case sr[sr.shard(aRequest.rSID)] <- aRequest:
+	case <-aCtx.Done():
+		return nil, aCtx.Err()
+	}
+
+	select {
+	case result := <-answer:
+		return result, nil
+	case <-aCtx.Done():
+		return nil, aCtx.Err()
+	}
+} // requestCtx()
+
+// `requestShard()` sends `aRequest` to the monitor `aShard` and
+// returns the reply.
+//
+// Part of the `tShEngine` interface.
+//
+//	`aShard` The index of the monitor.
+//	`aRequest` The request to send (its `reply` channel is set here).
+func (sr tShRouter) requestShard(aShard int, aRequest tShRequest) *TSession {
+	answer := make(chan *TSession)
+	defer close(answer)
+
+	aRequest.reply = answer
+	sr[aShard] <- aRequest
+
+	return <-answer
+} // requestShard()
+
+// `shard()` returns the index of the monitor handling the session
+// `aSID`.
+//
+// Part of the `tShEngine` interface.
+//
+//	`aSID` The session ID to route.
+func (sr tShRouter) shard(aSID string) int {
+	return shardIndex(aSID, len(sr))
+} // shard()
+
+// `shards()` returns the number of session monitors.
+//
+// Part of the `tShEngine` interface.
+func (sr tShRouter) shards() int {
+	return len(sr)
+} // shards()
+
+// `terminate()` stops all session monitors.
+//
+// Part of the `tShEngine` interface.
+func (sr tShRouter) terminate() {
+	for _, monitor := range sr {
+		monitor <- tShRequest{
+			rType: smTerminate,
+		}
+	}
+} // terminate()
+
+/* _EoF_ */
@@ -0,0 +1,137 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func Test_tShRouter_shard(t *testing.T) {
+	router := make(tShRouter, 4)
+	counts := make([]int, len(router))
+	for i := 0; 4000 > i; i++ {
+		sid := newSID()
+		idx := router.shard(sid)
+		if idx != router.shard(sid) {
+			t.Fatalf("shard(%q) not stable", sid)
+		}
+		counts[idx]++
+	}
+	for idx, cnt := range counts {
+		if (700 > cnt) || (1300 < cnt) {
+			t.Errorf("shard %d got %d of 4000 sessions", idx, cnt)
+		}
+	}
+	if got := router[:1].shard("egal"); 0 != got {
+		t.Errorf("shard() of single monitor = %d, want %d", got, 0)
+	}
+} // Test_tShRouter_shard()
+
+func TestSetMonitorShards(t *testing.T) {
+	defer SetMonitorShards(0)
+	if err := SetMonitorShards(-1); nil == err {
+		t.Error("SetMonitorShards(-1): no error")
+	}
+	if got := MonitorShards(); runtime.GOMAXPROCS(0) != got {
+		t.Errorf("MonitorShards() = %d, want %d", got, runtime.GOMAXPROCS(0))
+	}
+	_ = SetMonitorShards(3)
+	if got := MonitorShards(); 3 != got {
+		t.Errorf("MonitorShards() = %d, want %d", got, 3)
+	}
+} // TestSetMonitorShards()
+
+func Test_startMonitors(t *testing.T) {
+	store, _ := NewFileStore(t.TempDir())
+	soEngine = startMonitors(store, 4)
+	defer stopSession()
+
+	// the session data move along with the changing IDs
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 1)
+	moved := false
+	for i := 0; 20 > i; i++ {
+		old := so.sID
+		so.changeID()
+		moved = moved || (soEngine.shard(old) != soEngine.shard(so.sID))
+		if got, _ := so.GetInt("Zahl"); 1 != got {
+			t.Fatalf("GetInt() after changeID() = %v, want %v", got, 1)
+		}
+	}
+	if !moved {
+		t.Error("changeID() never moved the session to another monitor")
+	}
+
+	for i := 0; 100 > i; i++ {
+		(&TSession{sID: newSID()}).Set("Zahl", i)
+	}
+	if got := CacheStats().Entries; 101 != got {
+		t.Errorf("CacheStats().Entries = %d, want %d", got, 101)
+	}
+} // Test_startMonitors()
+
+func Test_startMonitors_memory(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "sessions.snapshot")
+	ms := NewMemoryStore(fName, 0)
+	soEngine = startMonitors(ms, 4)
+	(&TSession{}).Len() // make sure the monitors have started
+	sids := make([]string, 20)
+	for idx := range sids {
+		sids[idx] = newSID()
+		(&TSession{sID: sids[idx]}).Set("Zahl", idx)
+	}
+	if err := ms.Close(); nil != err {
+		t.Fatalf("Close() error = %v", err)
+	}
+	stopSession()
+
+	// the snapshot holds the sessions of all monitors
+	ms = NewMemoryStore(fName, 0)
+	soEngine = startMonitors(ms, 3)
+	defer stopSession()
+	for idx, sid := range sids {
+		if got, _ := (&TSession{sID: sid}).GetInt("Zahl"); int64(idx) != got {
+			t.Errorf("GetInt() = %v, want %v", got, idx)
+		}
+	}
+} // Test_startMonitors_memory()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `benchmarkMonitors()` runs parallel session requests against
+// `aShards` session monitors.
+func benchmarkMonitors(b *testing.B, aShards int) {
+	soEngine = startMonitors(NewMemoryStore("", 0), aShards)
+	defer stopSession()
+	var mtx sync.Mutex
+	worker := 0
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		mtx.Lock()
+		worker++
+		so := &TSession{sID: newSID() + strconv.Itoa(worker)}
+		mtx.Unlock()
+		for i := 0; pb.Next(); i++ {
+			so.Set("Zahl", i)
+			_, _ = so.GetInt("Zahl")
+			_ = so.Len()
+		}
+	})
+} // benchmarkMonitors()
+
+func BenchmarkMonitor_single(b *testing.B) {
+	benchmarkMonitors(b, 1)
+} // BenchmarkMonitor_single()
+
+func BenchmarkMonitor_sharded(b *testing.B) {
+	benchmarkMonitors(b, runtime.GOMAXPROCS(0))
+} // BenchmarkMonitor_sharded()
@@ -17,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -34,12 +35,30 @@ type (
 // Since the ID changes are handle internally by the `Wrap()` function
 // this method is not exported but kept private.
 func (so *TSession) changeID() *TSession {
-	result := so.request(smChangeSession, "", nil)
-	so.sID = result.sID
+	engine := soEngine
+	newsid := newSID()
+	if engine.shard(so.sID) == engine.shard(newsid) {
+		so.sID = so.request(smChangeSession, "", newsid).sID
+		return so
+	}
+
+	// move the session to the partition of the new ID
+	record := so.request(smDetachSession, "", nil).sValue
+	so.sID = engine.request(tShRequest{
+		rKey:   so.sID,
+		rSID:   newsid,
+		rType:  smAttachSession,
+		rValue: record,
+	}).sID
 
 	return so
 } // ChangeID()
 
+// Clear removes all session data while keeping the session itself.
+func (so *TSession) Clear() *TSession {
+	return so.request(smClearSession, "", nil)
+} // Clear()
+
 // Delete removes the session data identified by `aKey`.
 //
 //	`aKey` The identifier to lookup.
@@ -71,12 +90,14 @@ func (so *TSession) Empty() bool {
 // Get returns the session data identified by `aKey`.
 //
 // If `aKey` doesn't exist the method returns `nil`.
+// With the `CopyDeep` policy (see `SetCopyPolicy()`) a copy of the
+// stored value is returned.
 //
 //	`aKey` The identifier to lookup.
 func (so *TSession) Get(aKey string) interface{} {
 	result := so.request(smGetKey, aKey, nil)
 
-	return result.sValue
+	return copyOut(aKey, result.sValue)
 } // Get()
 
 // GetBool returns the `boolean` session data identified by `aKey`.
@@ -108,20 +129,15 @@ func (so *TSession) GetBool(aKey string) (rBool, rOK bool) {
 //	`aKey` The identifier to lookup.
 func (so *TSession) GetFloat(aKey string) (float64, bool) {
 	result := so.request(smGetKey, aKey, nil)
-	if f, ok := result.sValue.(float64); ok {
-		return f, true
-	}
-	if f, ok := result.sValue.(float32); ok {
-		return float64(f), true
-	}
 
-	return 0, false
+	return valueAs[float64](result.sValue)
 } // GetFloat()
 
 // GetInt returns the `int` session data identified by `aKey`.
 //
 // The second (`bool`) return value signals whether a session
-// value of type `int` is associated with `aKey`.
+// value of an integer type (fitting into `int64`) is associated
+// with `aKey`.
 //
 // If `aKey` doesn't exist the method returns `0` (zero)
 // and `false`.
@@ -129,15 +145,26 @@ func (so *TSession) GetFloat(aKey string) (float64, bool) {
 //	`aKey` The identifier to lookup.
 func (so *TSession) GetInt(aKey string) (int64, bool) {
 	result := so.request(smGetKey, aKey, nil)
-	if i, ok := result.sValue.(int64); ok {
-		return i, true
+
+	return intValue(result.sValue)
+} // GetInt()
+
+// GetMany returns the session data identified by `aKeys`.
+//
+// Keys without session data are missing in the returned map.
+//
+//	`aKeys` The identifiers to lookup.
+func (so *TSession) GetMany(aKeys ...string) map[string]interface{} {
+	if nil == aKeys {
+		aKeys = []string{} // `nil` would select all keys
 	}
-	if i, ok := result.sValue.(int); ok {
-		return int64(i), true
+	result := so.request(smGetMany, "", aKeys)
+	if data, ok := result.sValue.(tSessionData); ok {
+		return copyOutData(data)
 	}
 
-	return 0, false
-} // GetInt()
+	return map[string]interface{}{}
+} // GetMany()
 
 // GetString returns the `string` session data identified by `aKey`.
 //
@@ -174,11 +201,41 @@ func (so *TSession) GetTime(aKey string) (rTime time.Time, rOK bool) {
 	return
 } // GetTime()
 
+// Expires returns the time when the session expires (unless it's
+// accessed again before).
+func (so *TSession) Expires() (rTime time.Time) {
+	result := so.request(smExpires, "", nil)
+	if t, ok := result.sValue.(time.Time); ok {
+		rTime = t
+	}
+
+	return
+} // Expires()
+
+// Has returns whether there's session data identified by `aKey`
+// (even if its value is `nil`).
+//
+//	`aKey` The identifier to lookup.
+func (so *TSession) Has(aKey string) bool {
+	result, _ := so.request(smHasKey, aKey, nil).sValue.(bool)
+
+	return result
+} // Has()
+
 // ID returns the session's ID.
 func (so *TSession) ID() string {
 	return so.sID
 } // ID()
 
+// Keys returns the identifiers of all session data in ascending order.
+func (so *TSession) Keys() []string {
+	if result, ok := so.request(smKeys, "", nil).sValue.([]string); ok {
+		return result
+	}
+
+	return []string{}
+} // Keys()
+
 // Len returns the current length of the list of session variables.
 func (so *TSession) Len() int {
 	result := so.request(smSessionLen, "", nil)
@@ -189,46 +246,155 @@ func (so *TSession) Len() int {
 	return 0
 } // Len()
 
-var (
-	// This channel is used to send requests through to `goMonitor()`
-	// (`tShRequest` defined in `monitor.go`).
-	soSessionChannel = make(chan tShRequest, 2)
-)
+// Range calls `aFunc` for each session data in ascending order of
+// the keys; iterating stops when `aFunc` returns `false`.
+//
+// The session data are read at once before the first call of `aFunc`
+// so `aFunc` may use the session's methods.
+//
+//	`aFunc` The function to call with each key and value.
+func (so *TSession) Range(aFunc func(aKey string, aValue interface{}) bool) {
+	data, _ := so.request(smGetMany, "", nil).sValue.(tSessionData)
+	data = copyOutData(data)
+	for _, key := range sortedKeys(data) {
+		if !aFunc(key, data[key]) {
+			return
+		}
+	}
+} // Range()
 
 // `request()` queries the session monitor for certain data.
 //
 //	`aType` The lookup type.
 //	`aKey` Optional session variable name/key.
 //	`aValue` Optional session variable value.
-func (so *TSession) request(aType tShLookupType, aKey string, aValue interface{}) (rSession *TSession) {
-	answer := make(chan *TSession)
-	defer close(answer)
-
+func (so *TSession) request(aType tShLookupType, aKey string, aValue interface{}) *TSession {
 	// Pass data to the `goMonitor()` function:
-	soSessionChannel <- tShRequest{
+	return soEngine.request(tShRequest{
 		rKey:   aKey,
 		rSID:   so.sID,
 		rType:  aType,
 		rValue: aValue,
-		reply:  answer,
-	}
-	rSession = <-answer
-
-	return
+	})
 } // request()
 
 // Set adds/updates the session data of `aKey` with `aValue`.
 //
+// With the `CopyDeep` policy (see `SetCopyPolicy()`) a copy of
+// `aValue` is stored; with `CopyImmutable` a value of a reference
+// type is rejected (and logged).  A value exceeding the session
+// limits (see `SetSessionLimits()`) is rejected (and logged) as well;
+// use `TrySet()` to handle those errors yourself.
+//
 //	`aKey` The identifier to lookup.
 //	`aValue` The value to assign.
 func (so *TSession) Set(aKey string, aValue interface{}) *TSession {
-	return so.request(smSetKey, aKey, aValue)
+	if err := so.TrySet(aKey, aValue); nil != err {
+		log.Printf("sessions: can't set session value: %v", err)
+	}
+
+	return so
 } // Set()
 
+// SetMany adds/updates the session data of all keys in `aValues`.
+//
+// If the values would exceed the session limits (see
+// `SetSessionLimits()`) none of them is stored (and that's logged).
+//
+//	`aValues` The keys and values to assign.
+func (so *TSession) SetMany(aValues map[string]interface{}) *TSession {
+	values := copyInData(aValues)
+	if 0 == len(values) {
+		return so
+	}
+	if err, ok := so.request(smSetMany, "", values).sValue.(error); ok {
+		log.Printf("sessions: can't set session values: %v", err)
+	}
+
+	return so
+} // SetMany()
+
+// SetMaxAge sets the session's max. lifetime overriding the global
+// `SessionMaxAge()`.
+//
+// The session expires `aMaxAge` after its creation even if it's
+// still in use.
+// The value is stored with the session data; a negative value is
+// rejected with an error.
+//
+//	`aMaxAge` The session's max. lifetime; zero restores the global default.
+func (so *TSession) SetMaxAge(aMaxAge time.Duration) error {
+	if 0 > aMaxAge {
+		return fmt.Errorf("sessions: invalid max. age %v", aMaxAge)
+	}
+	so.request(smSetMaxAge, "", aMaxAge)
+
+	return nil
+} // SetMaxAge()
+
+// SetTTL sets the session's idle timeout overriding the global
+// `SessionIdleTimeout()`, e.g. to keep a shopping cart for a week.
+//
+// The session expires if it's not accessed for `aTTL`.
+// The value is stored with the session data; a negative value is
+// rejected with an error.
+//
+//	`aTTL` The session's idle timeout; zero restores the global default.
+func (so *TSession) SetTTL(aTTL time.Duration) error {
+	if 0 > aTTL {
+		return fmt.Errorf("sessions: invalid idle timeout %v", aTTL)
+	}
+	so.request(smSetTTL, "", aTTL)
+
+	return nil
+} // SetTTL()
+
+// Snapshot returns a deep copy of all session data.
+//
+// The copy is made by the configured codec (see `SetCodec()`), so
+// changing it doesn't affect the session.  If a value can't be
+// encoded by the codec an error wrapping `ErrUnsupportedValue` is
+// returned.
+func (so *TSession) Snapshot() (map[string]interface{}, error) {
+	switch result := so.request(smCopySession, "", nil).sValue.(type) {
+	case tSessionData:
+		return result, nil
+	case error:
+		return nil, result
+	}
+
+	return map[string]interface{}{}, nil
+} // Snapshot()
+
+// TrySet adds/updates the session data of `aKey` with `aValue`
+// returning an error if the value is rejected.
+//
+// If the value would exceed the session limits (see
+// `SetSessionLimits()`) it's not stored and an error wrapping
+// `ErrSessionLimit` is returned; with the `CopyImmutable` policy (see
+// `SetCopyPolicy()`) an error wrapping `ErrMutableValue` may be
+// returned as well.
+//
+//	`aKey` The identifier to lookup.
+//	`aValue` The value to assign.
+func (so *TSession) TrySet(aKey string, aValue interface{}) error {
+	value, err := copyIn(aKey, aValue)
+	if nil != err {
+		return err
+	}
+	if err, ok := so.request(smSetKey, aKey, value).sValue.(error); ok {
+		return err
+	}
+
+	return nil
+} // TrySet()
+
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
 
 // GetSession returns a `TSession` instance for `aRequest`.
 //
+// Loading the session gives up when the request's context is done.
+//
 // `aRequest` is the HTTP request received by the server.
 func GetSession(aRequest *http.Request) *TSession {
 	var sid string
@@ -239,8 +405,11 @@ func GetSession(aRequest *http.Request) *TSession {
 		sid = newSID()
 	}
 	so := &TSession{sID: sid}
+	if result, err := so.requestCtx(ctx, smLoadSession, "", nil); nil == err {
+		return result
+	}
 
-	return so.request(smLoadSession, "", nil)
+	return so
 } // GetSession()
 
 // `newSID()` returns an ID based on time and random bytes.
@@ -256,25 +425,162 @@ func newSID() string {
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
 
 var (
-	// `soSessionTTL` is the max. TTL for an unused session.
+	// `soSessionTTL` is the idle timeout of a session (nanoseconds).
 	// It defaults to 600 seconds (10 minutes).
-	soSessionTTL = 600
+	soSessionTTL = int64(600 * time.Second)
+
+	// `soSessionMaxAge` is the max. lifetime of a session
+	// (nanoseconds, zero: unlimited).
+	soSessionMaxAge int64
+
+	// `soGCInterval` is the time between two GC runs
+	// (nanoseconds, zero: twice the idle timeout).
+	soGCInterval int64
+
+	// `soGCJitter` is the max. random delay added to the GC interval
+	// (nanoseconds).
+	soGCJitter int64
+
+	// `soConfigChanged` is closed (and replaced) to tell the session
+	// monitor about changed GC settings.
+	soConfigChanged = make(chan struct{})
+
+	// `soConfigMtx` guards `soConfigChanged`.
+	soConfigMtx sync.Mutex
 )
 
+// `configChanged()` notifies the session monitor (if any) about
+// changed GC settings.
+func configChanged() {
+	soConfigMtx.Lock()
+	defer soConfigMtx.Unlock()
+
+	close(soConfigChanged)
+	soConfigChanged = make(chan struct{})
+} // configChanged()
+
+// `configNotify()` returns a channel which is closed when the GC
+// settings change.
+func configNotify() <-chan struct{} {
+	soConfigMtx.Lock()
+	defer soConfigMtx.Unlock()
+
+	return soConfigChanged
+} // configNotify()
+
+// GCInterval returns the time between two runs of the garbage
+// collector.
+func GCInterval() time.Duration {
+	if result := atomic.LoadInt64(&soGCInterval); 0 < result {
+		return time.Duration(result)
+	}
+
+	return SessionIdleTimeout() << 1
+} // GCInterval()
+
+// GCJitter returns the max. random delay added to the GC interval.
+func GCJitter() time.Duration {
+	return time.Duration(atomic.LoadInt64(&soGCJitter))
+} // GCJitter()
+
+// SessionIdleTimeout returns the time after which an unused session
+// expires.
+func SessionIdleTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&soSessionTTL))
+} // SessionIdleTimeout()
+
+// SessionMaxAge returns the max. lifetime of a session (zero means
+// unlimited).
+func SessionMaxAge() time.Duration {
+	return time.Duration(atomic.LoadInt64(&soSessionMaxAge))
+} // SessionMaxAge()
+
 // SessionTTL returns the Time-To-Life of a session (in seconds).
+//
+// See `SessionIdleTimeout()` for the exact value.
 func SessionTTL() int {
-	return soSessionTTL
+	return int(SessionIdleTimeout() / time.Second)
 } // SessionTTL()
 
+// SetGCInterval sets the time between two runs of the garbage
+// collector.
+//
+// The new interval applies immediately, i.e. the next run is
+// scheduled `aInterval` (plus jitter) from now.
+//
+//	`aInterval` The time between two GC runs; zero selects twice the idle timeout.
+func SetGCInterval(aInterval time.Duration) error {
+	if 0 > aInterval {
+		return fmt.Errorf("sessions: invalid GC interval %v", aInterval)
+	}
+	atomic.StoreInt64(&soGCInterval, int64(aInterval))
+	configChanged()
+
+	return nil
+} // SetGCInterval()
+
+// SetGCJitter sets the max. random delay added to the GC interval.
+//
+// With several processes sharing a store the jitter keeps them from
+// running their garbage collectors at the same time.
+//
+//	`aJitter` The max. random delay; zero disables the jitter.
+func SetGCJitter(aJitter time.Duration) error {
+	if 0 > aJitter {
+		return fmt.Errorf("sessions: invalid GC jitter %v", aJitter)
+	}
+	atomic.StoreInt64(&soGCJitter, int64(aJitter))
+	configChanged()
+
+	return nil
+} // SetGCJitter()
+
+// SetSessionIdleTimeout sets the time after which an unused session
+// expires.
+//
+// Sessions can override this value by calling `TSession.SetTTL()`.
+// Unless set explicitly (see `SetGCInterval()`) the GC interval
+// follows the new timeout immediately.
+//
+//	`aTimeout` The idle timeout of a session.
+func SetSessionIdleTimeout(aTimeout time.Duration) error {
+	if 0 >= aTimeout {
+		return fmt.Errorf("sessions: invalid idle timeout %v", aTimeout)
+	}
+	atomic.StoreInt64(&soSessionTTL, int64(aTimeout))
+	configChanged()
+
+	return nil
+} // SetSessionIdleTimeout()
+
+// SetSessionMaxAge sets the max. lifetime of a session.
+//
+// In addition to the idle timeout (see `SetSessionIdleTimeout()`)
+// sessions expire `aMaxAge` after their creation, no matter how often
+// they're accessed.
+// Sessions can override this value by calling `TSession.SetMaxAge()`.
+// A negative value is rejected with an error.
+//
+//	`aMaxAge` The max. lifetime of a session; zero disables the limit.
+func SetSessionMaxAge(aMaxAge time.Duration) error {
+	if 0 > aMaxAge {
+		return fmt.Errorf("sessions: invalid max. age %v", aMaxAge)
+	}
+	atomic.StoreInt64(&soSessionMaxAge, int64(aMaxAge))
+
+	return nil
+} // SetSessionMaxAge()
+
 // SetSessionTTL sets the lifetime of a session.
 //
-// `aTTL` is the number of seconds a session's life lasts.
+// `aTTL` is the number of seconds a session's life lasts; values
+// less than one select the default of 600 seconds.
+// See `SetSessionIdleTimeout()` for a more precise alternative.
 func SetSessionTTL(aTTL int) {
-	if 0 < aTTL {
-		soSessionTTL = aTTL
-	} else {
-		soSessionTTL = 600 // 600 seconds == 10 minutes
+	if 0 >= aTTL {
+		aTTL = 600 // 600 seconds == 10 minutes
 	}
+	_ = SetSessionIdleTimeout(time.Duration(aTTL) * time.Second)
 } // SetSessionTTL()
 
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
@@ -313,7 +619,7 @@ func SIDname() string {
 // `checkSessionDir()` checks whether `aSessionDir` exists and
 // creates it if necessary.
 //
-// This function is a helper of and called by `Wrap()`.
+// This function is a helper of and called by `NewFileStore()`.
 func checkSessionDir(aSessionDir string) (rDir string, rErr error) {
 	if rDir, rErr = filepath.Abs(aSessionDir); nil != rErr {
 		return
@@ -340,17 +646,47 @@ var (
 
 // Wrap initialises the session handling.
 //
+// The session data is stored in files within `aSessionDir`
+// (see `NewFileStore()`).
+//
 //	`aNext` The actual responder to the HTTP requests.
 //	`aSessionDir` is the name of the directory to store session files.
 func Wrap(aNext http.Handler, aSessionDir string) http.Handler {
 	soWrapOnce.Do(func() {
-		if dir, err := checkSessionDir(aSessionDir); nil != err {
+		store, err := NewFileStore(aSessionDir)
+		if nil != err {
 			log.Fatalf("%s: %v", os.Args[0], err)
-		} else {
-			go goMonitor(dir, soSessionChannel)
 		}
+		soEngine = startEngine(store)
 	})
 
+	return wrapHandler(aNext)
+} // Wrap()
+
+// WrapStore initialises the session handling using `aStore`
+// to hold the session data.
+//
+// Only the store passed to the first call of either `Wrap()` or
+// `WrapStore()` is used; subsequent calls share that store.
+//
+//	`aNext` The actual responder to the HTTP requests.
+//	`aStore` The storage backend for the session data.
+func WrapStore(aNext http.Handler, aStore TStore) http.Handler {
+	soWrapOnce.Do(func() {
+		soEngine = startEngine(aStore)
+	})
+
+	return wrapHandler(aNext)
+} // WrapStore()
+
+// `wrapHandler()` returns the HTTP handler doing the session handling
+// for `aNext`.
+//
+// This function is a helper of and called by `Wrap()` and `WrapStore()`.
+//
+//	`aNext` The actual responder to the HTTP requests.
+func wrapHandler(aNext http.Handler) http.Handler {
+
 	return http.HandlerFunc(
 		func(aWriter http.ResponseWriter, aRequest *http.Request) {
 			if excludeURL(aRequest.URL.Path) {
@@ -360,17 +696,35 @@ func Wrap(aNext http.Handler, aSessionDir string) http.Handler {
 
 			switch aRequest.Method {
 			case "GET", "POST":
+				reqCtx := aRequest.Context()
 				session := &TSession{
 					sID: aRequest.FormValue(string(soSidName)),
 				}
-				if 0 < len(session.sID) {
-					// load session file from disk
-					session.request(smLoadSession, "", nil)
-				} else {
+				if 0 == len(session.sID) {
 					session.sID = string(soSidName) // dummy value
 				}
-				// replace the old SID by a new ID
-				session.changeID()
+				// work on a copy: the goroutine of an abandoned
+				// `runCtx()` may still be using it
+				work := &TSession{sID: session.sID}
+				err := runCtx(reqCtx, func() {
+					if string(soSidName) != work.sID {
+						// load session file from disk
+						work.request(smLoadSession, "", nil)
+					}
+					// replace the old SID by a new ID
+					work.changeID()
+				}, func() {
+					// finish the session's use by this request
+					work.request(smStoreSession, "", nil)
+				})
+				if nil != err {
+					// the request was cancelled or the engine is stuck
+					http.Error(aWriter,
+						http.StatusText(http.StatusServiceUnavailable),
+						http.StatusServiceUnavailable)
+					return
+				}
+				session.sID = work.sID
 
 				// keep a session reference with the writer
 				hr := &tHRefWriter{
@@ -379,21 +733,24 @@ func Wrap(aNext http.Handler, aSessionDir string) http.Handler {
 				}
 
 				// prepare a reference for `GetSession()`
-				ctx := context.WithValue(aRequest.Context(), soSidName, session.sID)
+				ctx := context.WithValue(reqCtx, soSidName, session.sID)
 				// to not loose any data we want a deep copy here
 				aRequest = aRequest.Clone(ctx)
 
 				// the original handler can access the session now
 				aNext.ServeHTTP(hr, aRequest)
 
-				// save the possibly updated session data
-				session.request(smStoreSession, "", nil)
+				// save the possibly updated session data (which
+				// is done even if we give up waiting for it)
+				_ = runCtx(reqCtx, func() {
+					session.request(smStoreSession, "", nil)
+				}, nil)
 
 			default:
 				// run the original handler
 				aNext.ServeHTTP(aWriter, aRequest)
 			}
 		})
-} // Wrap()
+} // wrapHandler()
 
 /* _EoF_ */
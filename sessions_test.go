@@ -7,25 +7,26 @@ package sessions
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"reflect"
 	"testing"
 	"time"
 )
 
 func initTestSession() string {
-	sdir, _ := checkSessionDir("./sessions")
-	soSessionChannel = make(chan tShRequest, 1)
-	go goMonitor(sdir, soSessionChannel)
-	sData := make(tSessionData)
-	sData["Datum"] = time.Now()
-	sData["Real"] = 12345.6789
-	sData["Wahr"] = true
-	sData["Zahl"] = 123456789
-	sData["Zeichenkette"] = "eine Zeichenkette"
+	store, _ := NewFileStore("./sessions")
+	soEngine = startMonitors(store, 1)
 	sid := newSID() // "aTestSID"
-	goStore(sdir, sid, &sData)
+	record := newRecord(sid)
+	record.data["Datum"] = time.Now()
+	record.data["Real"] = 12345.6789
+	record.data["Wahr"] = true
+	record.data["Zahl"] = 123456789
+	record.data["Zeichenkette"] = "eine Zeichenkette"
+	goStore(store, record)
 	so := &TSession{
 		sID: sid,
 	}
@@ -46,9 +47,7 @@ func initRequest() (string, *http.Request) {
 } // initRequest()
 
 func stopSession() {
-	soSessionChannel <- tShRequest{
-		rType: smTerminate,
-	}
+	soEngine.terminate()
 } // stopSession()
 
 func Test_newID(t *testing.T) {
@@ -75,7 +74,7 @@ func Test_newID(t *testing.T) {
 func TestGetSession(t *testing.T) {
 	sid, req := initRequest()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	w1 := &TSession{sID: sid}
 	type args struct {
@@ -102,7 +101,7 @@ func TestGetSession(t *testing.T) {
 func TestTSession_Get(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	s1 := TSession{sID: sid}
 	now := time.Now()
@@ -137,7 +136,7 @@ func TestTSession_Get(t *testing.T) {
 func TestTSession_GetBool(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	s1 := TSession{sID: sid}
 	type args struct {
@@ -178,7 +177,7 @@ func TestTSession_GetBool(t *testing.T) {
 func TestTSession_GetFloat(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	s1 := TSession{sID: sid}
 	type args struct {
@@ -219,7 +218,7 @@ func TestTSession_GetFloat(t *testing.T) {
 func TestTSession_GetInt(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	s1 := TSession{sID: sid}
 	type args struct {
@@ -257,7 +256,7 @@ func TestTSession_GetInt(t *testing.T) {
 func TestTSession_GetString(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	s1 := TSession{sID: sid}
 	qos := `|0|true|""|0|25|25|"tag:\"=Golang\""|0|29|8|`
@@ -298,7 +297,7 @@ func TestTSession_GetString(t *testing.T) {
 func TestTSession_GetTime(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	s1 := TSession{sID: sid}
 	var zero time.Time
@@ -343,7 +342,7 @@ func TestTSession_GetTime(t *testing.T) {
 func TestTSession_Len(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	s1 := TSession{sID: sid}
 	w1 := 5
@@ -375,7 +374,7 @@ func TestTSession_Len(t *testing.T) {
 func TestTSession_request(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	sid2 := "aTestSID2"
 	s1 := TSession{sID: sid}
@@ -416,7 +415,7 @@ func TestTSession_request(t *testing.T) {
 func TestTSession_Set(t *testing.T) {
 	sid := initTestSession()
 	defer func() {
-		soSessionChannel <- tShRequest{rType: smTerminate}
+		stopSession()
 	}()
 	s1 := TSession{sID: sid}
 	w1 := &s1
@@ -452,3 +451,206 @@ func TestTSession_Set(t *testing.T) {
 	}
 	stopSession()
 } // TestTSession_Set()
+
+func TestTSession_SetTTL(t *testing.T) {
+	sid := initTestSession()
+	defer stopSession()
+	so := &TSession{sID: sid}
+
+	if err := so.SetTTL(-time.Second); nil == err {
+		t.Error("SetTTL(-1s): no error")
+	}
+	if err := so.SetMaxAge(-time.Second); nil == err {
+		t.Error("SetMaxAge(-1s): no error")
+	}
+	before := so.Expires()
+	_ = so.SetTTL(7 * 24 * time.Hour)
+	if got := so.Expires(); !got.After(before.Add(6 * 24 * time.Hour)) {
+		t.Errorf("Expires() = %v after SetTTL()", got)
+	}
+	_ = so.SetMaxAge(time.Hour)
+	if got := so.Expires(); got.After(time.Now().Add(time.Hour)) {
+		t.Errorf("Expires() = %v after SetMaxAge()", got)
+	}
+	_ = so.SetMaxAge(0)
+	_ = so.SetTTL(0)
+	if got := so.Expires(); got.After(time.Now().Add(time.Duration(SessionTTL()+1) * time.Second)) {
+		t.Errorf("Expires() = %v after resetting the timeouts", got)
+	}
+} // TestTSession_SetTTL()
+
+func TestTSession_Keys(t *testing.T) {
+	sid := initTestSession()
+	defer stopSession()
+	so := &TSession{sID: sid}
+
+	want := []string{"Datum", "Real", "Wahr", "Zahl", "Zeichenkette"}
+	if got := so.Keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	so.Set("Nichts", nil)
+	if !so.Has("Nichts") {
+		t.Error("Has(Nichts) = false, want true")
+	}
+	if so.Has("fehlt") {
+		t.Error("Has(fehlt) = true, want false")
+	}
+
+	var keys []string
+	so.Range(func(aKey string, aValue interface{}) bool {
+		keys = append(keys, aKey)
+		so.Delete(aKey) // session methods may be used
+		return 3 > len(keys)
+	})
+	if want := []string{"Datum", "Nichts", "Real"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Range() keys = %v, want %v", keys, want)
+	}
+	if got := so.Len(); 3 != got {
+		t.Errorf("Len() after Range() = %v, want %v", got, 3)
+	}
+
+	so.Clear()
+	if got := so.Keys(); 0 != len(got) {
+		t.Errorf("Keys() after Clear() = %v, want none", got)
+	}
+	if so.ID() != sid {
+		t.Errorf("ID() after Clear() = %q, want %q", so.ID(), sid)
+	}
+} // TestTSession_Keys()
+
+func TestTSession_Clear_stored(t *testing.T) {
+	defer SetCacheLimits(CacheLimits())
+	store := &TFileStore{dir: t.TempDir()}
+	stored := func(aSID string) bool {
+		_, err := os.Stat(store.fileName(aSID))
+		return nil == err
+	}
+	waitFor := func(aSID string, aStored bool) {
+		for i := 0; (200 > i) && (aStored != stored(aSID)); i++ {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	s1, s2 := &TSession{sID: newSID()}, &TSession{sID: newSID()}
+
+	soEngine = startMonitors(store, 1)
+	s1.Set("Wort", "eins").Set("Zahl", 1)
+	s1.request(smStoreSession, "", nil)
+	s2.Set("Wort", "zwei")
+	s2.request(smStoreSession, "", nil)
+	waitFor(s1.sID, true)
+	waitFor(s2.sID, true)
+
+	s1.Clear()
+	s1.request(smStoreSession, "", nil)
+	SetCacheLimits(1, 0)
+	s2.Delete("Wort")                         // the last key …
+	(&TSession{sID: newSID()}).Set("Zahl", 3) // … evicts s2
+	waitFor(s1.sID, false)
+	waitFor(s2.sID, false)
+	stopSession()
+
+	// reload from the store
+	soEngine = startMonitors(store, 1)
+	defer stopSession()
+	if got := s1.Len(); 0 != got {
+		t.Errorf("Len() after Clear() = %v, want %v", got, 0)
+	}
+	if got := s2.Get("Wort"); nil != got {
+		t.Errorf("Get() after Delete() = %v, want %v", got, nil)
+	}
+} // TestTSession_Clear_stored()
+
+func TestTSession_SetMany(t *testing.T) {
+	sid := initTestSession()
+	defer stopSession()
+	so := &TSession{sID: sid}
+
+	so.SetMany(map[string]interface{}{"Zahl": 1, "neu": "neu"})
+	got := so.GetMany("Zahl", "neu", "fehlt")
+	want := map[string]interface{}{"Zahl": 1, "neu": "neu"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMany() = %v, want %v", got, want)
+	}
+	if got := so.GetMany(); 0 != len(got) {
+		t.Errorf("GetMany() without keys = %v, want none", got)
+	}
+	if got := so.Len(); 6 != got {
+		t.Errorf("Len() = %v, want %v", got, 6)
+	}
+} // TestTSession_SetMany()
+
+func TestTSession_Snapshot(t *testing.T) {
+	sid := initTestSession()
+	defer stopSession()
+	so := &TSession{sID: sid}
+	so.Set("Liste", []string{"a", "b"})
+
+	snap, err := so.Snapshot()
+	if nil != err {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if got := len(snap); 6 != got {
+		t.Errorf("len(Snapshot()) = %v, want %v", got, 6)
+	}
+	snap["Liste"].([]string)[0] = "geändert"
+	if got := so.Get("Liste").([]string)[0]; "a" != got {
+		t.Errorf("Get() after changing the snapshot = %q, want %q", got, "a")
+	}
+
+	so.Set("Kanal", make(chan int))
+	if _, err := so.Snapshot(); !errors.Is(err, ErrUnsupportedValue) {
+		t.Errorf("Snapshot() error = %v, want %v", err, ErrUnsupportedValue)
+	}
+} // TestTSession_Snapshot()
+
+func TestSetSessionIdleTimeout(t *testing.T) {
+	defer SetSessionIdleTimeout(SessionIdleTimeout())
+	if err := SetSessionIdleTimeout(0); nil == err {
+		t.Error("SetSessionIdleTimeout(0): no error")
+	}
+	if err := SetSessionIdleTimeout(90 * time.Second); nil != err {
+		t.Fatalf("SetSessionIdleTimeout() error = %v", err)
+	}
+	if got := SessionTTL(); 90 != got {
+		t.Errorf("SessionTTL() = %v, want %v", got, 90)
+	}
+	SetSessionTTL(-1)
+	if got := SessionIdleTimeout(); 600*time.Second != got {
+		t.Errorf("SessionIdleTimeout() = %v, want %v", got, 600*time.Second)
+	}
+} // TestSetSessionIdleTimeout()
+
+func TestSetGCInterval(t *testing.T) {
+	defer SetGCInterval(0)
+	defer SetGCJitter(0)
+	if err := SetGCInterval(-time.Second); nil == err {
+		t.Error("SetGCInterval(-1s): no error")
+	}
+	if err := SetGCJitter(-time.Second); nil == err {
+		t.Error("SetGCJitter(-1s): no error")
+	}
+	if got, want := GCInterval(), SessionIdleTimeout()<<1; want != got {
+		t.Errorf("GCInterval() = %v, want %v", got, want)
+	}
+	_ = SetGCInterval(time.Minute)
+	_ = SetGCJitter(time.Second)
+	for i := 0; 100 > i; i++ {
+		if got := gcDelay(); (time.Minute > got) || (time.Minute+time.Second <= got) {
+			t.Fatalf("gcDelay() = %v, want [%v, %v)", got, time.Minute, time.Minute+time.Second)
+		}
+	}
+
+	// a running monitor picks up the new interval immediately
+	_ = SetGCInterval(time.Hour)
+	_ = SetGCJitter(0)
+	initMemorySession(NewMemoryStore("", 0))
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 1)
+	_ = so.SetTTL(time.Millisecond)
+	_ = SetGCInterval(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if got := CacheStats().Expired; 1 != got {
+		t.Errorf("CacheStats().Expired = %d, want %d", got, 1)
+	}
+} // TestSetGCInterval()
@@ -0,0 +1,305 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides a session store using an SQL database.
+ *
+ * The store is built on `database/sql` only; it's up to the
+ * application to import the database driver and to open the
+ * database.
+ * The sessions are kept in a table with three columns:
+ *
+ *	sid      the session ID (primary key)
+ *	expires  the expiry time (nanoseconds since the Unix epoch)
+ *	record   the encoded session record
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// TSQLDialect selects the SQL syntax variations used by
+	// a `TSQLStore`.
+	TSQLDialect uint8
+
+	// TSQLStore is a session store keeping the sessions in
+	// a table of an SQL database.
+	TSQLStore struct {
+		db      *sql.DB
+		dialect TSQLDialect
+		table   string
+		qDelete string // delete a session
+		qInsert string // insert a new session
+		qLoad   string // read a session
+		qLoadX  string // read a session even if it's expired
+		qScan   string // find expired sessions
+		qUpdate string // update an existing session
+	}
+)
+
+const (
+	// SQLDefault uses `?` placeholders and a `BLOB` column
+	// (e.g. MySQL/MariaDB, SQLite).
+	SQLDefault TSQLDialect = iota
+
+	// SQLPostgres uses `$1` … placeholders and a `BYTEA` column
+	// (PostgreSQL).
+	SQLPostgres
+)
+
+var (
+	// `soTableNameRE` matches the allowed (optionally schema
+	// qualified) table names.
+	soTableNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+)
+
+// NewSQLStore returns a store keeping the sessions in the table
+// `aTable` of the database `aDB`.
+//
+// The table can be created by calling the store's `CreateTable()`
+// method.
+// Since a database is usually shared by several processes the
+// sessions are not cached between requests (see `TSharedStore`).
+//
+//	`aDB` The database to use.
+//	`aTable` The name of the sessions table.
+//	`aDialect` The SQL syntax variation of the database.
+func NewSQLStore(aDB *sql.DB, aTable string, aDialect TSQLDialect) (*TSQLStore, error) {
+	if nil == aDB {
+		return nil, errors.New("sessions: no database given")
+	}
+	if !soTableNameRE.MatchString(aTable) {
+		return nil, fmt.Errorf("sessions: invalid table name %q", aTable)
+	}
+	if SQLPostgres < aDialect {
+		return nil, fmt.Errorf("sessions: unknown SQL dialect %d", aDialect)
+	}
+
+	result := &TSQLStore{
+		db:      aDB,
+		dialect: aDialect,
+		table:   aTable,
+	}
+	result.qDelete = result.query("DELETE FROM %s WHERE sid = ?")
+	result.qInsert = result.query("INSERT INTO %s (sid, expires, record) VALUES (?, ?, ?)")
+	result.qLoad = result.query("SELECT record FROM %s WHERE sid = ? AND expires > ?")
+	result.qLoadX = result.query("SELECT record FROM %s WHERE sid = ?")
+	result.qScan = result.query("SELECT sid FROM %s WHERE expires < ?")
+	result.qUpdate = result.query("UPDATE %s SET expires = ?, record = ? WHERE sid = ?")
+
+	return result, nil
+} // NewSQLStore()
+
+// Close releases the resources held by the store.
+//
+// The database itself is not closed since it's owned by the caller.
+//
+// Part of the `TStore` interface.
+func (ss *TSQLStore) Close() error {
+	return nil
+} // Close()
+
+// CreateTable creates the store's table if it doesn't exist yet.
+//
+// With lots of sessions an index on the `expires` column speeds
+// up the removal of expired sessions; since the syntax for that
+// differs between databases it's not created here.
+func (ss *TSQLStore) CreateTable() error {
+	_, err := ss.db.Exec(ss.Schema())
+
+	return err
+} // CreateTable()
+
+// Delete removes the session record of `aSID`.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID being destroyed.
+func (ss *TSQLStore) Delete(aSID string) error {
+	_, err := ss.db.Exec(ss.qDelete, aSID)
+
+	return err
+} // Delete()
+
+// Load returns the session record of `aSID`.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID whose data are to be read.
+func (ss *TSQLStore) Load(aSID string) ([]byte, error) {
+	var result []byte
+	err := ss.db.QueryRow(ss.qLoad, aSID, time.Now().UnixNano()).Scan(&result)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoSession
+	}
+
+	return result, err
+} // Load()
+
+// LoadExpired returns the session record of `aSID` even if it's
+// expired.
+//
+// Part of the `TExpiredStore` interface.
+//
+//	`aSID` The session ID whose data are to be read.
+func (ss *TSQLStore) LoadExpired(aSID string) ([]byte, error) {
+	var result []byte
+	err := ss.db.QueryRow(ss.qLoadX, aSID).Scan(&result)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoSession
+	}
+
+	return result, err
+} // LoadExpired()
+
+// `query()` returns `aQuery` with the table name inserted and the
+// placeholders adjusted to the store's SQL dialect.
+//
+//	`aQuery` The query using `%s` for the table and `?` placeholders.
+func (ss *TSQLStore) query(aQuery string) string {
+	result := fmt.Sprintf(aQuery, ss.table)
+	if SQLPostgres != ss.dialect {
+		return result
+	}
+
+	var sb strings.Builder
+	for n := 1; ; n++ {
+		idx := strings.IndexByte(result, '?')
+		if 0 > idx {
+			break
+		}
+		sb.WriteString(result[:idx])
+		sb.WriteString("$" + strconv.Itoa(n))
+		result = result[idx+1:]
+	}
+	sb.WriteString(result)
+
+	return sb.String()
+} // query()
+
+// Scan calls `aFunc` for each session expiring before `aTime`.
+//
+// Part of the `TStore` interface.
+//
+//	`aTime` The time to compare the expiry time with.
+//	`aFunc` The function to call for each expired session.
+func (ss *TSQLStore) Scan(aTime time.Time, aFunc func(aSID string) bool) error {
+	rows, err := ss.db.Query(ss.qScan, aTime.UnixNano())
+	if nil != err {
+		return err
+	}
+	// Collect the IDs first to not hold a connection while
+	// `aFunc` (possibly) deletes sessions.
+	var (
+		sid  string
+		sids []string
+	)
+	for rows.Next() {
+		if err = rows.Scan(&sid); nil != err {
+			break
+		}
+		sids = append(sids, sid)
+	}
+	if nil == err {
+		err = rows.Err()
+	}
+	rows.Close()
+	if nil != err {
+		return err
+	}
+
+	for _, sid = range sids {
+		if !aFunc(sid) {
+			break
+		}
+	}
+
+	return nil
+} // Scan()
+
+// Schema returns the SQL statement creating the store's table.
+func (ss *TSQLStore) Schema() string {
+	blob := "BLOB"
+	if SQLPostgres == ss.dialect {
+		blob = "BYTEA"
+	}
+
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	sid VARCHAR(64) NOT NULL PRIMARY KEY,
+	expires BIGINT NOT NULL,
+	record %s NOT NULL
+)`, ss.table, blob)
+} // Schema()
+
+// Shared reports that the database may be used by other processes
+// as well.
+//
+// Part of the `TSharedStore` interface.
+func (ss *TSQLStore) Shared() bool {
+	return true
+} // Shared()
+
+// Store saves `aRecord` as the session record of `aSID`.
+//
+// An existing record is updated, otherwise a new one is inserted.
+// Since there's no portable SQL upsert statement the update is
+// tried first; if another process inserted the same session in the
+// meantime the update is tried once more.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID of the data to be stored.
+//	`aRecord` The encoded session record.
+//	`aExpires` The session's expiry time.
+func (ss *TSQLStore) Store(aSID string, aRecord []byte, aExpires time.Time) (rErr error) {
+	expires := aExpires.UnixNano()
+	for try := 0; 2 > try; try++ {
+		if rErr = ss.upsert(aSID, aRecord, expires); nil == rErr {
+			return
+		}
+	}
+
+	return
+} // Store()
+
+// Unlock is a no-op since the store doesn't lock sessions (the data
+// written last wins).
+//
+// Part of the `TSharedStore` interface.
+//
+//	`aSID` The ID of the session to unlock.
+func (ss *TSQLStore) Unlock(aSID string) {
+} // Unlock()
+
+// `upsert()` updates or inserts the session record of `aSID`.
+//
+//	`aSID` The session ID of the data to be stored.
+//	`aRecord` The encoded session record.
+//	`aExpires` The session's expiry time in nanoseconds.
+func (ss *TSQLStore) upsert(aSID string, aRecord []byte, aExpires int64) error {
+	res, err := ss.db.Exec(ss.qUpdate, aExpires, aRecord, aSID)
+	if nil != err {
+		return err
+	}
+	if rows, err := res.RowsAffected(); (nil == err) && (0 < rows) {
+		return nil
+	}
+	_, err = ss.db.Exec(ss.qInsert, aSID, aExpires, aRecord)
+
+	return err
+} // upsert()
+
+/* _EoF_ */
@@ -0,0 +1,289 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+ * A fake driver understanding just the statements used by
+ * `TSQLStore` (ignoring the table name).
+ */
+
+type (
+	tFakeDriver struct {
+		mtx sync.Mutex
+		dbs map[string]*tFakeDB
+	}
+
+	tFakeDB struct {
+		mtx    sync.Mutex
+		tables int
+		rows   map[string]tFakeRow
+	}
+
+	tFakeRow struct {
+		expires int64
+		record  []byte
+	}
+
+	tFakeConn struct{ db *tFakeDB }
+
+	tFakeStmt struct {
+		db    *tFakeDB
+		query string
+	}
+
+	tFakeRows struct {
+		column string
+		values []driver.Value
+	}
+)
+
+var soFakeDriver = &tFakeDriver{dbs: make(map[string]*tFakeDB)}
+
+func init() {
+	sql.Register("sessionsfake", soFakeDriver)
+} // init()
+
+func (fd *tFakeDriver) Open(aName string) (driver.Conn, error) {
+	fd.mtx.Lock()
+	defer fd.mtx.Unlock()
+	db, ok := fd.dbs[aName]
+	if !ok {
+		db = &tFakeDB{rows: make(map[string]tFakeRow)}
+		fd.dbs[aName] = db
+	}
+
+	return &tFakeConn{db: db}, nil
+} // Open()
+
+func (fc *tFakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake: no transactions")
+} // Begin()
+
+func (fc *tFakeConn) Close() error {
+	return nil
+} // Close()
+
+func (fc *tFakeConn) Prepare(aQuery string) (driver.Stmt, error) {
+	return &tFakeStmt{db: fc.db, query: aQuery}, nil
+} // Prepare()
+
+func (fs *tFakeStmt) Close() error {
+	return nil
+} // Close()
+
+func (fs *tFakeStmt) NumInput() int {
+	return -1
+} // NumInput()
+
+func (fs *tFakeStmt) Exec(aArgs []driver.Value) (driver.Result, error) {
+	db := fs.db
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	switch {
+	case strings.HasPrefix(fs.query, "CREATE TABLE"):
+		db.tables++
+		return driver.RowsAffected(0), nil
+
+	case strings.HasPrefix(fs.query, "DELETE"):
+		sid := aArgs[0].(string)
+		if _, ok := db.rows[sid]; ok {
+			delete(db.rows, sid)
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+
+	case strings.HasPrefix(fs.query, "INSERT"):
+		sid := aArgs[0].(string)
+		if _, ok := db.rows[sid]; ok {
+			return nil, errors.New("fake: duplicate key")
+		}
+		db.rows[sid] = tFakeRow{aArgs[1].(int64), aArgs[2].([]byte)}
+		return driver.RowsAffected(1), nil
+
+	case strings.HasPrefix(fs.query, "UPDATE"):
+		sid := aArgs[2].(string)
+		if _, ok := db.rows[sid]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		db.rows[sid] = tFakeRow{aArgs[0].(int64), aArgs[1].([]byte)}
+		return driver.RowsAffected(1), nil
+	}
+
+	return nil, errors.New("fake: unsupported statement " + fs.query)
+} // Exec()
+
+func (fs *tFakeStmt) Query(aArgs []driver.Value) (driver.Rows, error) {
+	db := fs.db
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	switch {
+	case strings.HasPrefix(fs.query, "SELECT record"):
+		row, ok := db.rows[aArgs[0].(string)]
+		if !ok || ((1 < len(aArgs)) && (row.expires <= aArgs[1].(int64))) {
+			return &tFakeRows{column: "record"}, nil
+		}
+		return &tFakeRows{column: "record", values: []driver.Value{row.record}}, nil
+
+	case strings.HasPrefix(fs.query, "SELECT sid"):
+		result := &tFakeRows{column: "sid"}
+		for sid, row := range db.rows {
+			if row.expires < aArgs[0].(int64) {
+				result.values = append(result.values, sid)
+			}
+		}
+		return result, nil
+	}
+
+	return nil, errors.New("fake: unsupported query " + fs.query)
+} // Query()
+
+func (fr *tFakeRows) Close() error {
+	return nil
+} // Close()
+
+func (fr *tFakeRows) Columns() []string {
+	return []string{fr.column}
+} // Columns()
+
+func (fr *tFakeRows) Next(aDest []driver.Value) error {
+	if 0 == len(fr.values) {
+		return io.EOF
+	}
+	aDest[0], fr.values = fr.values[0], fr.values[1:]
+
+	return nil
+} // Next()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+func openFakeDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sessionsfake", t.Name())
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+} // openFakeDB()
+
+func TestNewSQLStore(t *testing.T) {
+	db := openFakeDB(t)
+	tests := []struct {
+		name    string
+		table   string
+		dialect TSQLDialect
+		wantErr bool
+	}{
+		{" 1", "sessions", SQLDefault, false},
+		{" 2", "app.sessions", SQLPostgres, false},
+		{" 3", "", SQLDefault, true},
+		{" 4", "sessions; DROP TABLE users", SQLDefault, true},
+		{" 5", "sessions", SQLPostgres + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSQLStore(db, tt.table, tt.dialect)
+			if (nil != err) != tt.wantErr {
+				t.Errorf("NewSQLStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := NewSQLStore(nil, "sessions", SQLDefault); nil == err {
+		t.Error("NewSQLStore() without database: no error")
+	}
+} // TestNewSQLStore()
+
+func TestTSQLStore_query(t *testing.T) {
+	db := openFakeDB(t)
+	ss, _ := NewSQLStore(db, "sess", SQLPostgres)
+	want := "UPDATE sess SET expires = $1, record = $2 WHERE sid = $3"
+	if ss.qUpdate != want {
+		t.Errorf("query() = %q, want %q", ss.qUpdate, want)
+	}
+	if !strings.Contains(ss.Schema(), "BYTEA") {
+		t.Errorf("Schema() = %q, want BYTEA column", ss.Schema())
+	}
+	ss, _ = NewSQLStore(db, "sess", SQLDefault)
+	want = "SELECT record FROM sess WHERE sid = ? AND expires > ?"
+	if ss.qLoad != want {
+		t.Errorf("query() = %q, want %q", ss.qLoad, want)
+	}
+} // TestTSQLStore_query()
+
+func TestTSQLStore(t *testing.T) {
+	ss, _ := NewSQLStore(openFakeDB(t), "sessions", SQLDefault)
+	if err := ss.CreateTable(); nil != err {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	defer ss.Close()
+	if !ss.Shared() {
+		t.Error("Shared() = false, want true")
+	}
+
+	expires := time.Now().Add(time.Hour)
+	_ = ss.Store("sid1", []byte("eins"), expires)
+	_ = ss.Store("sid2", []byte("zwei"), time.Now().Add(-time.Second))
+	if err := ss.Store("sid1", []byte("uno"), expires); nil != err {
+		t.Fatalf("Store() update error = %v", err)
+	}
+
+	if got, _ := ss.Load("sid1"); "uno" != string(got) {
+		t.Errorf("Load() = %q, want %q", got, "uno")
+	}
+	if _, err := ss.Load("sid2"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() of expired session error = %v, want %v", err, ErrNoSession)
+	}
+	if got, _ := ss.LoadExpired("sid2"); "zwei" != string(got) {
+		t.Errorf("LoadExpired() = %q, want %q", got, "zwei")
+	}
+	var expired []string
+	_ = ss.Scan(time.Now(), func(aSID string) bool {
+		expired = append(expired, aSID)
+		return true
+	})
+	if (1 != len(expired)) || ("sid2" != expired[0]) {
+		t.Errorf("Scan() = %v, want %v", expired, []string{"sid2"})
+	}
+	if err := ss.Delete("sid1"); nil != err {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := ss.Load("sid1"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNoSession)
+	}
+} // TestTSQLStore()
+
+func TestTSQLStore_sessions(t *testing.T) {
+	ss, _ := NewSQLStore(openFakeDB(t), "sessions", SQLDefault)
+	_ = ss.CreateTable()
+	soEngine = startMonitors(ss, 1)
+	defer stopSession()
+
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 123456789).Set("Zeichenkette", "eine Zeichenkette")
+	so.request(smStoreSession, "", nil)
+
+	record := loadSession(ss, so.sID)
+	if got := record.data["Zeichenkette"]; "eine Zeichenkette" != got {
+		t.Errorf("loadSession() = %v, want %q", got, "eine Zeichenkette")
+	}
+	so.request(smLoadSession, "", nil)
+	if got, _ := so.GetInt("Zahl"); 123456789 != got {
+		t.Errorf("GetInt() = %v, want %v", got, 123456789)
+	}
+} // TestTSQLStore_sessions()
@@ -0,0 +1,486 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the interface of the session storage backends
+ * and the default backend storing each session in a file of its own.
+ *
+ * A file store can be shared by several processes (see
+ * `NewSharedFileStore()`); in that case a process holds an exclusive
+ * advisory lock (`flock(2)`) on a session's lock file ("<SID>.lock")
+ * from loading the session until unlocking it (after storing or
+ * deleting it).  Storing or deleting a session not loaded before
+ * locks it just for the operation.
+ * The lock file is separate from the session file since the latter
+ * is replaced by renaming a temporary file, and a lock belongs to the
+ * file's inode which a rename would swap.
+ * A lock file is removed only by its holder; a process acquiring the
+ * lock checks afterwards whether the file it locked is still the one
+ * in the directory and starts over if it isn't.
+ */
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// TStore is the interface of the session storage backends.
+	//
+	// A store deals with encoded session records only, i.e. the
+	// codec, compression and encryption are applied before the data
+	// is handed to the store (and after it's read from it).
+	// All methods must be safe for concurrent use.
+	TStore interface {
+		// Close releases the resources held by the store.
+		Close() error
+
+		// Delete removes the session record of `aSID`.
+		// Deleting a non-existing record is not an error.
+		Delete(aSID string) error
+
+		// Load returns the session record of `aSID`.
+		// If there is no such record `ErrNoSession` is returned.
+		Load(aSID string) ([]byte, error)
+
+		// Scan calls `aFunc` for each stored session expiring before
+		// `aTime`; scanning stops when `aFunc` returns `false`.
+		Scan(aTime time.Time, aFunc func(aSID string) bool) error
+
+		// Store saves the session record `aRecord` of `aSID` which
+		// expires at `aExpires`.
+		Store(aSID string, aRecord []byte, aExpires time.Time) error
+	}
+
+	// TSharedStore is implemented by stores whose records may be
+	// changed by other processes as well.
+	//
+	// If `Shared()` returns `true` the session monitor keeps a session
+	// in memory only while a request is handled: the session is read
+	// from the store when a request starts and written back (before
+	// the request is answered) when it ends.
+	//
+	// A store may lock a session in `Load()`; the monitor calls
+	// `Unlock()` once for each load when the session is dropped from
+	// memory (after storing or deleting it if necessary).
+	TSharedStore interface {
+		TStore
+
+		// Shared reports whether the store is shared with other
+		// processes.
+		Shared() bool
+
+		// Unlock releases the session of `aSID` locked by `Load()`;
+		// unlocking a session which isn't locked is a no-op.
+		Unlock(aSID string)
+	}
+
+	// TExpiredStore is implemented by stores whose `Load()` doesn't
+	// return expired session records.
+	//
+	// The garbage collector uses it to provide the data of the
+	// sessions it removes to the `EventExpired` hooks.
+	TExpiredStore interface {
+		TStore
+
+		// LoadExpired returns the session record of `aSID` even if
+		// it's expired.
+		// If there is no such record `ErrNoSession` is returned.
+		LoadExpired(aSID string) ([]byte, error)
+	}
+
+	// TWalkStore is implemented by stores which can report every
+	// stored session along with its expiry time.
+	//
+	// The garbage collector uses it (instead of `Scan()`) to tell
+	// how many sessions it examined.
+	TWalkStore interface {
+		TStore
+
+		// Walk calls `aFunc` for each stored session with the
+		// session's expiry time (or the error encountered reading
+		// it); walking stops when `aFunc` returns `false`.
+		// Records which can't be parsed are reported with a zero
+		// expiry time.
+		Walk(aFunc func(aSID string, aExpires time.Time, aErr error) bool) error
+	}
+
+	// TFileStore is a session store keeping each session in a file
+	// of its own.
+	TFileStore struct {
+		dir    string // the directory to store the session files
+		shared bool   // whether other processes use the directory as well
+
+		mtx  sync.Mutex            // guards `held`
+		held map[string]*tHeldLock // the locks of the loaded sessions
+	}
+
+	// `tHeldLock` is the lock of a session loaded from a shared file
+	// store.
+	tHeldLock struct {
+		file  *os.File // the locked lock file
+		loads int      // the number of loads not unlocked yet
+	}
+)
+
+var (
+	// ErrNoSession is returned by a store if there's no record
+	// for a requested session ID.
+	ErrNoSession = errors.New("sessions: no such session")
+
+	// ErrNoLocking is returned by `NewSharedFileStore()` on platforms
+	// without `flock(2)`.
+	ErrNoLocking = errors.New("sessions: no file locking on this platform")
+)
+
+// NewFileStore returns a store keeping each session in a file of its
+// own inside `aSessionDir`.
+//
+// If `aSessionDir` doesn't exist it's created.
+//
+//	`aSessionDir` The directory to store the session files.
+func NewFileStore(aSessionDir string) (*TFileStore, error) {
+	dir, err := checkSessionDir(aSessionDir)
+	if nil != err {
+		return nil, err
+	}
+
+	return &TFileStore{dir: dir}, nil
+} // NewFileStore()
+
+// NewSharedFileStore returns a store keeping each session in a file
+// of its own inside `aSessionDir` which may be used by several
+// processes (e.g. several instances of an application behind a load
+// balancer) at the same time.
+//
+// The consistency guarantees are:
+//
+//   - A process holds a session exclusively from loading it at the
+//     start of a request until storing it at the request's end, so
+//     requests for the same session are serialised across all
+//     processes and no update gets lost.
+//   - Sessions aren't cached between requests: a request always
+//     sees the data written by the last completed request, no
+//     matter which process handled that one.
+//   - A session's data is written before the request is answered.
+//   - A session file is replaced atomically (by renaming a synced
+//     temporary file), so neither readers nor a crash can observe
+//     partially written data.
+//
+// While a process holds a session, requests for it in other processes
+// wait; with the default engine (see `SetEngine()`) the waiting blocks
+// all sessions handled by the same monitor.
+// The locks are advisory and work on local file systems only; on
+// platforms without `flock(2)` `ErrNoLocking` is returned.
+//
+//	`aSessionDir` The directory to store the session files.
+func NewSharedFileStore(aSessionDir string) (*TFileStore, error) {
+	if !flockSupported {
+		return nil, ErrNoLocking
+	}
+	result, err := NewFileStore(aSessionDir)
+	if nil != err {
+		return nil, err
+	}
+	result.shared = true
+
+	return result, nil
+} // NewSharedFileStore()
+
+// Close releases the resources held by the store.
+//
+// Part of the `TStore` interface.
+func (fs *TFileStore) Close() error {
+	return nil
+} // Close()
+
+// Delete removes the session file of `aSID`.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID being destroyed.
+func (fs *TFileStore) Delete(aSID string) error {
+	if fs.shared {
+		lock, held, err := fs.lockSession(aSID)
+		if nil != err {
+			return err
+		}
+		if !held {
+			defer fs.unlockSession(lock, true)
+		} // else the lock file is removed by `Unlock()`
+	}
+
+	err := os.Remove(fs.fileName(aSID))
+	if (nil != err) && os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+} // Delete()
+
+// `fileName()` returns the name of the session file of `aSID`.
+//
+//	`aSID` The session ID.
+func (fs *TFileStore) fileName(aSID string) string {
+	return filepath.Join(fs.dir, aSID) + ".sid"
+} // fileName()
+
+// Load returns the contents of the session file of `aSID`.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID whose data are to be read from disk.
+func (fs *TFileStore) Load(aSID string) ([]byte, error) {
+	if fs.shared {
+		// keep the session locked until it's unlocked
+		lock, _, err := fs.lockSession(aSID)
+		if nil != err {
+			return nil, err
+		}
+		fs.mtx.Lock()
+		if nil == fs.held {
+			fs.held = make(map[string]*tHeldLock)
+		}
+		if held, ok := fs.held[aSID]; ok {
+			held.loads++
+		} else {
+			fs.held[aSID] = &tHeldLock{file: lock, loads: 1}
+		}
+		fs.mtx.Unlock()
+	}
+
+	result, err := os.ReadFile(fs.fileName(aSID))
+	if (nil != err) && os.IsNotExist(err) {
+		return nil, ErrNoSession
+	}
+
+	return result, err
+} // Load()
+
+// `lockFileName()` returns the name of the lock file of `aSID`.
+//
+//	`aSID` The session ID.
+func (fs *TFileStore) lockFileName(aSID string) string {
+	return filepath.Join(fs.dir, aSID) + ".lock"
+} // lockFileName()
+
+// `lockSession()` returns the locked lock file of `aSID` and whether
+// the session is held by this store already (see `Load()`).
+//
+// Unless the session is held the function blocks until the lock is
+// granted.
+//
+//	`aSID` The ID of the session to lock.
+func (fs *TFileStore) lockSession(aSID string) (*os.File, bool, error) {
+	fs.mtx.Lock()
+	held, ok := fs.held[aSID]
+	fs.mtx.Unlock()
+	if ok {
+		return held.file, true, nil
+	}
+
+	fName := fs.lockFileName(aSID)
+	for {
+		file, err := os.OpenFile(fName, os.O_RDWR|os.O_CREATE, 0600)
+		if nil != err {
+			return nil, false, err
+		}
+		if err = lockFile(file, true); nil != err {
+			_ = file.Close()
+			return nil, false, err
+		}
+
+		// The lock file might have been removed (and maybe re-created)
+		// by another process while we were waiting for the lock.
+		fi1, err1 := file.Stat()
+		fi2, err2 := os.Stat(fName)
+		if (nil == err1) && (nil == err2) && os.SameFile(fi1, fi2) {
+			return file, false, nil
+		}
+		_ = unlockFile(file)
+		_ = file.Close()
+	}
+} // lockSession()
+
+// Shared reports whether the store's directory is shared with
+// other processes.
+//
+// Part of the `TSharedStore` interface.
+func (fs *TFileStore) Shared() bool {
+	return fs.shared
+} // Shared()
+
+// Scan calls `aFunc` for each session file expiring before `aTime`.
+//
+// The expiry time is read from the session record's header (records
+// which can't be parsed are considered expired).
+//
+// Part of the `TStore` interface.
+//
+//	`aTime` The time to compare the expiry time with.
+//	`aFunc` The function to call for each expired session.
+func (fs *TFileStore) Scan(aTime time.Time, aFunc func(aSID string) bool) error {
+	return fs.Walk(func(aSID string, aExpires time.Time, aErr error) bool {
+		if (nil != aErr) || aExpires.After(aTime) {
+			return true
+		}
+		return aFunc(aSID)
+	})
+} // Scan()
+
+// Walk calls `aFunc` for each session file with the expiry time
+// of its record.
+//
+// The directory is read in chunks and only the header of each
+// record is read, so walking doesn't need much memory (or I/O)
+// even with lots of sessions.
+//
+// Part of the `TWalkStore` interface.
+//
+//	`aFunc` The function to call for each session.
+func (fs *TFileStore) Walk(aFunc func(aSID string, aExpires time.Time, aErr error) bool) error {
+	dir, err := os.Open(fs.dir)
+	if nil != err {
+		return err
+	}
+	defer dir.Close()
+
+	for {
+		entries, err := dir.ReadDir(256)
+		for _, entry := range entries {
+			fName := entry.Name()
+			if !entry.Type().IsRegular() || !strings.HasSuffix(fName, ".sid") {
+				continue
+			}
+			expires, rErr := fs.readExpiry(filepath.Join(fs.dir, fName))
+			if errors.Is(rErr, ErrNoSession) {
+				continue // removed in the meantime
+			}
+			if !aFunc(fName[:len(fName)-4], expires, rErr) {
+				return nil
+			}
+		}
+		if nil != err {
+			if io.EOF == err {
+				return nil
+			}
+			return err
+		}
+	}
+} // Walk()
+
+// `readExpiry()` returns the expiry time of the session file
+// `aFileName`.
+//
+// Usually just the record's header is read; only session files in
+// the legacy format are read completely.
+// Records which can't be parsed are reported with a zero time.
+//
+//	`aFileName` The name of the session file.
+func (fs *TFileStore) readExpiry(aFileName string) (time.Time, error) {
+	// session files are replaced atomically, so no lock is needed
+	file, err := os.Open(aFileName)
+	if nil != err {
+		if os.IsNotExist(err) {
+			return time.Time{}, ErrNoSession
+		}
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 256)
+	n, err := io.ReadFull(file, buf)
+	if (nil != err) && (io.ErrUnexpectedEOF != err) && (io.EOF != err) {
+		return time.Time{}, err
+	}
+	buf = buf[:n]
+	if result, ok := peekExpiry(buf); ok {
+		return result, nil
+	}
+	if nil == err { // there's more to read
+		rest, err := io.ReadAll(file)
+		if nil != err {
+			return time.Time{}, err
+		}
+		buf = append(buf, rest...)
+	}
+	result, _ := recordExpiry(buf)
+
+	return result, nil
+} // readExpiry()
+
+// Store writes `aRecord` to the session file of `aSID`.
+//
+// Part of the `TStore` interface.
+//
+//	`aSID` The session ID of the data to be stored.
+//	`aRecord` The encoded session record.
+//	`aExpires` The session's expiry time (unused).
+func (fs *TFileStore) Store(aSID string, aRecord []byte, aExpires time.Time) error {
+	if fs.shared {
+		lock, held, err := fs.lockSession(aSID)
+		if nil != err {
+			return err
+		}
+		if !held {
+			defer fs.unlockSession(lock, false)
+		}
+	}
+
+	return writeRecordFile(fs.fileName(aSID), aRecord)
+} // Store()
+
+// `unlockSession()` releases the lock file `aLock` locked by
+// `lockSession()`.
+//
+//	`aLock` The locked lock file.
+//	`aRemove` Whether to remove the lock file.
+func (fs *TFileStore) unlockSession(aLock *os.File, aRemove bool) {
+	if aRemove {
+		// only the lock's holder may remove the file
+		_ = os.Remove(aLock.Name())
+	}
+	_ = unlockFile(aLock)
+	_ = aLock.Close()
+} // unlockSession()
+
+// Unlock releases the session of `aSID` locked by `Load()`.
+//
+// If the session was loaded several times the lock is released with
+// the last call.
+//
+// Part of the `TSharedStore` interface.
+//
+//	`aSID` The ID of the session to unlock.
+func (fs *TFileStore) Unlock(aSID string) {
+	if !fs.shared {
+		return
+	}
+	fs.mtx.Lock()
+	held, ok := fs.held[aSID]
+	if ok {
+		held.loads--
+		if ok = (0 >= held.loads); ok {
+			delete(fs.held, aSID)
+		}
+	}
+	fs.mtx.Unlock()
+	if ok {
+		// a session not stored (anymore) doesn't need its lock file
+		_, err := os.Stat(fs.fileName(aSID))
+		fs.unlockSession(held.file, os.IsNotExist(err))
+	}
+} // Unlock()
+
+/* _EoF_ */
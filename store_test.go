@@ -0,0 +1,241 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// `settleDir()` registers a cleanup waiting for the pending writes to
+// `aDir` (i.e. its temporary files) to finish before the directory is
+// removed.
+func settleDir(t *testing.T, aDir string) {
+	t.Cleanup(func() {
+		for quiet, deadline := 0, time.Now().Add(2*time.Second); (3 > quiet) && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			if tmp, _ := filepath.Glob(filepath.Join(aDir, "*.tmp")); 0 < len(tmp) {
+				quiet = 0
+			} else {
+				quiet++
+			}
+		}
+	})
+} // settleDir()
+
+func TestTFileStore(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	expires := time.Now().Add(time.Hour)
+	eins, _ := encodeRecord(newRecord("sid1"))
+	_ = fs.Store("sid1", eins, expires)
+	_ = fs.Store("sid2", []byte("zwei"), expires) // can't be parsed
+
+	if got, _ := fs.Load("sid1"); string(eins) != string(got) {
+		t.Errorf("Load() = %q, want %q", got, eins)
+	}
+	if _, err = fs.Load("sid3"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNoSession)
+	}
+	var expired []string
+	_ = fs.Scan(time.Now(), func(aSID string) bool {
+		expired = append(expired, aSID)
+		return true
+	})
+	if (1 != len(expired)) || ("sid2" != expired[0]) {
+		t.Errorf("Scan() = %v, want %v", expired, []string{"sid2"})
+	}
+	if err = fs.Delete("sid2"); nil != err {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err = fs.Delete("sid2"); nil != err {
+		t.Errorf("Delete() of missing session error = %v", err)
+	}
+	if _, err = fs.Load("sid2"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNoSession)
+	}
+} // TestTFileStore()
+
+func TestTFileStore_shared(t *testing.T) {
+	sdir := t.TempDir()
+	fs1, _ := NewSharedFileStore(sdir)
+	fs2, _ := NewSharedFileStore(sdir) // "the other process"
+	if !fs1.Shared() {
+		t.Fatal("Shared() = false, want true")
+	}
+	expires := time.Now().Add(time.Hour)
+
+	// concurrent writers and readers never see partial data
+	long := []byte(strings.Repeat("x", 1<<16))
+	short := []byte("y")
+	var wg sync.WaitGroup
+	for i := 0; 4 > i; i++ {
+		wg.Add(2)
+		go func(aStore *TFileStore) {
+			defer wg.Done()
+			for j := 0; 50 > j; j++ {
+				_ = aStore.Store("sid", long, expires)
+				_ = aStore.Store("sid", short, expires)
+			}
+		}([]*TFileStore{fs1, fs2}[i&1])
+		go func(aStore *TFileStore) {
+			defer wg.Done()
+			for j := 0; 100 > j; j++ {
+				got, err := aStore.Load("sid")
+				aStore.Unlock("sid")
+				if errors.Is(err, ErrNoSession) {
+					continue
+				}
+				if (len(long) != len(got)) && (len(short) != len(got)) {
+					t.Errorf("Load() read %d bytes", len(got))
+					return
+				}
+			}
+		}([]*TFileStore{fs2, fs1}[i&1])
+	}
+	wg.Wait()
+
+	if err := fs2.Delete("sid"); nil != err {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := fs1.Load("sid"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNoSession)
+	}
+	if err := fs1.Delete("sid"); nil != err {
+		t.Errorf("Delete() of missing session error = %v", err)
+	}
+	fs1.Unlock("sid")
+	if files, _ := os.ReadDir(sdir); 0 != len(files) {
+		t.Errorf("store left %d files", len(files))
+	}
+} // TestTFileStore_shared()
+
+func TestTFileStore_sharedLock(t *testing.T) {
+	sdir := t.TempDir()
+	expires := time.Now().Add(time.Hour)
+
+	// each store plays a process incrementing a counter: the session
+	// is locked from loading to unlocking, so no update gets lost
+	var wg sync.WaitGroup
+	for i := 0; 4 > i; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fs, _ := NewSharedFileStore(sdir)
+			for j := 0; 25 > j; j++ {
+				buf, _ := fs.Load("sid")
+				cnt, _ := strconv.Atoi(string(buf))
+				_ = fs.Store("sid", []byte(strconv.Itoa(cnt+1)), expires)
+				fs.Unlock("sid")
+			}
+		}()
+	}
+	wg.Wait()
+
+	fs, _ := NewSharedFileStore(sdir)
+	if buf, _ := fs.Load("sid"); "100" != string(buf) {
+		t.Errorf("Load() = %q, want %q", buf, "100")
+	}
+	fs.Unlock("sid")
+} // TestTFileStore_sharedLock()
+
+func TestTFileStore_sharedSession(t *testing.T) {
+	fs1, _ := NewSharedFileStore(t.TempDir())
+	fs2 := &TFileStore{dir: fs1.dir, shared: true}
+	soEngine = startMonitors(fs1, 1)
+	defer stopSession()
+
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 1)
+	so.request(smStoreSession, "", nil)
+	// the session was written before the request got answered
+	if record := loadSession(fs2, so.sID); 1 != record.data["Zahl"] {
+		t.Fatalf("stored data = %v, want %v", record.data, 1)
+	}
+
+	// another process changes the session …
+	record := loadSession(fs2, so.sID)
+	record.data["Zahl"] = 2
+	goStore(fs2, record)
+
+	// … which is seen by the next request
+	so.request(smLoadSession, "", nil)
+	if got, _ := so.GetInt("Zahl"); 2 != got {
+		t.Errorf("GetInt() = %v, want %v", got, 2)
+	}
+
+	// two processes updating the same session concurrently
+	other := startMonitors(fs2, 1)
+	defer other.terminate()
+	var wg sync.WaitGroup
+	for _, engine := range []tShEngine{soEngine, other} {
+		wg.Add(1)
+		go func(aEngine tShEngine) {
+			defer wg.Done()
+			for i := 0; 25 > i; i++ { // one request each
+				aEngine.request(tShRequest{rSID: so.sID, rType: smUpdateSession,
+					rValue: func(aTx *TTransaction) error {
+						cnt, _ := aTx.GetInt("Zahl")
+						aTx.Set("Zahl", cnt+1)
+						return nil
+					}})
+				aEngine.request(tShRequest{rSID: so.sID, rType: smStoreSession})
+			}
+		}(engine)
+	}
+	wg.Wait()
+	if got, _ := so.GetInt("Zahl"); 52 != got {
+		t.Errorf("GetInt() after concurrent updates = %v, want %v", got, 52)
+	}
+	so.request(smStoreSession, "", nil)
+} // TestTFileStore_sharedSession()
+
+func TestTFileStore_Scan(t *testing.T) {
+	fs := &TFileStore{dir: t.TempDir()}
+	r1 := newRecord("sid1")
+	r1.idleTTL = 7 * 24 * time.Hour
+	r1.touch()
+	goStore(fs, r1)
+	goStore(fs, newRecord("sid2"))
+	_ = os.WriteFile(fs.fileName("sid3"), []byte("kaputt"), 0600)
+	_ = os.WriteFile(filepath.Join(fs.dir, "other.txt"), []byte("kaputt"), 0600)
+
+	var expired []string
+	_ = fs.Scan(time.Now().Add(time.Duration(SessionTTL()+2)*time.Second), func(aSID string) bool {
+		expired = append(expired, aSID)
+		return true
+	})
+	sort.Strings(expired)
+	if (2 != len(expired)) || ("sid2" != expired[0]) || ("sid3" != expired[1]) {
+		t.Errorf("Scan() = %v, want %v", expired, []string{"sid2", "sid3"})
+	}
+
+	// the expiry is read from the record, not the file's mtime
+	r4 := newRecord("sid4")
+	r4.idleTTL = time.Millisecond
+	r4.touch()
+	goStore(fs, r4)
+	time.Sleep(2 * time.Millisecond)
+	expired = expired[:0]
+	_ = fs.Scan(time.Now(), func(aSID string) bool {
+		expired = append(expired, aSID)
+		return true
+	})
+	sort.Strings(expired)
+	if (2 != len(expired)) || ("sid4" != expired[1]) {
+		t.Errorf("Scan() = %v, want %v", expired, []string{"sid3", "sid4"})
+	}
+} // TestTFileStore_Scan()
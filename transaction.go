@@ -0,0 +1,234 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides atomic read-modify-write operations on the data
+ * of a single session.
+ *
+ * The transaction's function is run by the session engine itself
+ * (i.e. with exclusive access to the session) and works on a copy of
+ * the session data which replaces the original only if the function
+ * succeeds.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+type (
+	// TTransaction provides exclusive access to a session's data
+	// during `TSession.Update()`.
+	TTransaction struct {
+		data    tSessionData        // the (possibly copied) session data
+		changed bool                // whether `data` is a modified copy
+		keys    map[string]struct{} // the keys of the changed values
+		err     error               // the first value rejected by `Set()`
+	}
+)
+
+var (
+	// ErrNotInteger is returned by `TSession.Incr()` if the session
+	// value to increment isn't an integer.
+	ErrNotInteger = errors.New("sessions: session value is not an integer")
+)
+
+// `changes()` returns the keys of the values changed by the
+// transaction.
+func (tx *TTransaction) changes() []string {
+	result := make([]string, 0, len(tx.keys))
+	for key := range tx.keys {
+		result = append(result, key)
+	}
+
+	return result
+} // changes()
+
+// Delete removes the session data identified by `aKey`.
+//
+//	`aKey` The identifier to lookup.
+func (tx *TTransaction) Delete(aKey string) {
+	if _, ok := tx.data[aKey]; ok {
+		tx.modify(aKey)
+		delete(tx.data, aKey)
+	}
+} // Delete()
+
+// Get returns the session data identified by `aKey`.
+//
+// If `aKey` doesn't exist the method returns `nil`.
+// With the `CopyNone` policy (see `SetCopyPolicy()`) the stored value
+// itself is returned: don't change a value of a reference type in
+// place but `Set()` a changed copy.
+//
+//	`aKey` The identifier to lookup.
+func (tx *TTransaction) Get(aKey string) interface{} {
+	return copyOut(aKey, tx.data[aKey])
+} // Get()
+
+// GetInt returns the `int` session data identified by `aKey`.
+//
+// The second (`bool`) return value signals whether a session
+// value of an integer type (fitting into `int64`) is associated
+// with `aKey`.
+//
+//	`aKey` The identifier to lookup.
+func (tx *TTransaction) GetInt(aKey string) (int64, bool) {
+	return intValue(tx.data[aKey])
+} // GetInt()
+
+// Len returns the current length of the list of session variables.
+func (tx *TTransaction) Len() int {
+	return len(tx.data)
+} // Len()
+
+// `modify()` makes sure the transaction works on a copy of the
+// session data and records `aKey` as changed.
+//
+//	`aKey` The identifier of the value to change.
+func (tx *TTransaction) modify(aKey string) {
+	if tx.changed {
+		tx.keys[aKey] = struct{}{}
+		return
+	}
+	data := make(tSessionData, len(tx.data)+1)
+	for key, value := range tx.data {
+		data[key] = value
+	}
+	tx.data, tx.changed = data, true
+	tx.keys = map[string]struct{}{aKey: {}}
+} // modify()
+
+// `run()` calls `aFunc` with `tx` returning its error (or the panic
+// it raised, or the first value rejected by `Set()`).
+//
+//	`aFunc` The transaction's function.
+func (tx *TTransaction) run(aFunc func(*TTransaction) error) (rErr error) {
+	if nil == aFunc {
+		return nil
+	}
+	defer func() {
+		if r := recover(); nil != r {
+			rErr = fmt.Errorf("sessions: transaction panicked: %v", r)
+		}
+	}()
+
+	if err := aFunc(tx); nil != err {
+		return err
+	}
+
+	return tx.err
+} // run()
+
+// Set adds/updates the session data of `aKey` with `aValue`.
+//
+// If the value is rejected by the copy policy (see `SetCopyPolicy()`)
+// the whole transaction fails, i.e. `Update()` returns the error and
+// the session data remain unchanged.
+//
+//	`aKey` The identifier to lookup.
+//	`aValue` The value to assign.
+func (tx *TTransaction) Set(aKey string, aValue interface{}) {
+	value, err := copyIn(aKey, aValue)
+	if nil != err {
+		if nil == tx.err {
+			tx.err = err
+		}
+		return
+	}
+	tx.modify(aKey)
+	tx.data[aKey] = value
+} // Set()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// CompareAndSwap sets the session data of `aKey` to `aNew` if its
+// current value equals `aOld` (using `reflect.DeepEqual()`, i.e. the
+// types have to match as well).
+//
+// A `nil` `aOld` matches a missing `aKey`.
+// The method returns whether the value was swapped (which it isn't if
+// `aNew` is rejected by the copy policy or the session limits).
+//
+//	`aKey` The identifier to lookup.
+//	`aOld` The expected current value.
+//	`aNew` The value to assign.
+func (so *TSession) CompareAndSwap(aKey string, aOld, aNew interface{}) (rSwapped bool) {
+	err := so.Update(func(aTx *TTransaction) error {
+		if rSwapped = reflect.DeepEqual(aOld, aTx.Get(aKey)); rSwapped {
+			aTx.Set(aKey, aNew)
+		}
+		return nil
+	})
+
+	return rSwapped && (nil == err)
+} // CompareAndSwap()
+
+// Incr adds `aDelta` to the integer session data of `aKey` and
+// returns the new value.
+//
+// A missing `aKey` counts as zero.
+// If the current value isn't an integer `ErrNotInteger` is returned
+// and the value remains unchanged.
+//
+//	`aKey` The identifier to lookup.
+//	`aDelta` The value to add.
+func (so *TSession) Incr(aKey string, aDelta int64) (rValue int64, rErr error) {
+	rErr = so.Update(func(aTx *TTransaction) error {
+		current := aTx.Get(aKey)
+		if i, ok := current.(int); ok {
+			// keep the value's type
+			rValue = int64(i) + aDelta
+			aTx.Set(aKey, int(rValue))
+			return nil
+		}
+		i, ok := aTx.GetInt(aKey)
+		if !ok && (nil != current) {
+			return ErrNotInteger
+		}
+		rValue = i + aDelta
+		aTx.Set(aKey, rValue)
+		return nil
+	})
+
+	return
+} // Incr()
+
+// Update calls `aFunc` with exclusive access to the session's data
+// and returns the function's error.
+//
+// All other requests for the session wait until `aFunc` returns;
+// hence `aFunc` should be fast and must not use any `TSession`
+// methods (which would deadlock).
+// The changes done by `aFunc` are applied only if it returns `nil`;
+// if it returns an error (or panics) the session data remain as they
+// were.
+//
+// If `aFunc` sets a value rejected by the copy policy, or if the
+// changes would exceed the session limits (see `SetSessionLimits()`),
+// they're dropped as well and the respective error (e.g. one wrapping
+// `ErrSessionLimit`) is returned.
+//
+// With the `CopyNone` policy (see `SetCopyPolicy()`) `TTransaction.Get()`
+// returns the stored values themselves: changing a value of a reference
+// type in place bypasses this rollback (and races with the session
+// being written to the store), so `Set()` a changed copy instead.
+//
+//	`aFunc` The function to read and modify the session data.
+func (so *TSession) Update(aFunc func(aTx *TTransaction) error) error {
+	result := so.request(smUpdateSession, "", aFunc)
+	if err, ok := result.sValue.(error); ok {
+		return err
+	}
+
+	return nil
+} // Update()
+
+/* _EoF_ */
@@ -0,0 +1,136 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTSession_Update(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	so.Set("Zahl", 1).Set("Zeichenkette", "eins")
+
+	err := so.Update(func(aTx *TTransaction) error {
+		i, _ := aTx.GetInt("Zahl")
+		aTx.Set("Zahl", i+1)
+		aTx.Delete("Zeichenkette")
+		return nil
+	})
+	if nil != err {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got, _ := so.GetInt("Zahl"); 2 != got {
+		t.Errorf("GetInt() = %v, want %v", got, 2)
+	}
+	if got := so.Len(); 1 != got {
+		t.Errorf("Len() = %v, want %v", got, 1)
+	}
+
+	// rollback on error
+	errKaputt := errors.New("kaputt")
+	err = so.Update(func(aTx *TTransaction) error {
+		aTx.Set("Zahl", 99)
+		aTx.Set("neu", true)
+		return errKaputt
+	})
+	if !errors.Is(err, errKaputt) {
+		t.Errorf("Update() error = %v, want %v", err, errKaputt)
+	}
+	if got, _ := so.GetInt("Zahl"); 2 != got {
+		t.Errorf("GetInt() after rollback = %v, want %v", got, 2)
+	}
+	if got := so.Len(); 1 != got {
+		t.Errorf("Len() after rollback = %v, want %v", got, 1)
+	}
+
+	// rollback on panic
+	err = so.Update(func(aTx *TTransaction) error {
+		aTx.Set("Zahl", 99)
+		panic("kaputt")
+	})
+	if nil == err {
+		t.Error("Update() with panic: no error")
+	}
+	if got, _ := so.GetInt("Zahl"); 2 != got {
+		t.Errorf("GetInt() after panic = %v, want %v", got, 2)
+	}
+} // TestTSession_Update()
+
+func TestTSession_Incr(t *testing.T) {
+	for _, engine := range []TEngine{EngineChannels, EngineLocks} {
+		t.Run(engine.String(), func(t *testing.T) {
+			if EngineLocks == engine {
+				soEngine = startLockEngine(NewMemoryStore("", 0), 4)
+			} else {
+				soEngine = startMonitors(NewMemoryStore("", 0), 4)
+			}
+			defer stopSession()
+			sid := newSID()
+
+			var wg sync.WaitGroup
+			for w := 0; 8 > w; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					so := &TSession{sID: sid}
+					for i := 0; 100 > i; i++ {
+						if _, err := so.Incr("count", 1); nil != err {
+							t.Errorf("Incr() error = %v", err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			so := &TSession{sID: sid}
+			if got, _ := so.GetInt("count"); 800 != got {
+				t.Errorf("GetInt() = %v, want %v", got, 800)
+			}
+		})
+	}
+
+	so := &TSession{sID: newSID()}
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so.Set("Zahl", 5).Set("Zeichenkette", "fünf")
+	if got, err := so.Incr("Zahl", -2); (nil != err) || (3 != got) {
+		t.Errorf("Incr() = %v, %v, want %v", got, err, 3)
+	}
+	if _, ok := so.Get("Zahl").(int); !ok {
+		t.Errorf("Incr() changed the type to %T", so.Get("Zahl"))
+	}
+	if _, err := so.Incr("Zeichenkette", 1); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("Incr() error = %v, want %v", err, ErrNotInteger)
+	}
+} // TestTSession_Incr()
+
+func TestTSession_CompareAndSwap(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+
+	if !so.CompareAndSwap("Zustand", nil, "neu") {
+		t.Error("CompareAndSwap(nil) = false, want true")
+	}
+	if so.CompareAndSwap("Zustand", "alt", "bezahlt") {
+		t.Error("CompareAndSwap(alt) = true, want false")
+	}
+	if !so.CompareAndSwap("Zustand", "neu", "bezahlt") {
+		t.Error("CompareAndSwap(neu) = false, want true")
+	}
+	if got, _ := so.GetString("Zustand"); "bezahlt" != got {
+		t.Errorf("GetString() = %q, want %q", got, "bezahlt")
+	}
+	so.Set("Liste", []string{"a", "b"})
+	if !so.CompareAndSwap("Liste", []string{"a", "b"}, []string{"c"}) {
+		t.Error("CompareAndSwap(Liste) = false, want true")
+	}
+} // TestTSession_CompareAndSwap()
@@ -0,0 +1,226 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides type-safe access to the session data.
+ *
+ * Numeric values are widened the same way by all getters: an integer
+ * value is returned as any integer type able to hold it (e.g. an
+ * `int32` value as `int64`, a `uint` value as `int`), and a `float32`
+ * value as `float64`.
+ */
+
+import (
+	"math"
+)
+
+type (
+	// TKey is a session key bound to the type of its values.
+	//
+	// Using a `TKey` (instead of a plain string) ensures that only
+	// values of type `T` are stored and that they are read back as
+	// `T`.
+	TKey[T any] struct {
+		name string
+	}
+)
+
+// NewKey returns a session key `aName` for values of type `T`.
+//
+//	`aName` The identifier of the session value.
+func NewKey[T any](aName string) TKey[T] {
+	return TKey[T]{name: aName}
+} // NewKey()
+
+// Delete removes the key's session data from `aSession`.
+//
+//	`aSession` The session to use.
+func (k TKey[T]) Delete(aSession *TSession) *TSession {
+	return aSession.Delete(k.name)
+} // Delete()
+
+// Get returns the key's session data of `aSession`.
+//
+// The second (`bool`) return value signals whether a session value
+// of type `T` (or a numeric value convertible to `T`, see `Get()`)
+// is associated with the key.
+//
+//	`aSession` The session to use.
+func (k TKey[T]) Get(aSession *TSession) (T, bool) {
+	return Get[T](aSession, k.name)
+} // Get()
+
+// GetOr returns the key's session data of `aSession` or `aDefault`
+// if there's no such value of type `T`.
+//
+//	`aSession` The session to use.
+//	`aDefault` The value to return if the key's value is missing.
+func (k TKey[T]) GetOr(aSession *TSession, aDefault T) T {
+	return GetOr(aSession, k.name, aDefault)
+} // GetOr()
+
+// Name returns the key's identifier.
+func (k TKey[T]) Name() string {
+	return k.name
+} // Name()
+
+// Set adds/updates the key's session data of `aSession` with `aValue`.
+//
+//	`aSession` The session to use.
+//	`aValue` The value to assign.
+func (k TKey[T]) Set(aSession *TSession, aValue T) *TSession {
+	return aSession.Set(k.name, aValue)
+} // Set()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// Get returns the session data of `aSession` identified by `aKey` as
+// a value of type `T`.
+//
+// The second (`bool`) return value signals whether a session value
+// of type `T` is associated with `aKey`.
+// Numeric values are widened if `T` can hold them, e.g. an `int32`
+// value is returned by `Get[int64]()` and a `float32` value by
+// `Get[float64]()`.
+//
+//	`aSession` The session to use.
+//	`aKey` The identifier to lookup.
+func Get[T any](aSession *TSession, aKey string) (T, bool) {
+	return valueAs[T](aSession.Get(aKey))
+} // Get()
+
+// GetOr returns the session data of `aSession` identified by `aKey`
+// as a value of type `T` or `aDefault` if there's no such value.
+//
+//	`aSession` The session to use.
+//	`aKey` The identifier to lookup.
+//	`aDefault` The value to return if `aKey`'s value is missing.
+func GetOr[T any](aSession *TSession, aKey string, aDefault T) T {
+	if result, ok := Get[T](aSession, aKey); ok {
+		return result
+	}
+
+	return aDefault
+} // GetOr()
+
+// `intValue()` returns the integer `aValue` as `int64` if it fits.
+//
+//	`aValue` The value to convert.
+func intValue(aValue interface{}) (int64, bool) {
+	if i, ok := signedValue(aValue); ok {
+		return i, true
+	}
+	if u, ok := uintValue(aValue); ok && (math.MaxInt64 >= u) {
+		return int64(u), true
+	}
+
+	return 0, false
+} // intValue()
+
+// `signedValue()` returns the signed integer `aValue` as `int64`.
+//
+//	`aValue` The value to convert.
+func signedValue(aValue interface{}) (int64, bool) {
+	switch v := aValue.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+
+	return 0, false
+} // signedValue()
+
+// `uintValue()` returns the non-negative integer `aValue` as `uint64`.
+//
+//	`aValue` The value to convert.
+func uintValue(aValue interface{}) (uint64, bool) {
+	switch v := aValue.(type) {
+	case uint:
+		return uint64(v), true
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case uintptr:
+		return uint64(v), true
+	}
+	if i, ok := signedValue(aValue); ok && (0 <= i) {
+		return uint64(i), true
+	}
+
+	return 0, false
+} // uintValue()
+
+// `valueAs()` returns `aValue` as a value of type `T`, widening
+// numeric values if possible.
+//
+//	`aValue` The value to convert.
+func valueAs[T any](aValue interface{}) (rValue T, rOK bool) {
+	if result, ok := aValue.(T); ok {
+		return result, true
+	}
+
+	switch p := interface{}(&rValue).(type) {
+	case *float64:
+		if f, ok := aValue.(float32); ok {
+			*p, rOK = float64(f), true
+		}
+	case *int:
+		if i, ok := intValue(aValue); ok && (math.MinInt <= i) && (math.MaxInt >= i) {
+			*p, rOK = int(i), true
+		}
+	case *int8:
+		if i, ok := intValue(aValue); ok && (math.MinInt8 <= i) && (math.MaxInt8 >= i) {
+			*p, rOK = int8(i), true
+		}
+	case *int16:
+		if i, ok := intValue(aValue); ok && (math.MinInt16 <= i) && (math.MaxInt16 >= i) {
+			*p, rOK = int16(i), true
+		}
+	case *int32:
+		if i, ok := intValue(aValue); ok && (math.MinInt32 <= i) && (math.MaxInt32 >= i) {
+			*p, rOK = int32(i), true
+		}
+	case *int64:
+		*p, rOK = intValue(aValue)
+	case *uint:
+		if u, ok := uintValue(aValue); ok && (math.MaxUint >= u) {
+			*p, rOK = uint(u), true
+		}
+	case *uint8:
+		if u, ok := uintValue(aValue); ok && (math.MaxUint8 >= u) {
+			*p, rOK = uint8(u), true
+		}
+	case *uint16:
+		if u, ok := uintValue(aValue); ok && (math.MaxUint16 >= u) {
+			*p, rOK = uint16(u), true
+		}
+	case *uint32:
+		if u, ok := uintValue(aValue); ok && (math.MaxUint32 >= u) {
+			*p, rOK = uint32(u), true
+		}
+	case *uint64:
+		*p, rOK = uintValue(aValue)
+	}
+
+	return
+} // valueAs()
+
+/* _EoF_ */
@@ -0,0 +1,110 @@
+/*
+   Copyright © 2019, 2025 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+package sessions
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+type tTypedCart struct {
+	Items []string
+	Total float64
+}
+
+func Test_valueAs(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		conv   func(interface{}) (interface{}, bool)
+		want   interface{}
+		wantOK bool
+	}{
+		{" 1", int32(7), asType[int64], int64(7), true},
+		{" 2", uint(7), asType[int], 7, true},
+		{" 3", int8(-7), asType[int64], int64(-7), true},
+		{" 4", int(-7), asType[uint], uint(0), false},
+		{" 5", int(300), asType[int8], int8(0), false},
+		{" 6", uint64(math.MaxUint64), asType[int64], int64(0), false},
+		{" 7", uint8(255), asType[uint64], uint64(255), true},
+		{" 8", float32(1.5), asType[float64], 1.5, true},
+		{" 9", 1.5, asType[float32], float32(0), false},
+		{"10", 7, asType[float64], 0.0, false},
+		{"11", "7", asType[int], 0, false},
+		{"12", nil, asType[string], "", false},
+		{"13", []string{"a"}, asType[[]string], []string{"a"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotOK := tt.conv(tt.value)
+			if !reflect.DeepEqual(got, tt.want) || (gotOK != tt.wantOK) {
+				t.Errorf("valueAs(%T %v) = %T %v, %v, want %T %v, %v",
+					tt.value, tt.value, got, got, gotOK, tt.want, tt.want, tt.wantOK)
+			}
+		})
+	}
+} // Test_valueAs()
+
+// `asType()` calls `valueAs[T]()` returning its result untyped.
+func asType[T any](aValue interface{}) (interface{}, bool) {
+	return valueAs[T](aValue)
+} // asType()
+
+func TestGet(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	cart := tTypedCart{Items: []string{"Buch", "Stift"}, Total: 12.5}
+	so.Set("Warenkorb", cart).Set("Zahl", int32(42)).Set("Liste", []string{"a", "b"})
+
+	if got, ok := Get[tTypedCart](so, "Warenkorb"); !ok || !reflect.DeepEqual(got, cart) {
+		t.Errorf("Get[tTypedCart]() = %v, %v, want %v", got, ok, cart)
+	}
+	if got, ok := Get[int64](so, "Zahl"); !ok || (42 != got) {
+		t.Errorf("Get[int64]() = %v, %v, want %v", got, ok, 42)
+	}
+	if got, ok := so.GetInt("Zahl"); !ok || (42 != got) {
+		t.Errorf("GetInt() = %v, %v, want %v", got, ok, 42)
+	}
+	if got, ok := Get[string](so, "Zahl"); ok || ("" != got) {
+		t.Errorf("Get[string]() = %q, %v, want %q", got, ok, "")
+	}
+	if got := GetOr(so, "fehlt", []string{"x"}); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("GetOr() = %v, want %v", got, []string{"x"})
+	}
+	if got := GetOr(so, "Liste", []string{"x"}); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("GetOr() = %v, want %v", got, []string{"a", "b"})
+	}
+} // TestGet()
+
+func TestTKey(t *testing.T) {
+	soEngine = startMonitors(NewMemoryStore("", 0), 1)
+	defer stopSession()
+	so := &TSession{sID: newSID()}
+	cartKey := NewKey[tTypedCart]("Warenkorb")
+	countKey := NewKey[int]("Anzahl")
+
+	if got := cartKey.Name(); "Warenkorb" != got {
+		t.Errorf("Name() = %q, want %q", got, "Warenkorb")
+	}
+	if _, ok := cartKey.Get(so); ok {
+		t.Error("Get() of missing key: ok")
+	}
+	cart := tTypedCart{Items: []string{"Buch"}, Total: 9.99}
+	cartKey.Set(so, cart)
+	countKey.Set(so, countKey.GetOr(so, 0)+1)
+	if got, ok := cartKey.Get(so); !ok || !reflect.DeepEqual(got, cart) {
+		t.Errorf("Get() = %v, %v, want %v", got, ok, cart)
+	}
+	if got := countKey.GetOr(so, 0); 1 != got {
+		t.Errorf("GetOr() = %v, want %v", got, 1)
+	}
+	cartKey.Delete(so)
+	if got := so.Len(); 1 != got {
+		t.Errorf("Len() after Delete() = %v, want %v", got, 1)
+	}
+} // TestTKey()